@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"flight-tracker-slack/db"
+)
+
+// requireAdmin guards the /admin endpoints with ADMIN_TOKEN, sent as a
+// bearer token. They are disabled when no token is configured.
+func (b *Bot) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if b.AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(b.AdminToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleExport serves GET /admin/export?format=json|csv.
+func (b *Bot) handleExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = db.FormatJSON
+	}
+
+	export, err := db.ExportStore(b.Store, b.Clock.Now())
+	if err != nil {
+		fmt.Println("Error exporting flights:", err)
+		http.Error(w, "export failed", http.StatusInternalServerError)
+		return
+	}
+
+	if format == db.FormatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	if err := db.WriteExport(w, export, format); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// handleImport serves POST /admin/import?format=json|csv&dry_run=true with
+// the export as the request body, and answers with the import report.
+func (b *Bot) handleImport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = db.FormatJSON
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	export, err := db.ReadExport(r.Body, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := db.Import(b.Store, export, dryRun)
+	if err != nil {
+		fmt.Println("Error importing flights:", err)
+		http.Error(w, report.String()+"\nimport stopped: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	if len(report.Invalid) > 0 && !dryRun {
+		// nothing was imported
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	fmt.Fprintln(w, report)
+}
+
+// formatOf picks the export format from -format, or from the file
+// extension.
+func formatOf(path string, format string) string {
+	if format != "" {
+		return format
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return db.FormatCSV
+	}
+	return db.FormatJSON
+}
+
+func runExport(store db.Store, path string, format string) int {
+	export, err := db.ExportStore(store, realClock{}.Now())
+	if err != nil {
+		fmt.Println("Error exporting flights:", err)
+		return 1
+	}
+
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			fmt.Println("Error creating export file:", err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := db.WriteExport(out, export, formatOf(path, format)); err != nil {
+		fmt.Println("Error writing export:", err)
+		return 1
+	}
+	if path != "-" {
+		fmt.Printf("Exported %d subscriptions to %s\n", len(export.Subscriptions), path)
+	}
+	return 0
+}
+
+func runImport(store db.Store, path string, format string, dryRun bool) int {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Println("Error opening import file:", err)
+			return 1
+		}
+		defer file.Close()
+		in = file
+	}
+
+	export, err := db.ReadExport(in, formatOf(path, format))
+	if err != nil {
+		fmt.Println("Error reading import file:", err)
+		return 1
+	}
+
+	report, err := db.Import(store, export, dryRun)
+	fmt.Println(report)
+	if err != nil {
+		fmt.Println("Import stopped:", err)
+		return 1
+	}
+	if len(report.Invalid) > 0 {
+		return 1
+	}
+	return 0
+}
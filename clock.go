@@ -0,0 +1,28 @@
+package main
+
+import "time"
+
+// Clock is where the poller gets the current time from, so recorded flights
+// can be replayed on a simulated timeline.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// simClock only moves when told to.
+type simClock struct {
+	now time.Time
+}
+
+func (c *simClock) Now() time.Time {
+	return c.now
+}
+
+func (c *simClock) Set(t time.Time) {
+	c.now = t
+}
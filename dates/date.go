@@ -0,0 +1,72 @@
+package dates
+
+import (
+	"fmt"
+	"time"
+)
+
+// Date is a calendar day with no time or zone attached, such as the
+// departure date printed on a boarding pass.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+const layout = "2006-01-02"
+
+// Of returns the calendar day t falls on in loc.
+func Of(t time.Time, loc *time.Location) Date {
+	y, m, d := t.In(loc).Date()
+	return Date{Year: y, Month: m, Day: d}
+}
+
+// Today is the current day for someone in loc.
+func Today(now time.Time, loc *time.Location) Date {
+	return Of(now, loc)
+}
+
+func Parse(s string) (Date, error) {
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return Date{}, fmt.Errorf("invalid date %q: %w", s, err)
+	}
+	return Of(t, time.UTC), nil
+}
+
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+// In returns midnight at the start of the day in loc.
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+func (d Date) AddDays(n int) Date {
+	return Of(d.In(time.UTC).AddDate(0, 0, n), time.UTC)
+}
+
+func (d Date) Before(other Date) bool {
+	return d.In(time.UTC).Before(other.In(time.UTC))
+}
+
+func (d Date) After(other Date) bool {
+	return other.Before(d)
+}
+
+func (d Date) Weekday() time.Weekday {
+	return d.In(time.UTC).Weekday()
+}
+
+// Format formats the date with a time layout, e.g. "02 Jan 2006".
+func (d Date) Format(layout string) string {
+	return d.In(time.UTC).Format(layout)
+}
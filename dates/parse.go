@@ -0,0 +1,307 @@
+package dates
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnrecognised = errors.New("unrecognised date")
+
+// AmbiguousError is returned when an expression reads as more than one
+// date, like "03/12". Candidates are in order of preference.
+type AmbiguousError struct {
+	Input      string
+	Candidates []Date
+}
+
+func (e *AmbiguousError) Error() string {
+	var options []string
+	for _, c := range e.Candidates {
+		options = append(options, c.String())
+	}
+	return fmt.Sprintf("ambiguous date %q: %s", e.Input, strings.Join(options, " or "))
+}
+
+var relativeDays = map[string]int{
+	"yesterday":          -1,
+	"hier":               -1,
+	"today":              0,
+	"tod":                0,
+	"aujourd'hui":        0,
+	"aujourdhui":         0,
+	"auj":                0,
+	"tomorrow":           1,
+	"tmrw":               1,
+	"tmr":                1,
+	"demain":             1,
+	"day after tomorrow": 2,
+	"apres-demain":       2,
+	"apres demain":       2,
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday, "dim": time.Sunday, "dimanche": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday, "lun": time.Monday, "lundi": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday, "mar": time.Tuesday, "mardi": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday, "mer": time.Wednesday, "mercredi": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday, "jeu": time.Thursday, "jeudi": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday, "ven": time.Friday, "vendredi": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday, "sam": time.Saturday, "samedi": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "january": time.January, "janv": time.January, "janvier": time.January,
+	"feb": time.February, "february": time.February, "fev": time.February, "fevr": time.February, "fevrier": time.February,
+	"mar": time.March, "march": time.March, "mars": time.March,
+	"apr": time.April, "april": time.April, "avr": time.April, "avril": time.April,
+	"may": time.May, "mai": time.May,
+	"jun": time.June, "june": time.June, "juin": time.June,
+	"jul": time.July, "july": time.July, "juil": time.July, "juillet": time.July,
+	"aug": time.August, "august": time.August, "aou": time.August, "aout": time.August,
+	"sep": time.September, "sept": time.September, "september": time.September, "septembre": time.September,
+	"oct": time.October, "october": time.October, "octobre": time.October,
+	"nov": time.November, "november": time.November, "novembre": time.November,
+	"dec": time.December, "december": time.December, "decembre": time.December,
+}
+
+// words that only make a phrase read naturally: "on the 12th of march",
+// "le 12 mars"
+var fillers = map[string]bool{
+	"on": true, "the": true, "of": true, "le": true, "de": true, "du": true,
+}
+
+// "next friday", "vendredi prochain": strictly after today.
+// "this friday", "ce vendredi": today counts.
+var (
+	nextWords = map[string]bool{"next": true, "prochain": true, "prochaine": true}
+	thisWords = map[string]bool{"this": true, "ce": true, "cette": true}
+)
+
+var (
+	isoRe      = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})$`)
+	numericRe  = regexp.MustCompile(`^(\d{1,2})[/.\-](\d{1,2})(?:[/.\-](\d{2}|\d{4}))?$`)
+	inRe       = regexp.MustCompile(`^(?:in|dans|\+)\s*(\d+)\s*(days?|d|jours?|j|weeks?|w|semaines?|sem)?$`)
+	ordinalRe  = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th|er|e|eme)$`)
+	accentsMap = strings.NewReplacer("é", "e", "è", "e", "ê", "e", "ë", "e", "à", "a", "â", "a", "û", "u", "ù", "u", "ô", "o", "î", "i", "ï", "i", "ç", "c", "’", "'")
+)
+
+// ParseExpression reads a date as people type it, in English or French,
+// relative to today:
+//
+//	today, tomorrow, demain, après-demain
+//	fri, vendredi, next monday, lundi prochain
+//	in 3 days, dans 2 semaines, +3
+//	12 mar, march 12th, 1er mars, le 12 mars 2027, 12
+//	2026-03-12, 12/03/2026, 25/12, 03/12
+//
+// Dates without a year are the next such day, yesterday included since a
+// flight that left then may still be in the air. Numeric dates that only
+// read one way round, 25/12, are taken that way; "03/12" and "03/12/2026"
+// could be either and return an *AmbiguousError.
+func ParseExpression(input string, today Date) (Date, error) {
+	s := normalize(input)
+	if s == "" {
+		return Date{}, fmt.Errorf("%w: empty", ErrUnrecognised)
+	}
+
+	if days, ok := relativeDays[s]; ok {
+		return today.AddDays(days), nil
+	}
+
+	if m := inRe.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if strings.HasPrefix(m[2], "w") || strings.HasPrefix(m[2], "sem") {
+			n *= 7
+		}
+		return today.AddDays(n), nil
+	}
+
+	if m := isoRe.FindStringSubmatch(s); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		day, _ := strconv.Atoi(m[3])
+		return exact(input, year, time.Month(month), day)
+	}
+
+	if m := numericRe.FindStringSubmatch(s); m != nil {
+		return parseNumeric(input, m, today)
+	}
+
+	return parseWords(input, s, today)
+}
+
+func normalize(input string) string {
+	s := accentsMap.Replace(strings.ToLower(strings.TrimSpace(input)))
+	s = strings.NewReplacer(",", " ", "l'", "").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func parseNumeric(input string, m []string, today Date) (Date, error) {
+	first, _ := strconv.Atoi(m[1])
+	second, _ := strconv.Atoi(m[2])
+
+	var dayFirst, monthFirst Date
+	var dayFirstOK, monthFirstOK bool
+	if m[3] != "" {
+		year, _ := strconv.Atoi(m[3])
+		if year < 100 {
+			year += 2000
+		}
+		dayFirst = Date{Year: year, Month: time.Month(second), Day: first}
+		monthFirst = Date{Year: year, Month: time.Month(first), Day: second}
+		dayFirstOK, monthFirstOK = valid(dayFirst), valid(monthFirst)
+	} else {
+		dayFirst, dayFirstOK = upcoming(today, time.Month(second), first)
+		monthFirst, monthFirstOK = upcoming(today, time.Month(first), second)
+	}
+
+	switch {
+	case dayFirstOK && monthFirstOK && dayFirst != monthFirst:
+		return Date{}, &AmbiguousError{Input: input, Candidates: []Date{dayFirst, monthFirst}}
+	case dayFirstOK:
+		return dayFirst, nil
+	case monthFirstOK:
+		return monthFirst, nil
+	}
+	return Date{}, fmt.Errorf("%w: %q", ErrUnrecognised, input)
+}
+
+func parseWords(input string, s string, today Date) (Date, error) {
+	var (
+		weekday    time.Weekday
+		hasWeekday bool
+		month      time.Month
+		hasMonth   bool
+		day, year  int
+		next, this bool
+		words      []string
+	)
+
+	for _, word := range strings.Fields(s) {
+		switch {
+		case fillers[word]:
+		case nextWords[word]:
+			next = true
+		case thisWords[word]:
+			this = true
+		default:
+			words = append(words, word)
+		}
+	}
+
+	// "mar 12" is March, "mar" alone is mardi
+	hasNumber := false
+	for _, word := range words {
+		if _, err := strconv.Atoi(strings.TrimRight(word, "stndrhe")); err == nil {
+			hasNumber = true
+		}
+	}
+
+	for _, word := range words {
+		if m := ordinalRe.FindStringSubmatch(word); m != nil {
+			word = m[1]
+		}
+		if n, err := strconv.Atoi(word); err == nil {
+			switch {
+			case n >= 1 && n <= 31 && day == 0:
+				day = n
+			case n >= 2000 && n <= 2100 && year == 0:
+				year = n
+			default:
+				return Date{}, fmt.Errorf("%w: %q", ErrUnrecognised, input)
+			}
+			continue
+		}
+		if m, ok := months[word]; ok && !hasMonth && (word != "mar" || hasNumber) {
+			month, hasMonth = m, true
+			continue
+		}
+		if wd, ok := weekdays[word]; ok && !hasWeekday {
+			weekday, hasWeekday = wd, true
+			continue
+		}
+		return Date{}, fmt.Errorf("%w: %q", ErrUnrecognised, input)
+	}
+
+	var date Date
+	switch {
+	case hasMonth && day > 0 && year > 0:
+		d, err := exact(input, year, month, day)
+		if err != nil {
+			return Date{}, err
+		}
+		date = d
+	case hasMonth && day > 0:
+		d, ok := upcoming(today, month, day)
+		if !ok {
+			return Date{}, fmt.Errorf("%w: %q", ErrUnrecognised, input)
+		}
+		date = d
+	case day > 0 && !hasMonth && year == 0:
+		date = upcomingDay(today, day)
+		if date.IsZero() {
+			return Date{}, fmt.Errorf("%w: %q", ErrUnrecognised, input)
+		}
+	case hasWeekday && !hasMonth && day == 0 && year == 0:
+		return nextWeekday(today, weekday, next && !this), nil
+	default:
+		return Date{}, fmt.Errorf("%w: %q", ErrUnrecognised, input)
+	}
+
+	// "fri 12 mar" when the 12th isn't a Friday
+	if hasWeekday && date.Weekday() != weekday {
+		return Date{}, &AmbiguousError{Input: input, Candidates: []Date{date, nextWeekday(today, weekday, false)}}
+	}
+	return date, nil
+}
+
+func exact(input string, year int, month time.Month, day int) (Date, error) {
+	d := Date{Year: year, Month: month, Day: day}
+	if !valid(d) {
+		return Date{}, fmt.Errorf("%w: %q", ErrUnrecognised, input)
+	}
+	return d, nil
+}
+
+func valid(d Date) bool {
+	if d.Month < time.January || d.Month > time.December || d.Day < 1 {
+		return false
+	}
+	return Of(d.In(time.UTC), time.UTC) == d
+}
+
+// upcoming is the next month/day on or after yesterday.
+func upcoming(today Date, month time.Month, day int) (Date, bool) {
+	for year := today.Year; year <= today.Year+4; year++ {
+		d := Date{Year: year, Month: month, Day: day}
+		if valid(d) && !d.Before(today.AddDays(-1)) {
+			return d, true
+		}
+	}
+	return Date{}, false
+}
+
+// upcomingDay is the next day of the month with this number.
+func upcomingDay(today Date, day int) Date {
+	month := Date{Year: today.Year, Month: today.Month, Day: 1}
+	for i := 0; i < 12; i++ {
+		d := Date{Year: month.Year, Month: month.Month, Day: day}
+		if valid(d) && !d.Before(today.AddDays(-1)) {
+			return d
+		}
+		month = Of(month.In(time.UTC).AddDate(0, 1, 0), time.UTC)
+	}
+	return Date{}
+}
+
+func nextWeekday(today Date, weekday time.Weekday, strictlyAfter bool) Date {
+	days := (int(weekday) - int(today.Weekday()) + 7) % 7
+	if days == 0 && strictlyAfter {
+		days = 7
+	}
+	return today.AddDays(days)
+}
@@ -0,0 +1,108 @@
+package dates
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// a Wednesday, two days before the new year
+var testToday = Date{Year: 2026, Month: 12, Day: 30}
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"today", "2026-12-30"},
+		{"Demain", "2026-12-31"},
+		{"après-demain", "2027-01-01"},
+		{"hier", "2026-12-29"},
+
+		{"fri", "2027-01-01"},
+		{"vendredi", "2027-01-01"},
+		{"wed", "2026-12-30"},
+		{"this wednesday", "2026-12-30"},
+		{"next wednesday", "2027-01-06"},
+		{"mercredi prochain", "2027-01-06"},
+		{"ce vendredi", "2027-01-01"},
+
+		{"in 3 days", "2027-01-02"},
+		{"in 1 week", "2027-01-06"},
+		{"dans 2 semaines", "2027-01-13"},
+		{"dans 4 jours", "2027-01-03"},
+		{"+3", "2027-01-02"},
+
+		// "mar" is March next to a day, mardi alone
+		{"12 mar", "2027-03-12"},
+		{"mar 12", "2027-03-12"},
+		{"mar", "2027-01-05"},
+		{"12 mars", "2027-03-12"},
+
+		{"1er mars", "2027-03-01"},
+		{"march 12th", "2027-03-12"},
+		{"on the 2nd of january", "2027-01-02"},
+		{"le 12 mars 2028", "2028-03-12"},
+		{"fri 12 mar", "2027-03-12"},
+
+		// the new year
+		{"5 jan", "2027-01-05"},
+		{"jan 1st", "2027-01-01"},
+		{"2", "2027-01-02"},
+		{"25/12", "2027-12-25"},
+		{"29 dec", "2026-12-29"},
+
+		{"2026-03-12", "2026-03-12"},
+		{"25/12/2026", "2026-12-25"},
+		{"13.03.27", "2027-03-13"},
+	}
+	for _, tt := range tests {
+		got, err := ParseExpression(tt.input, testToday)
+		if err != nil {
+			t.Errorf("ParseExpression(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseExpression(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseExpressionInvalid(t *testing.T) {
+	for _, input := range []string{"", "31/02", "feb 30", "30/02/2027", "2027-02-30", "32", "31st of june", "banana", "next"} {
+		_, err := ParseExpression(input, testToday)
+		if !errors.Is(err, ErrUnrecognised) {
+			t.Errorf("ParseExpression(%q) error = %v, want unrecognised", input, err)
+		}
+	}
+}
+
+func TestParseExpressionAmbiguous(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"03/12", []string{"2027-12-03", "2027-03-12"}},
+		// with a year too
+		{"03/12/2026", []string{"2026-12-03", "2026-03-12"}},
+		{"12.03.27", []string{"2027-03-12", "2027-12-03"}},
+		// the 13th isn't a Friday
+		{"fri 13 mar", []string{"2027-03-13", "2027-01-01"}},
+	}
+	for _, tt := range tests {
+		_, err := ParseExpression(tt.input, testToday)
+		var ambiguous *AmbiguousError
+		if !errors.As(err, &ambiguous) {
+			t.Errorf("ParseExpression(%q) error = %v, want ambiguous", tt.input, err)
+			continue
+		}
+		var got []string
+		for _, c := range ambiguous.Candidates {
+			got = append(got, c.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParseExpression(%q) candidates = %s, want %s", tt.input, strings.Join(got, " "), strings.Join(tt.want, " "))
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// Dialect is the SQL flavour of the database behind a Store. Queries are
+// written once with ? placeholders and rebound for the dialect.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// DefaultURL is the SQLite file used when DATABASE_URL is not set.
+const DefaultURL = "flights.db"
+
+// Open connects to a database URL: postgres:// and postgresql:// URLs go to
+// PostgreSQL, anything else is a SQLite file path, optionally prefixed with
+// sqlite://.
+func Open(url string) (*sql.DB, Dialect, error) {
+	if url == "" {
+		url = DefaultURL
+	}
+	if strings.HasPrefix(url, "postgres://") || strings.HasPrefix(url, "postgresql://") {
+		database, err := sql.Open("pgx", url)
+		return database, Postgres, err
+	}
+
+	path := strings.TrimPrefix(url, "sqlite://")
+	database, err := sql.Open("sqlite", "file:"+path+"?_busy_timeout=5000")
+	return database, SQLite, err
+}
+
+// rebind turns ? placeholders into $1, $2... for PostgreSQL. Our queries
+// never contain a literal question mark.
+func (d Dialect) rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
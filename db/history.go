@@ -0,0 +1,162 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	"flight-tracker-slack/dates"
+)
+
+// EventTimes is when one OOOI event was scheduled and when it happened.
+type EventTimes struct {
+	Scheduled time.Time
+	Actual    time.Time
+}
+
+// Delay is how late the event happened, and false if it hasn't yet.
+func (e EventTimes) Delay() (time.Duration, bool) {
+	if e.Scheduled.IsZero() || e.Actual.IsZero() {
+		return 0, false
+	}
+	return e.Actual.Sub(e.Scheduled), true
+}
+
+// FlightHistory is a completed or cancelled flight, keyed by the operating
+// flight number and its departure day at the origin.
+type FlightHistory struct {
+	FlightID      string
+	DateDeparture dates.Date
+	Origin        string
+	Destination   string
+	Cancelled     bool
+	Diverted      bool
+	Out           EventTimes
+	Off           EventTimes
+	On            EventTimes
+	In            EventTimes
+	RecordedAt    time.Time
+}
+
+// SaveHistory records a flight, replacing what an earlier poll saw of it.
+func (store *SQLStore) SaveHistory(h FlightHistory) error {
+	_, err := store.exec(`
+	INSERT INTO flight_history (
+		flight_id,
+		date_departure,
+		origin,
+		destination,
+		cancelled,
+		diverted,
+		out_scheduled,
+		out_actual,
+		off_scheduled,
+		off_actual,
+		on_scheduled,
+		on_actual,
+		in_scheduled,
+		in_actual,
+		recorded_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (flight_id, date_departure) DO UPDATE SET
+		origin = excluded.origin,
+		destination = excluded.destination,
+		cancelled = excluded.cancelled,
+		diverted = excluded.diverted,
+		out_scheduled = excluded.out_scheduled,
+		out_actual = excluded.out_actual,
+		off_scheduled = excluded.off_scheduled,
+		off_actual = excluded.off_actual,
+		on_scheduled = excluded.on_scheduled,
+		on_actual = excluded.on_actual,
+		in_scheduled = excluded.in_scheduled,
+		in_actual = excluded.in_actual,
+		recorded_at = excluded.recorded_at
+	`,
+		h.FlightID,
+		encodeDate(h.DateDeparture),
+		h.Origin,
+		h.Destination,
+		h.Cancelled,
+		h.Diverted,
+		encodeTime(h.Out.Scheduled),
+		encodeTime(h.Out.Actual),
+		encodeTime(h.Off.Scheduled),
+		encodeTime(h.Off.Actual),
+		encodeTime(h.On.Scheduled),
+		encodeTime(h.On.Actual),
+		encodeTime(h.In.Scheduled),
+		encodeTime(h.In.Actual),
+		encodeTime(h.RecordedAt),
+	)
+	return err
+}
+
+// ListHistory returns the recorded flights under any of the given idents
+// that departed on or after since, oldest first.
+func (store *SQLStore) ListHistory(since dates.Date, flightIDs ...string) ([]FlightHistory, error) {
+	var history []FlightHistory
+	for _, id := range flightIDs {
+		rows, err := store.query(`
+		SELECT flight_id, date_departure, origin, destination, cancelled, diverted,
+			out_scheduled, out_actual, off_scheduled, off_actual,
+			on_scheduled, on_actual, in_scheduled, in_actual, recorded_at
+		FROM flight_history
+		WHERE flight_id = ? AND date_departure >= ?
+		ORDER BY date_departure
+		`, id, encodeDate(since))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			h, err := scanHistory(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			history = append(history, h)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	sortHistory(history)
+	return history, nil
+}
+
+func scanHistory(row scanner) (FlightHistory, error) {
+	var h FlightHistory
+	var departure any
+	times := make([]any, 9)
+	dest := []any{&h.FlightID, &departure, &h.Origin, &h.Destination, &h.Cancelled, &h.Diverted}
+	for i := range times {
+		dest = append(dest, &times[i])
+	}
+	if err := row.Scan(dest...); err != nil {
+		return h, err
+	}
+
+	var err error
+	if h.DateDeparture, err = decodeDate(departure); err != nil {
+		return h, err
+	}
+	targets := []*time.Time{
+		&h.Out.Scheduled, &h.Out.Actual,
+		&h.Off.Scheduled, &h.Off.Actual,
+		&h.On.Scheduled, &h.On.Actual,
+		&h.In.Scheduled, &h.In.Actual,
+		&h.RecordedAt,
+	}
+	for i, t := range targets {
+		if *t, err = decodeTime(times[i]); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+func sortHistory(history []FlightHistory) {
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].DateDeparture.Before(history[j].DateDeparture)
+	})
+}
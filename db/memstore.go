@@ -0,0 +1,273 @@
+package db
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"flight-tracker-slack/dates"
+)
+
+// MemoryStore is a Store that keeps everything in memory. Replays use it, and
+// it is handy anywhere a throwaway database would be.
+type MemoryStore struct {
+	mu            sync.Mutex
+	flights       map[subscriptionKey]TrackedFlight
+	snapshots     []Snapshot
+	notifications []Notification
+	history       map[string]FlightHistory
+	trips         map[int64]Trip
+	lastTripID    int64
+	preferences   map[preferencesKey]Preferences
+	watchers      []Watcher
+}
+
+type subscriptionKey struct {
+	flightID   string
+	departure  dates.Date
+	subscriber Subscriber
+}
+
+func keyOf(f TrackedFlight) subscriptionKey {
+	return subscriptionKey{flightID: f.FlightID, departure: f.DateDeparture, subscriber: f.Subscriber}
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		flights:     map[subscriptionKey]TrackedFlight{},
+		history:     map[string]FlightHistory{},
+		trips:       map[int64]Trip{},
+		preferences: map[preferencesKey]Preferences{},
+	}
+}
+
+func (m *MemoryStore) AddFlight(f TrackedFlight) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := keyOf(f)
+	if _, ok := m.flights[key]; ok {
+		return false, nil
+	}
+	m.flights[key] = TrackedFlight{
+		FlightID:      f.FlightID,
+		DateDeparture: f.DateDeparture,
+		Kind:          f.Kind,
+		Subscriber:    f.Subscriber,
+		CreatedBy:     f.CreatedBy,
+		CreatedIn:     f.CreatedIn,
+		CreatedAt:     f.CreatedAt.UTC().Truncate(time.Second),
+	}
+	return true, nil
+}
+
+func (m *MemoryStore) ListFlights() ([]TrackedFlight, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	flights := make([]TrackedFlight, 0, len(m.flights))
+	for _, f := range m.flights {
+		flights = append(flights, f)
+	}
+	sort.Slice(flights, func(i, j int) bool {
+		a, b := flights[i], flights[j]
+		if a.DateDeparture != b.DateDeparture {
+			return a.DateDeparture.Before(b.DateDeparture)
+		}
+		if a.FlightID != b.FlightID {
+			return a.FlightID < b.FlightID
+		}
+		if a.Subscriber.Kind != b.Subscriber.Kind {
+			return a.Subscriber.Kind < b.Subscriber.Kind
+		}
+		return a.Subscriber.ID < b.Subscriber.ID
+	})
+	return flights, nil
+}
+
+func (m *MemoryStore) SaveFlightState(f TrackedFlight) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := keyOf(f)
+	current, ok := m.flights[key]
+	if !ok {
+		return nil
+	}
+	current.NotifiedPreDeparture = f.NotifiedPreDeparture
+	current.NotifiedTakeoff = f.NotifiedTakeoff
+	current.LastCruiseNotif = f.LastCruiseNotif.UTC().Truncate(time.Second)
+	current.NotifiedLanding = f.NotifiedLanding
+	current.NotifiedInboundLate = f.NotifiedInboundLate
+	current.NotifiedPreArrival = f.NotifiedPreArrival
+	current.CurrentLeg = f.CurrentLeg
+	m.flights[key] = current
+	return nil
+}
+
+func (m *MemoryStore) Unsubscribe(f TrackedFlight) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.flights, keyOf(f))
+	delete(m.preferences, preferencesKey{subscriber: f.Subscriber, flightID: f.FlightID, departure: f.DateDeparture})
+	var watchers []Watcher
+	for _, w := range m.watchers {
+		if w.FlightID != f.FlightID || w.DateDeparture != f.DateDeparture || w.Subscriber != f.Subscriber {
+			watchers = append(watchers, w)
+		}
+	}
+	m.watchers = watchers
+	return nil
+}
+
+func (m *MemoryStore) FindSubscriptions(flightIDs ...string) ([]TrackedFlight, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found []TrackedFlight
+	for _, f := range m.flights {
+		for _, id := range flightIDs {
+			if f.FlightID == id {
+				found = append(found, f)
+			}
+		}
+	}
+	sortLatestFirst(found)
+	return found, nil
+}
+
+func (m *MemoryStore) SaveSnapshot(s Snapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.snapshots) - 1; i >= 0; i-- {
+		previous := m.snapshots[i]
+		if previous.FlightID != s.FlightID || previous.DateDeparture != s.DateDeparture || previous.LegID != s.LegID {
+			continue
+		}
+		if sameDetail(previous.Detail, s.Detail) {
+			return nil
+		}
+		break
+	}
+	m.snapshots = append(m.snapshots, s)
+	return nil
+}
+
+func (m *MemoryStore) PruneSnapshots(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var kept []Snapshot
+	for _, s := range m.snapshots {
+		if !s.ObservedAt.Before(before) {
+			kept = append(kept, s)
+		}
+	}
+	pruned := int64(len(m.snapshots) - len(kept))
+	m.snapshots = kept
+	return pruned, nil
+}
+
+func (m *MemoryStore) ListSnapshots(flightID string) ([]Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var snapshots []Snapshot
+	for _, s := range m.snapshots {
+		if s.FlightID == flightID {
+			snapshots = append(snapshots, s)
+		}
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].ObservedAt.Before(snapshots[j].ObservedAt)
+	})
+	return snapshots, nil
+}
+
+func (m *MemoryStore) ClaimNotification(n Notification) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, existing := range m.notifications {
+		if existing.Key != n.Key {
+			continue
+		}
+		if existing.Result != NotificationFailed {
+			return false, nil
+		}
+		existing.Result = NotificationPending
+		existing.Error = ""
+		existing.Payload = n.Payload
+		existing.CreatedAt = n.CreatedAt
+		m.notifications[i] = existing
+		return true, nil
+	}
+
+	n.Result = NotificationPending
+	m.notifications = append(m.notifications, n)
+	return true, nil
+}
+
+func (m *MemoryStore) FinishNotification(n Notification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, existing := range m.notifications {
+		if existing.Key == n.Key {
+			existing.Result = n.Result
+			existing.Error = n.Error
+			existing.SlackTS = n.SlackTS
+			existing.Payload = n.Payload
+			existing.SentAt = n.SentAt
+			m.notifications[i] = existing
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) ListNotifications(flightID string) ([]Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var notifications []Notification
+	for _, n := range m.notifications {
+		if n.FlightID == flightID {
+			notifications = append(notifications, n)
+		}
+	}
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.Before(notifications[j].CreatedAt)
+	})
+	return notifications, nil
+}
+
+func (m *MemoryStore) SaveHistory(h FlightHistory) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.history[h.FlightID+"/"+h.DateDeparture.String()] = h
+	return nil
+}
+
+func (m *MemoryStore) ListHistory(since dates.Date, flightIDs ...string) ([]FlightHistory, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var history []FlightHistory
+	for _, h := range m.history {
+		for _, id := range flightIDs {
+			if h.FlightID == id && !h.DateDeparture.Before(since) {
+				history = append(history, h)
+			}
+		}
+	}
+	sortHistory(history)
+	return history, nil
+}
+
+var (
+	_ Store = (*SQLStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
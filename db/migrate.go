@@ -0,0 +1,214 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// Migration is one numbered file from db/migrations/<dialect>. Files are
+// named NNNN_description.sql and applied in order, each in its own
+// transaction. Both dialects share version numbers, a change gets the same
+// number in each directory.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+func Migrations(dialect Dialect) ([]Migration, error) {
+	dir := path.Join("migrations", string(dialect))
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		number, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: name must look like NNNN_description.sql", entry.Name())
+		}
+		version, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		body, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, SQL: string(body)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// SchemaVersion returns the highest applied migration, adopting databases
+// created before migrations existed on the way.
+func SchemaVersion(db *sql.DB, dialect Dialect) (int, error) {
+	if err := ensureVersionTable(db); err != nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	if err := db.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	if version.Valid {
+		return int(version.Int64), nil
+	}
+
+	if dialect != SQLite {
+		// PostgreSQL support came after migrations, there is nothing to adopt
+		return 0, nil
+	}
+	return adoptLegacySchema(db)
+}
+
+// PendingMigrations lists the migrations that Migrate would apply.
+func PendingMigrations(db *sql.DB, dialect Dialect) ([]Migration, error) {
+	current, err := SchemaVersion(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies every pending migration and returns the ones it applied.
+func Migrate(db *sql.DB, dialect Dialect) ([]Migration, error) {
+	pending, err := PendingMigrations(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range pending {
+		if err := applyMigration(db, dialect, m); err != nil {
+			return applied, fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+func applyMigration(db *sql.DB, dialect Dialect, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return err
+	}
+	if err := recordVersion(tx, dialect, m.Version, m.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func ensureVersionTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)
+	`)
+	return err
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func recordVersion(tx execer, dialect Dialect, version int, name string) error {
+	_, err := tx.Exec(dialect.rebind("INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)"),
+		version, name, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// Before migrations, initDB created tables and added columns on startup. Work
+// out how far such a database got and record those migrations as applied.
+// Those databases were all SQLite.
+func adoptLegacySchema(db *sql.DB) (int, error) {
+	markers := []struct {
+		version int
+		present func() (bool, error)
+	}{
+		{1, func() (bool, error) { return hasTable(db, "tracked_flights") }},
+		{2, func() (bool, error) { return hasColumn(db, "tracked_flights", "notified_inbound_late") }},
+		{3, func() (bool, error) { return hasColumn(db, "tracked_flights", "target_kind") }},
+		{4, func() (bool, error) { return hasTable(db, "flight_snapshots") }},
+	}
+
+	migrations, err := Migrations(SQLite)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for _, marker := range markers {
+		ok, err := marker.present()
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		version = marker.version
+	}
+
+	for _, m := range migrations {
+		if m.Version > version {
+			break
+		}
+		if err := recordVersion(db, SQLite, m.Version, m.Name); err != nil {
+			return 0, err
+		}
+	}
+	if version > 0 {
+		fmt.Printf("Adopted existing database at schema version %d\n", version)
+	}
+	return version, nil
+}
+
+func hasTable(db *sql.DB, table string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&count)
+	return count > 0, err
+}
+
+func hasColumn(db *sql.DB, table string, column string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	return count > 0, err
+}
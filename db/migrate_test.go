@@ -0,0 +1,125 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// legacyDatabase creates a SQLite database the way initDB used to, with
+// the schema of the first version migrations and no schema_version table,
+// and one flight tracked in a channel.
+func legacyDatabase(t *testing.T, version int) *sql.DB {
+	t.Helper()
+	database, _, err := Open(filepath.Join(t.TempDir(), "flights.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	migrations, err := Migrations(SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations[:version] {
+		if _, err := database.Exec(m.SQL); err != nil {
+			t.Fatalf("legacy schema %s: %v", m.Name, err)
+		}
+	}
+
+	// departures were UTC timestamps back then
+	_, err = database.Exec(`
+	INSERT INTO tracked_flights (flight_id, date_departure, channel_id, last_status, notified_pre_departure, notified_takeoff, last_cruise_notif, notified_landing)
+	VALUES ('AFR6', '2030-01-02 07:25:00+00:00', 'C0123456789', 'scheduled', 1, 1, '2030-01-02T09:00:00Z', 0)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+func TestAdoptLegacySchema(t *testing.T) {
+	migrations, err := Migrations(SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := migrations[len(migrations)-1].Version
+
+	// the columns and tables initDB added over time
+	for _, adopted := range []int{1, 2, 3, 4} {
+		database := legacyDatabase(t, adopted)
+
+		version, err := SchemaVersion(database, SQLite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != adopted {
+			t.Errorf("legacy schema %d: SchemaVersion = %d, want %d", adopted, version, adopted)
+		}
+
+		applied, err := Migrate(database, SQLite)
+		if err != nil {
+			t.Fatalf("legacy schema %d: %v", adopted, err)
+		}
+		if len(applied) != latest-adopted || applied[0].Version != adopted+1 {
+			t.Errorf("legacy schema %d: applied %d migrations from %d, want %d from %d", adopted, len(applied), applied[0].Version, latest-adopted, adopted+1)
+		}
+		if version, err := SchemaVersion(database, SQLite); err != nil || version != latest {
+			t.Errorf("legacy schema %d: SchemaVersion after Migrate = %d, %v, want %d", adopted, version, err, latest)
+		}
+
+		flights, err := NewSQLStore(database, SQLite).ListFlights()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(flights) != 1 {
+			t.Fatalf("legacy schema %d: %d flights after Migrate, want 1", adopted, len(flights))
+		}
+		got := flights[0]
+		want := TrackedFlight{
+			FlightID:             "AFR6",
+			DateDeparture:        testDeparture,
+			Kind:                 "flight",
+			Subscriber:           ChannelSubscriber("C0123456789"),
+			NotifiedPreDeparture: true,
+			NotifiedTakeoff:      true,
+			LastCruiseNotif:      time.Date(2030, time.January, 2, 9, 0, 0, 0, time.UTC),
+			CreatedIn:            "C0123456789",
+		}
+		if !got.LastCruiseNotif.Equal(want.LastCruiseNotif) {
+			t.Errorf("legacy schema %d: last cruise notification = %v, want %v", adopted, got.LastCruiseNotif, want.LastCruiseNotif)
+		}
+		got.LastCruiseNotif = want.LastCruiseNotif
+		if got != want {
+			t.Errorf("legacy schema %d: migrated flight = %+v, want %+v", adopted, got, want)
+		}
+	}
+}
+
+func TestSchemaVersionEmptyDatabase(t *testing.T) {
+	database, _, err := Open(filepath.Join(t.TempDir(), "flights.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	if version, err := SchemaVersion(database, SQLite); err != nil || version != 0 {
+		t.Errorf("SchemaVersion of an empty database = %d, %v, want 0", version, err)
+	}
+	migrations, err := Migrations(SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := Migrate(database, SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("Migrate applied %d migrations, want all %d", len(applied), len(migrations))
+	}
+	// nothing left, and nothing adopted twice
+	if applied, err := Migrate(database, SQLite); err != nil || len(applied) != 0 {
+		t.Errorf("second Migrate applied %d, %v, want none", len(applied), err)
+	}
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS tracked_flights (
+	flight_id TEXT NOT NULL,
+	date_departure TIMESTAMPTZ NOT NULL,
+	channel_id TEXT NOT NULL,
+	last_status TEXT,
+	notified_pre_departure BOOLEAN DEFAULT FALSE,
+	notified_takeoff BOOLEAN DEFAULT FALSE,
+	last_cruise_notif TIMESTAMPTZ,
+	notified_landing BOOLEAN DEFAULT FALSE,
+	PRIMARY KEY (flight_id, date_departure)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE flight_snapshots (
+	id BIGSERIAL PRIMARY KEY,
+	flight_id TEXT NOT NULL,
+	date_departure TIMESTAMPTZ NOT NULL,
+	leg_id TEXT NOT NULL DEFAULT '',
+	observed_at TIMESTAMPTZ NOT NULL,
+	provider TEXT NOT NULL,
+	flight_status TEXT,
+	data BYTEA NOT NULL
+);
+
+CREATE INDEX idx_flight_snapshots_flight ON flight_snapshots (flight_id, observed_at);
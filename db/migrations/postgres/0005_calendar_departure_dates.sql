@@ -0,0 +1,9 @@
+-- date_departure becomes a plain calendar date (YYYY-MM-DD) local to the
+-- origin airport. Older rows held a UTC timestamp, keep its day.
+ALTER TABLE tracked_flights
+	ALTER COLUMN date_departure TYPE TEXT
+	USING to_char(date_departure AT TIME ZONE 'UTC', 'YYYY-MM-DD');
+
+ALTER TABLE flight_snapshots
+	ALTER COLUMN date_departure TYPE TEXT
+	USING to_char(date_departure AT TIME ZONE 'UTC', 'YYYY-MM-DD');
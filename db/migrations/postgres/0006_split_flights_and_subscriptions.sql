@@ -0,0 +1,38 @@
+-- A flight instance can be followed by several channels and users. Flights
+-- hold what is shared, subscriptions each subscriber's notification state.
+CREATE TABLE flights (
+	flight_id TEXT NOT NULL,
+	date_departure TEXT NOT NULL,
+	target_kind TEXT NOT NULL DEFAULT 'flight',
+	PRIMARY KEY (flight_id, date_departure)
+);
+
+CREATE TABLE subscriptions (
+	flight_id TEXT NOT NULL,
+	date_departure TEXT NOT NULL,
+	subscriber_kind TEXT NOT NULL,
+	subscriber_id TEXT NOT NULL,
+	current_leg TEXT NOT NULL DEFAULT '',
+	notified_pre_departure BOOLEAN NOT NULL DEFAULT FALSE,
+	notified_takeoff BOOLEAN NOT NULL DEFAULT FALSE,
+	last_cruise_notif TIMESTAMPTZ,
+	notified_landing BOOLEAN NOT NULL DEFAULT FALSE,
+	notified_inbound_late BOOLEAN NOT NULL DEFAULT FALSE,
+	PRIMARY KEY (flight_id, date_departure, subscriber_kind, subscriber_id),
+	FOREIGN KEY (flight_id, date_departure) REFERENCES flights (flight_id, date_departure)
+);
+
+INSERT INTO flights (flight_id, date_departure, target_kind)
+SELECT flight_id, date_departure, target_kind FROM tracked_flights;
+
+INSERT INTO subscriptions (
+	flight_id, date_departure, subscriber_kind, subscriber_id, current_leg,
+	notified_pre_departure, notified_takeoff, last_cruise_notif, notified_landing, notified_inbound_late
+)
+SELECT
+	flight_id, date_departure, 'channel', channel_id, current_leg,
+	COALESCE(notified_pre_departure, FALSE), COALESCE(notified_takeoff, FALSE), last_cruise_notif,
+	COALESCE(notified_landing, FALSE), COALESCE(notified_inbound_late, FALSE)
+FROM tracked_flights;
+
+DROP TABLE tracked_flights;
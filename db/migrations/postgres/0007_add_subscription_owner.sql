@@ -0,0 +1,7 @@
+-- who ran /track and where. Older subscriptions have no known creator, only
+-- their channel and admins can untrack them.
+ALTER TABLE subscriptions ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE subscriptions ADD COLUMN created_in TEXT NOT NULL DEFAULT '';
+ALTER TABLE subscriptions ADD COLUMN created_at TIMESTAMPTZ;
+
+UPDATE subscriptions SET created_in = subscriber_id WHERE subscriber_kind = 'channel';
@@ -0,0 +1,21 @@
+-- completed flights, kept after they stop being tracked. Times are the
+-- scheduled and actual OOOI events: out of the gate, off the runway, on the
+-- runway, in at the gate.
+CREATE TABLE flight_history (
+	flight_id TEXT NOT NULL,
+	date_departure TEXT NOT NULL,
+	origin TEXT NOT NULL DEFAULT '',
+	destination TEXT NOT NULL DEFAULT '',
+	cancelled BOOLEAN NOT NULL DEFAULT FALSE,
+	diverted BOOLEAN NOT NULL DEFAULT FALSE,
+	out_scheduled TIMESTAMPTZ,
+	out_actual TIMESTAMPTZ,
+	off_scheduled TIMESTAMPTZ,
+	off_actual TIMESTAMPTZ,
+	on_scheduled TIMESTAMPTZ,
+	on_actual TIMESTAMPTZ,
+	in_scheduled TIMESTAMPTZ,
+	in_actual TIMESTAMPTZ,
+	recorded_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (flight_id, date_departure)
+);
@@ -0,0 +1,21 @@
+-- several tracked flights travelled as one itinerary, so connections
+-- between consecutive legs can be watched
+CREATE TABLE trips (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	subscriber_kind TEXT NOT NULL,
+	subscriber_id TEXT NOT NULL,
+	created_by TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL
+);
+
+-- connection_state is the last known state of the connection from the
+-- previous leg onto this one: '', ok, tight or impossible
+CREATE TABLE trip_legs (
+	trip_id BIGINT NOT NULL REFERENCES trips (id),
+	position INTEGER NOT NULL,
+	flight_id TEXT NOT NULL,
+	date_departure TEXT NOT NULL,
+	connection_state TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (trip_id, position)
+);
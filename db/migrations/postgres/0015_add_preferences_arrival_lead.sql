@@ -0,0 +1,3 @@
+-- how long before arrival the pre-arrival notification comes, apart from
+-- lead_time which is only for the pre-departure one
+ALTER TABLE preferences ADD COLUMN arrival_lead TEXT;
@@ -0,0 +1,2 @@
+-- snapshots are pruned by age
+CREATE INDEX idx_flight_snapshots_observed ON flight_snapshots (observed_at);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS tracked_flights (
+	flight_id TEXT NOT NULL,
+	date_departure TIMESTAMP NOT NULL,
+	channel_id TEXT NOT NULL,
+	last_status TEXT,
+	notified_pre_departure BOOLEAN DEFAULT 0,
+	notified_takeoff BOOLEAN DEFAULT 0,
+	last_cruise_notif TIMESTAMP,
+	notified_landing BOOLEAN DEFAULT 0,
+	PRIMARY KEY (flight_id, date_departure)
+);
@@ -0,0 +1 @@
+ALTER TABLE tracked_flights ADD COLUMN notified_inbound_late BOOLEAN DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE tracked_flights ADD COLUMN target_kind TEXT NOT NULL DEFAULT 'flight';
+ALTER TABLE tracked_flights ADD COLUMN current_leg TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+CREATE TABLE flight_snapshots (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	flight_id TEXT NOT NULL,
+	date_departure TIMESTAMP NOT NULL,
+	leg_id TEXT NOT NULL DEFAULT '',
+	observed_at TIMESTAMP NOT NULL,
+	provider TEXT NOT NULL,
+	flight_status TEXT,
+	data BLOB NOT NULL
+);
+
+CREATE INDEX idx_flight_snapshots_flight ON flight_snapshots (flight_id, observed_at);
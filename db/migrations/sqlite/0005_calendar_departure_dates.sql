@@ -0,0 +1,30 @@
+-- date_departure becomes a plain calendar date (YYYY-MM-DD) local to the
+-- origin airport. Older rows held a UTC timestamp, keep its day.
+CREATE TABLE tracked_flights_new (
+	flight_id TEXT NOT NULL,
+	date_departure TEXT NOT NULL,
+	channel_id TEXT NOT NULL,
+	last_status TEXT,
+	notified_pre_departure BOOLEAN DEFAULT 0,
+	notified_takeoff BOOLEAN DEFAULT 0,
+	last_cruise_notif TIMESTAMP,
+	notified_landing BOOLEAN DEFAULT 0,
+	notified_inbound_late BOOLEAN DEFAULT 0,
+	target_kind TEXT NOT NULL DEFAULT 'flight',
+	current_leg TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (flight_id, date_departure)
+);
+
+INSERT OR IGNORE INTO tracked_flights_new (
+	flight_id, date_departure, channel_id, last_status, notified_pre_departure, notified_takeoff,
+	last_cruise_notif, notified_landing, notified_inbound_late, target_kind, current_leg
+)
+SELECT
+	flight_id, substr(date_departure, 1, 10), channel_id, last_status, notified_pre_departure, notified_takeoff,
+	last_cruise_notif, notified_landing, notified_inbound_late, target_kind, current_leg
+FROM tracked_flights;
+
+DROP TABLE tracked_flights;
+ALTER TABLE tracked_flights_new RENAME TO tracked_flights;
+
+UPDATE flight_snapshots SET date_departure = substr(date_departure, 1, 10);
@@ -0,0 +1,38 @@
+-- A flight instance can be followed by several channels and users. Flights
+-- hold what is shared, subscriptions each subscriber's notification state.
+CREATE TABLE flights (
+	flight_id TEXT NOT NULL,
+	date_departure TEXT NOT NULL,
+	target_kind TEXT NOT NULL DEFAULT 'flight',
+	PRIMARY KEY (flight_id, date_departure)
+);
+
+CREATE TABLE subscriptions (
+	flight_id TEXT NOT NULL,
+	date_departure TEXT NOT NULL,
+	subscriber_kind TEXT NOT NULL,
+	subscriber_id TEXT NOT NULL,
+	current_leg TEXT NOT NULL DEFAULT '',
+	notified_pre_departure BOOLEAN NOT NULL DEFAULT 0,
+	notified_takeoff BOOLEAN NOT NULL DEFAULT 0,
+	last_cruise_notif TIMESTAMP,
+	notified_landing BOOLEAN NOT NULL DEFAULT 0,
+	notified_inbound_late BOOLEAN NOT NULL DEFAULT 0,
+	PRIMARY KEY (flight_id, date_departure, subscriber_kind, subscriber_id),
+	FOREIGN KEY (flight_id, date_departure) REFERENCES flights (flight_id, date_departure)
+);
+
+INSERT INTO flights (flight_id, date_departure, target_kind)
+SELECT flight_id, date_departure, target_kind FROM tracked_flights;
+
+INSERT INTO subscriptions (
+	flight_id, date_departure, subscriber_kind, subscriber_id, current_leg,
+	notified_pre_departure, notified_takeoff, last_cruise_notif, notified_landing, notified_inbound_late
+)
+SELECT
+	flight_id, date_departure, 'channel', channel_id, current_leg,
+	COALESCE(notified_pre_departure, 0), COALESCE(notified_takeoff, 0), last_cruise_notif,
+	COALESCE(notified_landing, 0), COALESCE(notified_inbound_late, 0)
+FROM tracked_flights;
+
+DROP TABLE tracked_flights;
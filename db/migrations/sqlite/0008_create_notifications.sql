@@ -0,0 +1,19 @@
+-- every notification the poller sends, keyed so the same event is never
+-- sent twice to a subscriber
+CREATE TABLE notifications (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	idempotency_key TEXT NOT NULL UNIQUE,
+	flight_id TEXT NOT NULL,
+	date_departure TEXT NOT NULL,
+	subscriber_kind TEXT NOT NULL,
+	subscriber_id TEXT NOT NULL,
+	event TEXT NOT NULL,
+	payload TEXT NOT NULL DEFAULT '',
+	result TEXT NOT NULL,
+	error TEXT NOT NULL DEFAULT '',
+	slack_ts TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	sent_at TIMESTAMP
+);
+
+CREATE INDEX idx_notifications_flight ON notifications (flight_id, date_departure);
@@ -0,0 +1,21 @@
+-- completed flights, kept after they stop being tracked. Times are the
+-- scheduled and actual OOOI events: out of the gate, off the runway, on the
+-- runway, in at the gate.
+CREATE TABLE flight_history (
+	flight_id TEXT NOT NULL,
+	date_departure TEXT NOT NULL,
+	origin TEXT NOT NULL DEFAULT '',
+	destination TEXT NOT NULL DEFAULT '',
+	cancelled BOOLEAN NOT NULL DEFAULT 0,
+	diverted BOOLEAN NOT NULL DEFAULT 0,
+	out_scheduled TIMESTAMP,
+	out_actual TIMESTAMP,
+	off_scheduled TIMESTAMP,
+	off_actual TIMESTAMP,
+	on_scheduled TIMESTAMP,
+	on_actual TIMESTAMP,
+	in_scheduled TIMESTAMP,
+	in_actual TIMESTAMP,
+	recorded_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (flight_id, date_departure)
+);
@@ -0,0 +1,17 @@
+-- which notifications a subscriber wants, for all its flights (empty
+-- flight_id and date_departure) or one tracked departure. Values are
+-- spelled like the /flight prefs options, NULL falls back to the level
+-- above.
+CREATE TABLE preferences (
+	subscriber_kind TEXT NOT NULL,
+	subscriber_id TEXT NOT NULL,
+	flight_id TEXT NOT NULL DEFAULT '',
+	date_departure TEXT NOT NULL DEFAULT '',
+	notify TEXT,
+	lead_time TEXT,
+	cruise TEXT,
+	maps TEXT,
+	quiet TEXT,
+	updated_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (subscriber_kind, subscriber_id, flight_id, date_departure)
+);
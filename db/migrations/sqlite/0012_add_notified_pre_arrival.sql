@@ -0,0 +1,3 @@
+-- the notification shortly before a flight lands, for whoever picks its
+-- passengers up
+ALTER TABLE subscriptions ADD COLUMN notified_pre_arrival BOOLEAN NOT NULL DEFAULT 0;
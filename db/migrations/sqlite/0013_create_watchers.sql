@@ -0,0 +1,12 @@
+-- users mentioned on a subscription's arrival notifications. They go with
+-- the subscription.
+CREATE TABLE watchers (
+	flight_id TEXT NOT NULL,
+	date_departure TEXT NOT NULL,
+	subscriber_kind TEXT NOT NULL,
+	subscriber_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	added_by TEXT NOT NULL DEFAULT '',
+	added_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (flight_id, date_departure, subscriber_kind, subscriber_id, user_id)
+);
@@ -0,0 +1,4 @@
+-- the language notifications and replies are in, like en or fr. Set for a
+-- channel or user, or for the whole workspace as subscriber_kind
+-- 'workspace'.
+ALTER TABLE preferences ADD COLUMN locale TEXT;
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"time"
+
+	"flight-tracker-slack/dates"
+)
+
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+// Notification is one message the poller sent, or tried to send, to a
+// subscriber. Key identifies the event: a second notification with the same
+// key is never sent.
+type Notification struct {
+	Key           string
+	FlightID      string
+	DateDeparture dates.Date
+	Subscriber    Subscriber
+	Event         string
+	Payload       string
+	Result        string
+	Error         string
+	SlackTS       string
+	CreatedAt     time.Time
+	SentAt        time.Time
+}
+
+func (store *SQLStore) ClaimNotification(n Notification) (bool, error) {
+	res, err := store.exec(`
+	INSERT INTO notifications (
+		idempotency_key,
+		flight_id,
+		date_departure,
+		subscriber_kind,
+		subscriber_id,
+		event,
+		payload,
+		result,
+		created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT DO NOTHING
+	`,
+		n.Key,
+		n.FlightID,
+		encodeDate(n.DateDeparture),
+		n.Subscriber.Kind,
+		n.Subscriber.ID,
+		n.Event,
+		n.Payload,
+		NotificationPending,
+		encodeTime(n.CreatedAt),
+	)
+	if err != nil {
+		return false, err
+	}
+	if inserted, err := res.RowsAffected(); err != nil || inserted > 0 {
+		return inserted > 0, err
+	}
+
+	// a failed delivery can be tried again
+	res, err = store.exec(`
+	UPDATE notifications
+	SET result = ?, error = '', payload = ?, created_at = ?
+	WHERE idempotency_key = ? AND result = ?
+	`, NotificationPending, n.Payload, encodeTime(n.CreatedAt), n.Key, NotificationFailed)
+	if err != nil {
+		return false, err
+	}
+	retried, err := res.RowsAffected()
+	return retried > 0, err
+}
+
+func (store *SQLStore) FinishNotification(n Notification) error {
+	_, err := store.exec(`
+	UPDATE notifications
+	SET result = ?, error = ?, slack_ts = ?, payload = ?, sent_at = ?
+	WHERE idempotency_key = ?
+	`, n.Result, n.Error, n.SlackTS, n.Payload, encodeTime(n.SentAt), n.Key)
+	return err
+}
+
+// ListNotifications returns every notification recorded for a flight,
+// oldest first.
+func (store *SQLStore) ListNotifications(flightID string) ([]Notification, error) {
+	rows, err := store.query(`
+	SELECT idempotency_key, flight_id, date_departure, subscriber_kind, subscriber_id, event, payload, result, error, slack_ts, created_at, sent_at
+	FROM notifications
+	WHERE flight_id = ?
+	ORDER BY created_at, id
+	`, flightID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		var departure, created, sent any
+		err := rows.Scan(&n.Key, &n.FlightID, &departure, &n.Subscriber.Kind, &n.Subscriber.ID, &n.Event, &n.Payload, &n.Result, &n.Error, &n.SlackTS, &created, &sent)
+		if err != nil {
+			return nil, err
+		}
+		if n.DateDeparture, err = decodeDate(departure); err != nil {
+			return nil, err
+		}
+		if n.CreatedAt, err = decodeTime(created); err != nil {
+			return nil, err
+		}
+		if n.SentAt, err = decodeTime(sent); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
@@ -0,0 +1,560 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"flight-tracker-slack/dates"
+	"flight-tracker-slack/i18n"
+)
+
+// the events a subscriber can turn on or off, named like the notifications
+// in the audit log
+const (
+	EventPreDeparture = "pre_departure"
+	EventTakeoff      = "takeoff"
+	EventCruise       = "cruise"
+	EventPreArrival   = "pre_arrival"
+	EventLanding      = "landing"
+	EventInboundLate  = "inbound_late"
+	EventConnection   = "connection"
+)
+
+var Events = []string{EventPreDeparture, EventTakeoff, EventCruise, EventPreArrival, EventLanding, EventInboundLate, EventConnection}
+
+// DefaultEvents are sent unless a subscriber picks its own. Pre-arrival
+// only matters to someone waiting at the airport, it is on by default for
+// subscriptions with watchers, see Watched.
+var DefaultEvents = []string{EventPreDeparture, EventTakeoff, EventCruise, EventLanding, EventInboundLate, EventConnection}
+
+var eventAliases = map[string]string{
+	"departure":   EventPreDeparture,
+	"arrival":     EventPreArrival,
+	"inbound":     EventInboundLate,
+	"connections": EventConnection,
+}
+
+// PreferenceOptions are the settings of Preferences by name, as /flight
+// prefs, the database and exports spell them.
+var PreferenceOptions = []string{"notify", "lead", "arrival-lead", "cruise", "maps", "quiet", "locale"}
+
+// Preferences are what a subscriber wants to hear about, for all its
+// flights when FlightID is empty or for one tracked departure. Nil fields
+// aren't set at that level: flight preferences fall back to the
+// subscriber's, those to the workspace's, and those to DefaultPreferences.
+type Preferences struct {
+	Subscriber    Subscriber
+	FlightID      string
+	DateDeparture dates.Date
+
+	// Events are the notifications to send, empty sends none
+	Events []string
+	// PreDeparture and PreArrival are how long before departure and arrival
+	// the pre-departure and pre-arrival notifications come
+	PreDeparture *time.Duration
+	PreArrival   *time.Duration
+	// CruiseEvery is the time between cruise updates, 0 sends them at a
+	// quarter, half and three quarters of the flight instead
+	CruiseEvery *time.Duration
+	Maps        *bool
+	Quiet       *QuietHours
+	// Locale is the language messages are in
+	Locale *i18n.Locale
+
+	UpdatedAt time.Time
+
+	// set by ResolvePreferences when no level picked the events
+	defaultEvents bool
+}
+
+// QuietHours is a time of day notifications wait out, like 22:00-07:00.
+// Start and End are since midnight in TZ, equal ones mean no quiet hours.
+type QuietHours struct {
+	Start time.Duration
+	End   time.Duration
+	TZ    string
+}
+
+func DefaultPreferences() Preferences {
+	preDeparture := 30 * time.Minute
+	preArrival := 30 * time.Minute
+	cruiseEvery := 2 * time.Hour
+	maps := true
+	locale := i18n.Default
+	return Preferences{
+		Events:       append([]string(nil), DefaultEvents...),
+		PreDeparture: &preDeparture,
+		PreArrival:   &preArrival,
+		CruiseEvery:  &cruiseEvery,
+		Maps:         &maps,
+		Quiet:        &QuietHours{},
+		Locale:       &locale,
+		// until a level sets Events
+		defaultEvents: true,
+	}
+}
+
+// ResolvePreferences is what applies to a subscription: the defaults, then
+// the workspace's preferences, its subscriber's, and the ones for this
+// flight.
+func ResolvePreferences(all []Preferences, f TrackedFlight) Preferences {
+	resolved := DefaultPreferences()
+	for _, level := range []TrackedFlight{{Subscriber: Workspace}, {Subscriber: f.Subscriber}, f} {
+		if p, ok := FindPreferences(all, level.Subscriber, level.FlightID, level.DateDeparture); ok {
+			resolved = resolved.With(p)
+		}
+	}
+	resolved.Subscriber = f.Subscriber
+	resolved.FlightID = f.FlightID
+	resolved.DateDeparture = f.DateDeparture
+	return resolved
+}
+
+// Watched is the resolved preferences of a subscription that has watchers:
+// pre-arrival is turned on unless the subscriber picked its own events.
+func (p Preferences) Watched() Preferences {
+	if !p.defaultEvents || p.Notifies(EventPreArrival) {
+		return p
+	}
+	events := map[string]bool{EventPreArrival: true}
+	for _, e := range p.Events {
+		events[e] = true
+	}
+	p.Events = nil
+	for _, e := range Events {
+		if events[e] {
+			p.Events = append(p.Events, e)
+		}
+	}
+	return p
+}
+
+// With is p with the fields set in o replacing its own.
+func (p Preferences) With(o Preferences) Preferences {
+	if o.Events != nil {
+		p.Events = o.Events
+		p.defaultEvents = false
+	}
+	if o.PreDeparture != nil {
+		p.PreDeparture = o.PreDeparture
+	}
+	if o.PreArrival != nil {
+		p.PreArrival = o.PreArrival
+	}
+	if o.CruiseEvery != nil {
+		p.CruiseEvery = o.CruiseEvery
+	}
+	if o.Maps != nil {
+		p.Maps = o.Maps
+	}
+	if o.Quiet != nil {
+		p.Quiet = o.Quiet
+	}
+	if o.Locale != nil {
+		p.Locale = o.Locale
+	}
+	return p
+}
+
+func (p Preferences) IsEmpty() bool {
+	return p.Events == nil && p.PreDeparture == nil && p.PreArrival == nil && p.CruiseEvery == nil && p.Maps == nil && p.Quiet == nil && p.Locale == nil
+}
+
+func (p Preferences) Notifies(event string) bool {
+	if p.Events == nil {
+		return true
+	}
+	for _, e := range p.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// IsQuiet reports whether notifications should wait at t.
+func (p Preferences) IsQuiet(t time.Time) bool {
+	return p.Quiet != nil && p.Quiet.Contains(t)
+}
+
+func (q QuietHours) IsZero() bool {
+	return q.Start == q.End
+}
+
+func (q QuietHours) Contains(t time.Time) bool {
+	if q.IsZero() {
+		return false
+	}
+	loc, err := time.LoadLocation(q.TZ)
+	if err != nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	since := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if q.Start < q.End {
+		return since >= q.Start && since < q.End
+	}
+	// over midnight
+	return since >= q.Start || since < q.End
+}
+
+// Get is the value of an option as Set reads it back, empty when the
+// option isn't set at this level.
+func (p Preferences) Get(name string) string {
+	switch name {
+	case "notify":
+		if p.Events == nil {
+			return ""
+		}
+		if len(p.Events) == 0 {
+			return "none"
+		}
+		if len(p.Events) == len(Events) {
+			return "all"
+		}
+		return strings.Join(p.Events, ",")
+	case "lead":
+		if p.PreDeparture == nil {
+			return ""
+		}
+		return formatMinutes(*p.PreDeparture)
+	case "arrival-lead":
+		if p.PreArrival == nil {
+			return ""
+		}
+		return formatMinutes(*p.PreArrival)
+	case "cruise":
+		if p.CruiseEvery == nil {
+			return ""
+		}
+		if *p.CruiseEvery == 0 {
+			return "milestones"
+		}
+		return formatMinutes(*p.CruiseEvery)
+	case "maps":
+		if p.Maps == nil {
+			return ""
+		}
+		if *p.Maps {
+			return "on"
+		}
+		return "off"
+	case "quiet":
+		if p.Quiet == nil {
+			return ""
+		}
+		if p.Quiet.IsZero() {
+			return "off"
+		}
+		return fmt.Sprintf("%s-%s %s", formatClock(p.Quiet.Start), formatClock(p.Quiet.End), p.Quiet.TZ)
+	case "locale":
+		if p.Locale == nil {
+			return ""
+		}
+		return string(*p.Locale)
+	}
+	return ""
+}
+
+// Set reads an option:
+//
+//	notify        all, none or a comma-separated list of Events
+//	lead          minutes before departure, like 45 or 1h
+//	arrival-lead  minutes before arrival, like 45 or 1h
+//	cruise        time between cruise updates, like 90m, or milestones
+//	maps          on or off
+//	quiet         22:00-07:00 with an optional time zone name (UTC), or off
+//	locale        en or fr, see i18n.Parse
+//
+// An empty value unsets the option at this level.
+func (p *Preferences) Set(name string, value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		switch name {
+		case "notify":
+			p.Events = nil
+		case "lead":
+			p.PreDeparture = nil
+		case "arrival-lead":
+			p.PreArrival = nil
+		case "cruise":
+			p.CruiseEvery = nil
+		case "maps":
+			p.Maps = nil
+		case "quiet":
+			p.Quiet = nil
+		case "locale":
+			p.Locale = nil
+		default:
+			return i18n.Errorf("error.preference", name)
+		}
+		return nil
+	}
+
+	switch name {
+	case "notify":
+		events, err := parseEvents(value)
+		if err != nil {
+			return err
+		}
+		p.Events = events
+	case "lead":
+		d, err := parseLead(value)
+		if err != nil {
+			return i18n.Errorf("error.lead", value)
+		}
+		p.PreDeparture = &d
+	case "arrival-lead":
+		d, err := parseLead(value)
+		if err != nil {
+			return i18n.Errorf("error.arrival_lead", value)
+		}
+		p.PreArrival = &d
+	case "cruise":
+		var d time.Duration
+		if strings.ToLower(value) != "milestones" {
+			var err error
+			d, err = parseMinutes(value)
+			if err != nil || d < 15*time.Minute {
+				return i18n.Errorf("error.cruise", value)
+			}
+		}
+		p.CruiseEvery = &d
+	case "maps":
+		var on bool
+		switch strings.ToLower(value) {
+		case "on", "yes", "true":
+			on = true
+		case "off", "no", "false":
+		default:
+			return i18n.Errorf("error.maps", value)
+		}
+		p.Maps = &on
+	case "quiet":
+		quiet, err := parseQuietHours(value)
+		if err != nil {
+			return err
+		}
+		p.Quiet = &quiet
+	case "locale":
+		locale, err := i18n.Parse(value)
+		if err != nil {
+			return err
+		}
+		p.Locale = &locale
+	default:
+		return i18n.Errorf("error.preference", name)
+	}
+	return nil
+}
+
+func parseEvents(value string) ([]string, error) {
+	switch strings.ToLower(value) {
+	case "all":
+		return append([]string(nil), Events...), nil
+	case "none":
+		return []string{}, nil
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range strings.Split(strings.ToLower(value), ",") {
+		name = strings.TrimSpace(name)
+		if alias, ok := eventAliases[name]; ok {
+			name = alias
+		}
+		known := false
+		for _, e := range Events {
+			known = known || e == name
+		}
+		if !known {
+			return nil, i18n.Errorf("error.event", name, strings.Join(Events, ", "))
+		}
+		wanted[name] = true
+	}
+
+	// keep Events' order, so equal sets read back the same
+	events := []string{}
+	for _, e := range Events {
+		if wanted[e] {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func parseMinutes(value string) (time.Duration, error) {
+	if minutes, err := strconv.Atoi(value); err == nil {
+		return time.Duration(minutes) * time.Minute, nil
+	}
+	d, err := time.ParseDuration(value)
+	return d.Truncate(time.Minute), err
+}
+
+// parseLead reads a lead time, at most a day.
+func parseLead(value string) (time.Duration, error) {
+	d, err := parseMinutes(value)
+	if err == nil && (d <= 0 || d > 24*time.Hour) {
+		err = fmt.Errorf("lead time out of range: %s", d)
+	}
+	return d, err
+}
+
+func formatMinutes(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
+
+func parseQuietHours(value string) (QuietHours, error) {
+	if strings.ToLower(value) == "off" {
+		return QuietHours{}, nil
+	}
+
+	hours, tz, _ := strings.Cut(value, " ")
+	start, end, ok := strings.Cut(hours, "-")
+	q := QuietHours{TZ: strings.TrimSpace(tz)}
+	if q.TZ == "" {
+		q.TZ = "UTC"
+	}
+	var startErr, endErr error
+	q.Start, startErr = parseClock(start)
+	q.End, endErr = parseClock(end)
+	if !ok || startErr != nil || endErr != nil {
+		return QuietHours{}, i18n.Errorf("error.quiet", value)
+	}
+	if _, err := time.LoadLocation(q.TZ); err != nil {
+		return QuietHours{}, i18n.Errorf("error.time_zone", q.TZ)
+	}
+	return q, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", d/time.Hour, d%time.Hour/time.Minute)
+}
+
+func (s *SQLStore) SavePreferences(p Preferences) error {
+	values := make([]any, len(PreferenceOptions))
+	for i, name := range PreferenceOptions {
+		if v := p.Get(name); v != "" {
+			values[i] = v
+		}
+	}
+
+	_, err := s.exec(`
+	INSERT INTO preferences (subscriber_kind, subscriber_id, flight_id, date_departure,
+		notify, lead_time, arrival_lead, cruise, maps, quiet, locale, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (subscriber_kind, subscriber_id, flight_id, date_departure) DO UPDATE SET
+		notify = excluded.notify,
+		lead_time = excluded.lead_time,
+		arrival_lead = excluded.arrival_lead,
+		cruise = excluded.cruise,
+		maps = excluded.maps,
+		quiet = excluded.quiet,
+		locale = excluded.locale,
+		updated_at = excluded.updated_at
+	`, p.Subscriber.Kind, p.Subscriber.ID, p.FlightID, encodeDate(p.DateDeparture),
+		values[0], values[1], values[2], values[3], values[4], values[5], values[6], encodeTime(p.UpdatedAt))
+	return err
+}
+
+func (s *SQLStore) ListPreferences() ([]Preferences, error) {
+	rows, err := s.query(`
+	SELECT subscriber_kind, subscriber_id, flight_id, date_departure,
+		notify, lead_time, arrival_lead, cruise, maps, quiet, locale, updated_at
+	FROM preferences
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []Preferences
+	for rows.Next() {
+		var p Preferences
+		var departure, updated any
+		values := make([]sql.NullString, len(PreferenceOptions))
+		err := rows.Scan(&p.Subscriber.Kind, &p.Subscriber.ID, &p.FlightID, &departure,
+			&values[0], &values[1], &values[2], &values[3], &values[4], &values[5], &values[6], &updated)
+		if err != nil {
+			return nil, err
+		}
+		if p.DateDeparture, err = decodeDate(departure); err != nil {
+			return nil, err
+		}
+		if p.UpdatedAt, err = decodeTime(updated); err != nil {
+			return nil, err
+		}
+		for i, name := range PreferenceOptions {
+			if err := p.Set(name, values[i].String); err != nil {
+				return nil, fmt.Errorf("preferences of %s: %w", p.Subscriber.Mention(), err)
+			}
+		}
+		all = append(all, p)
+	}
+	return all, rows.Err()
+}
+
+func (m *MemoryStore) SavePreferences(p Preferences) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p.UpdatedAt = p.UpdatedAt.UTC().Truncate(time.Second)
+	m.preferences[preferencesKeyOf(p)] = p
+	return nil
+}
+
+func (m *MemoryStore) ListPreferences() ([]Preferences, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := make([]Preferences, 0, len(m.preferences))
+	for _, p := range m.preferences {
+		all = append(all, p)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		if a.Subscriber != b.Subscriber {
+			return a.Subscriber.Mention() < b.Subscriber.Mention()
+		}
+		if a.FlightID != b.FlightID {
+			return a.FlightID < b.FlightID
+		}
+		return a.DateDeparture.Before(b.DateDeparture)
+	})
+	return all, nil
+}
+
+type preferencesKey struct {
+	subscriber Subscriber
+	flightID   string
+	departure  dates.Date
+}
+
+func preferencesKeyOf(p Preferences) preferencesKey {
+	return preferencesKey{subscriber: p.Subscriber, flightID: p.FlightID, departure: p.DateDeparture}
+}
+
+// FindPreferences picks the preferences set at exactly one level, flightID
+// empty for the subscriber's own.
+func FindPreferences(all []Preferences, subscriber Subscriber, flightID string, departure dates.Date) (Preferences, bool) {
+	for _, p := range all {
+		if p.Subscriber == subscriber && p.FlightID == flightID && p.DateDeparture == departure {
+			return p, true
+		}
+	}
+	return Preferences{Subscriber: subscriber, FlightID: flightID, DateDeparture: departure}, false
+}
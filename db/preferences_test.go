@@ -0,0 +1,185 @@
+package db
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLeadTimes(t *testing.T) {
+	var p Preferences
+	if err := p.Set("lead", "8h"); err != nil {
+		t.Fatal(err)
+	}
+	resolved := ResolvePreferences([]Preferences{p}, TrackedFlight{})
+	if *resolved.PreDeparture != 8*time.Hour || *resolved.PreArrival != 30*time.Minute {
+		t.Errorf("lead=8h resolved to %v before departure and %v before arrival, want 8h and 30m", *resolved.PreDeparture, *resolved.PreArrival)
+	}
+
+	if err := p.Set("arrival-lead", "45"); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Get("lead") + " " + p.Get("arrival-lead"); got != "8h 45m" {
+		t.Errorf("leads read back as %q", got)
+	}
+	if err := p.Set("arrival-lead", "25h"); err == nil {
+		t.Error("arrival-lead over a day accepted")
+	}
+}
+
+func TestWatched(t *testing.T) {
+	f := TrackedFlight{FlightID: "AFR6", DateDeparture: testDeparture, Subscriber: ChannelSubscriber("CTEAM")}
+
+	defaults := ResolvePreferences(nil, f)
+	if defaults.Notifies(EventPreArrival) {
+		t.Error("pre-arrival on by default without watchers")
+	}
+	watched := defaults.Watched()
+	if !watched.Notifies(EventPreArrival) || !slices.Equal(watched.Events, Events) {
+		t.Errorf("watched events = %v, want all of %v", watched.Events, Events)
+	}
+	if defaults.Notifies(EventPreArrival) {
+		t.Error("Watched changed the preferences it was called on")
+	}
+
+	// events picked at any level are left alone
+	chosen := Preferences{Subscriber: f.Subscriber}
+	if err := chosen.Set("notify", "takeoff,landing"); err != nil {
+		t.Fatal(err)
+	}
+	if got := ResolvePreferences([]Preferences{chosen}, f).Watched(); got.Notifies(EventPreArrival) {
+		t.Errorf("watched events = %v, want only the chosen ones", got.Events)
+	}
+}
+
+func TestSetPreferences(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        string
+		wantErr     bool
+	}{
+		{"notify", "all", "all", false},
+		{"notify", "none", "none", false},
+		{"notify", "Landing, departure,takeoff", "pre_departure,takeoff,landing", false},
+		{"notify", "arrival,inbound,connections", "pre_arrival,inbound_late,connection", false},
+		{"notify", "takeoff,boarding", "", true},
+		{"lead", "45", "45m", false},
+		{"lead", "1h", "1h", false},
+		{"lead", "0", "", true},
+		{"cruise", "90m", "90m", false},
+		{"cruise", "Milestones", "milestones", false},
+		{"cruise", "10m", "", true},
+		{"maps", "off", "off", false},
+		{"maps", "yes", "on", false},
+		{"maps", "sometimes", "", true},
+		{"quiet", "22:00-07:00 Europe/Paris", "22:00-07:00 Europe/Paris", false},
+		{"quiet", "22:00-07:00", "22:00-07:00 UTC", false},
+		{"quiet", "off", "off", false},
+		{"quiet", "22:00-07:00 Mars/Olympus", "", true},
+		{"quiet", "late", "", true},
+		{"locale", "fr", "fr", false},
+		{"colour", "blue", "", true},
+	}
+	for _, tt := range tests {
+		var p Preferences
+		err := p.Set(tt.name, tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Set(%s, %q) error = %v, want error %v", tt.name, tt.value, err, tt.wantErr)
+			continue
+		}
+		if got := p.Get(tt.name); got != tt.want {
+			t.Errorf("Set(%s, %q) reads back as %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+		if err == nil {
+			// an empty value unsets it again
+			if err := p.Set(tt.name, ""); err != nil || !p.IsEmpty() {
+				t.Errorf("unsetting %s = %v, left %+v", tt.name, err, p)
+			}
+		}
+	}
+}
+
+func TestResolvePreferences(t *testing.T) {
+	channel := ChannelSubscriber("CTEAM")
+	f := TrackedFlight{FlightID: "AFR6", DateDeparture: testDeparture, Subscriber: channel}
+	set := func(p Preferences, options ...string) Preferences {
+		t.Helper()
+		for i := 0; i < len(options); i += 2 {
+			if err := p.Set(options[i], options[i+1]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return p
+	}
+	all := []Preferences{
+		set(Preferences{Subscriber: Workspace}, "cruise", "3h", "locale", "fr", "maps", "off"),
+		set(Preferences{Subscriber: channel}, "cruise", "milestones", "notify", "takeoff,landing"),
+		set(Preferences{Subscriber: channel, FlightID: "AFR6", DateDeparture: testDeparture}, "notify", "none"),
+		// another day's flight and another channel don't apply
+		set(Preferences{Subscriber: channel, FlightID: "AFR6", DateDeparture: testDeparture.AddDays(1)}, "maps", "on"),
+		set(Preferences{Subscriber: ChannelSubscriber("COTHER")}, "lead", "2h"),
+	}
+
+	got := ResolvePreferences(all, f)
+	want := map[string]string{
+		"notify": "none",       // flight
+		"cruise": "milestones", // channel over workspace
+		"locale": "fr",         // workspace
+		"maps":   "off",        // workspace
+		"lead":   "30m",        // default
+		"quiet":  "off",        // default
+	}
+	for name, value := range want {
+		if got.Get(name) != value {
+			t.Errorf("%s = %q, want %q", name, got.Get(name), value)
+		}
+	}
+	if got.Subscriber != channel || got.FlightID != "AFR6" || got.DateDeparture != testDeparture {
+		t.Errorf("resolved for %+v", got)
+	}
+
+	// the channel's other flights only get the channel's own
+	other := ResolvePreferences(all, TrackedFlight{FlightID: "DLH400", DateDeparture: testDeparture, Subscriber: channel})
+	if other.Get("notify") != "takeoff,landing" {
+		t.Errorf("notify for another flight = %q", other.Get("notify"))
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(hour, minute int) time.Time {
+		return time.Date(2030, time.January, 2, hour, minute, 0, 0, paris)
+	}
+	overnight := QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour, TZ: "Europe/Paris"}
+	lunch := QuietHours{Start: 12 * time.Hour, End: 13*time.Hour + 30*time.Minute, TZ: "Europe/Paris"}
+
+	tests := []struct {
+		quiet QuietHours
+		t     time.Time
+		want  bool
+	}{
+		{overnight, at(21, 59), false},
+		{overnight, at(22, 0), true},
+		{overnight, at(23, 59), true},
+		{overnight, at(0, 0), true},
+		{overnight, at(6, 59), true},
+		{overnight, at(7, 0), false},
+		{overnight, at(12, 0), false},
+		// 21:30 UTC is 22:30 in Paris
+		{overnight, time.Date(2030, time.January, 2, 21, 30, 0, 0, time.UTC), true},
+		{lunch, at(11, 59), false},
+		{lunch, at(12, 0), true},
+		{lunch, at(13, 29), true},
+		{lunch, at(13, 30), false},
+		{lunch, at(0, 0), false},
+		{QuietHours{}, at(3, 0), false},
+	}
+	for _, tt := range tests {
+		if got := tt.quiet.Contains(tt.t); got != tt.want {
+			t.Errorf("%s-%s contains %s = %v, want %v", formatClock(tt.quiet.Start), formatClock(tt.quiet.End), tt.t.In(paris).Format("15:04"), got, tt.want)
+		}
+	}
+}
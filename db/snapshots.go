@@ -0,0 +1,150 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"flight-tracker-slack/dates"
+	structs "flight-tracker-slack/types"
+)
+
+// Snapshot is one poll's view of a flight, kept so we can see afterwards
+// exactly what the bot based its notifications on.
+type Snapshot struct {
+	FlightID      string
+	DateDeparture dates.Date
+	LegID         string
+	ObservedAt    time.Time
+	Provider      string
+	Detail        structs.FlightDetail
+}
+
+func (store *SQLStore) SaveSnapshot(s Snapshot) error {
+	blob, err := compressDetail(s.Detail)
+	if err != nil {
+		return err
+	}
+
+	var previous []byte
+	err = store.queryRow(`
+	SELECT data
+	FROM flight_snapshots
+	WHERE flight_id = ? AND date_departure = ? AND leg_id = ?
+	ORDER BY observed_at DESC, id DESC
+	LIMIT 1
+	`, s.FlightID, encodeDate(s.DateDeparture), s.LegID).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if bytes.Equal(previous, blob) {
+		return nil
+	}
+
+	query := `
+	INSERT INTO flight_snapshots (
+		flight_id,
+		date_departure,
+		leg_id,
+		observed_at,
+		provider,
+		flight_status,
+		data
+	) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = store.exec(query,
+		s.FlightID,
+		encodeDate(s.DateDeparture),
+		s.LegID,
+		encodeTime(s.ObservedAt),
+		s.Provider,
+		s.Detail.FlightStatus,
+		blob,
+	)
+	return err
+}
+
+// PruneSnapshots deletes the snapshots observed before a time and returns
+// how many it deleted.
+func (store *SQLStore) PruneSnapshots(before time.Time) (int64, error) {
+	result, err := store.exec("DELETE FROM flight_snapshots WHERE observed_at < ?", encodeTime(before))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ListSnapshots returns every snapshot recorded for a flight, oldest first.
+func (store *SQLStore) ListSnapshots(flightID string) ([]Snapshot, error) {
+	rows, err := store.query(`
+	SELECT flight_id, date_departure, leg_id, observed_at, provider, data
+	FROM flight_snapshots
+	WHERE flight_id = ?
+	ORDER BY observed_at, id
+	`, flightID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []Snapshot
+	for rows.Next() {
+		var s Snapshot
+		var departure, observed any
+		var blob []byte
+		if err := rows.Scan(&s.FlightID, &departure, &s.LegID, &observed, &s.Provider, &blob); err != nil {
+			return nil, err
+		}
+		if s.DateDeparture, err = decodeDate(departure); err != nil {
+			return nil, err
+		}
+		if s.ObservedAt, err = decodeTime(observed); err != nil {
+			return nil, err
+		}
+		if s.Detail, err = decompressDetail(blob); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
+
+func compressDetail(detail structs.FlightDetail) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(detail); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sameDetail compares details the way they are stored.
+func sameDetail(a, b structs.FlightDetail) bool {
+	blobA, errA := compressDetail(a)
+	blobB, errB := compressDetail(b)
+	return errA == nil && errB == nil && bytes.Equal(blobA, blobB)
+}
+
+func decompressDetail(blob []byte) (structs.FlightDetail, error) {
+	var detail structs.FlightDetail
+	zr, err := gzip.NewReader(bytes.NewReader(blob))
+	if err != nil {
+		return detail, err
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return detail, err
+	}
+	err = json.Unmarshal(data, &detail)
+	return detail, err
+}
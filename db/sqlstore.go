@@ -0,0 +1,195 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// SQLStore is the Store backed by the bot's SQLite or PostgreSQL database.
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func NewSQLStore(db *sql.DB, dialect Dialect) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+func (s *SQLStore) exec(query string, args ...any) (sql.Result, error) {
+	return s.db.Exec(s.dialect.rebind(query), args...)
+}
+
+func (s *SQLStore) query(query string, args ...any) (*sql.Rows, error) {
+	return s.db.Query(s.dialect.rebind(query), args...)
+}
+
+func (s *SQLStore) queryRow(query string, args ...any) *sql.Row {
+	return s.db.QueryRow(s.dialect.rebind(query), args...)
+}
+
+const flightColumns = `f.flight_id, f.date_departure, f.target_kind, s.subscriber_kind, s.subscriber_id, s.current_leg, s.notified_pre_departure, s.notified_takeoff, s.last_cruise_notif, s.notified_landing, s.notified_inbound_late, s.notified_pre_arrival, s.created_by, s.created_in, s.created_at`
+
+const flightTables = `subscriptions s JOIN flights f ON f.flight_id = s.flight_id AND f.date_departure = s.date_departure`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanFlight(row scanner) (TrackedFlight, error) {
+	var f TrackedFlight
+	var departure, lastCruise, createdAt any
+	err := row.Scan(&f.FlightID, &departure, &f.Kind, &f.Subscriber.Kind, &f.Subscriber.ID, &f.CurrentLeg, &f.NotifiedPreDeparture, &f.NotifiedTakeoff, &lastCruise, &f.NotifiedLanding, &f.NotifiedInboundLate, &f.NotifiedPreArrival, &f.CreatedBy, &f.CreatedIn, &createdAt)
+	if err != nil {
+		return f, err
+	}
+	if f.DateDeparture, err = decodeDate(departure); err != nil {
+		return f, err
+	}
+	if f.LastCruiseNotif, err = decodeTime(lastCruise); err != nil {
+		return f, err
+	}
+	if f.CreatedAt, err = decodeTime(createdAt); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+func (s *SQLStore) AddFlight(f TrackedFlight) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(s.dialect.rebind(`
+	INSERT INTO flights (flight_id, date_departure, target_kind)
+	VALUES (?, ?, ?)
+	ON CONFLICT DO NOTHING
+	`), f.FlightID, encodeDate(f.DateDeparture), f.Kind)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := tx.Exec(s.dialect.rebind(`
+	INSERT INTO subscriptions (flight_id, date_departure, subscriber_kind, subscriber_id, created_by, created_in, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT DO NOTHING
+	`), f.FlightID, encodeDate(f.DateDeparture), f.Subscriber.Kind, f.Subscriber.ID, f.CreatedBy, f.CreatedIn, encodeTime(f.CreatedAt))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, tx.Commit()
+}
+
+func (s *SQLStore) ListFlights() ([]TrackedFlight, error) {
+	rows, err := s.query("SELECT " + flightColumns + " FROM " + flightTables + " ORDER BY f.date_departure, f.flight_id, s.subscriber_kind, s.subscriber_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flights []TrackedFlight
+	for rows.Next() {
+		f, err := scanFlight(rows)
+		if err != nil {
+			return nil, err
+		}
+		flights = append(flights, f)
+	}
+	return flights, rows.Err()
+}
+
+func (s *SQLStore) SaveFlightState(f TrackedFlight) error {
+	_, err := s.exec(`
+	UPDATE subscriptions
+	SET notified_pre_departure = ?,
+		notified_takeoff = ?,
+		last_cruise_notif = ?,
+		notified_landing = ?,
+		notified_inbound_late = ?,
+		notified_pre_arrival = ?,
+		current_leg = ?
+	WHERE flight_id = ? AND date_departure = ? AND subscriber_kind = ? AND subscriber_id = ?
+	`,
+		f.NotifiedPreDeparture,
+		f.NotifiedTakeoff,
+		encodeTime(f.LastCruiseNotif),
+		f.NotifiedLanding,
+		f.NotifiedInboundLate,
+		f.NotifiedPreArrival,
+		f.CurrentLeg,
+		f.FlightID,
+		encodeDate(f.DateDeparture),
+		f.Subscriber.Kind,
+		f.Subscriber.ID,
+	)
+	return err
+}
+
+func (s *SQLStore) Unsubscribe(f TrackedFlight) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(s.dialect.rebind(`
+	DELETE FROM subscriptions
+	WHERE flight_id = ? AND date_departure = ? AND subscriber_kind = ? AND subscriber_id = ?
+	`), f.FlightID, encodeDate(f.DateDeparture), f.Subscriber.Kind, f.Subscriber.ID)
+	if err != nil {
+		return err
+	}
+
+	// preferences set for this flight and its watchers go with the
+	// subscription
+	for _, table := range []string{"preferences", "watchers"} {
+		_, err = tx.Exec(s.dialect.rebind(`
+		DELETE FROM `+table+`
+		WHERE flight_id = ? AND date_departure = ? AND subscriber_kind = ? AND subscriber_id = ?
+		`), f.FlightID, encodeDate(f.DateDeparture), f.Subscriber.Kind, f.Subscriber.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(s.dialect.rebind(`
+	DELETE FROM flights
+	WHERE flight_id = ? AND date_departure = ?
+	AND NOT EXISTS (
+		SELECT 1 FROM subscriptions s
+		WHERE s.flight_id = flights.flight_id AND s.date_departure = flights.date_departure
+	)
+	`), f.FlightID, encodeDate(f.DateDeparture))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) FindSubscriptions(flightIDs ...string) ([]TrackedFlight, error) {
+	var found []TrackedFlight
+	for _, id := range flightIDs {
+		rows, err := s.query("SELECT "+flightColumns+" FROM "+flightTables+" WHERE f.flight_id = ?", id)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			f, err := scanFlight(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			found = append(found, f)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	sortLatestFirst(found)
+	return found, nil
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestPostgresStore runs the Store suite against the PostgreSQL server at
+// TEST_POSTGRES_URL. Every test migrates a schema of its own and drops it
+// afterwards, so nothing outside it is read or written.
+func TestPostgresStore(t *testing.T) {
+	base := os.Getenv("TEST_POSTGRES_URL")
+	if base == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	admin, dialect, err := Open(base)
+	if err != nil || dialect != Postgres {
+		t.Skipf("TEST_POSTGRES_URL is not a PostgreSQL URL: %v", err)
+	}
+	defer admin.Close()
+	if err := admin.Ping(); err != nil {
+		t.Skipf("PostgreSQL unreachable: %v", err)
+	}
+
+	runStoreTests(t, func(t *testing.T) Store {
+		return openTestStore(t, scratchSchema(t, admin, base))
+	})
+}
+
+// scratchSchema creates an empty schema and returns base with its
+// search_path pointing there.
+func scratchSchema(t *testing.T, admin *sql.DB, base string) string {
+	t.Helper()
+	schema := fmt.Sprintf("flight_bot_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("dropping %s: %v", schema, err)
+		}
+	})
+
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
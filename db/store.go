@@ -0,0 +1,184 @@
+package db
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"flight-tracker-slack/dates"
+	"flight-tracker-slack/flightcode"
+)
+
+var ErrNotTracked = errors.New("flight is not tracked")
+
+type SubscriberKind string
+
+const (
+	SubscriberChannel SubscriberKind = "channel"
+	SubscriberUser    SubscriberKind = "user"
+	// only preferences are set for the whole workspace
+	SubscriberWorkspace SubscriberKind = "workspace"
+)
+
+// Subscriber is a channel or a user following a flight. Updates for a user
+// go to the bot's DM with them, see slack.ChannelOf.
+type Subscriber struct {
+	Kind SubscriberKind
+	ID   string
+}
+
+func ChannelSubscriber(channelID string) Subscriber {
+	return Subscriber{Kind: SubscriberChannel, ID: channelID}
+}
+
+func UserSubscriber(userID string) Subscriber {
+	return Subscriber{Kind: SubscriberUser, ID: userID}
+}
+
+// Workspace is where the preferences of every channel and user start from.
+var Workspace = Subscriber{Kind: SubscriberWorkspace}
+
+// Mention formats the subscriber for a Slack message.
+func (s Subscriber) Mention() string {
+	switch s.Kind {
+	case SubscriberUser:
+		return "<@" + s.ID + ">"
+	case SubscriberWorkspace:
+		return "the workspace"
+	}
+	return "<#" + s.ID + ">"
+}
+
+// TrackedFlight is one subscriber's view of a tracked flight: the flight
+// itself and what that subscriber has been told about it so far.
+type TrackedFlight struct {
+	FlightID             string     `db:"flight_id"`
+	DateDeparture        dates.Date `db:"date_departure"`
+	Kind                 string     `db:"target_kind"`
+	Subscriber           Subscriber
+	CurrentLeg           string    `db:"current_leg"`
+	NotifiedPreDeparture bool      `db:"notified_pre_departure"`
+	NotifiedTakeoff      bool      `db:"notified_takeoff"`
+	LastCruiseNotif      time.Time `db:"last_cruise_notif"`
+	NotifiedLanding      bool      `db:"notified_landing"`
+	NotifiedInboundLate  bool      `db:"notified_inbound_late"`
+	NotifiedPreArrival   bool      `db:"notified_pre_arrival"`
+	// the Slack user who ran /track and the channel they ran it in
+	CreatedBy string    `db:"created_by"`
+	CreatedIn string    `db:"created_in"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func (f TrackedFlight) IsAircraft() bool {
+	return flightcode.Target{Kind: flightcode.Kind(f.Kind)}.IsAircraft()
+}
+
+// SameFlight reports whether two subscriptions follow the same flight.
+func (f TrackedFlight) SameFlight(other TrackedFlight) bool {
+	return f.FlightID == other.FlightID && f.DateDeparture == other.DateDeparture
+}
+
+// GroupByFlight splits ListFlights' subscriptions into one slice per flight.
+func GroupByFlight(flights []TrackedFlight) [][]TrackedFlight {
+	var groups [][]TrackedFlight
+	for _, f := range flights {
+		if n := len(groups); n > 0 && groups[n-1][0].SameFlight(f) {
+			groups[n-1] = append(groups[n-1], f)
+			continue
+		}
+		groups = append(groups, []TrackedFlight{f})
+	}
+	return groups
+}
+
+// sortLatestFirst orders subscriptions by departure, latest first, keeping
+// the result stable for a given set.
+func sortLatestFirst(flights []TrackedFlight) {
+	sort.SliceStable(flights, func(i, j int) bool {
+		a, b := flights[i], flights[j]
+		if a.DateDeparture != b.DateDeparture {
+			return a.DateDeparture.After(b.DateDeparture)
+		}
+		if a.FlightID != b.FlightID {
+			return a.FlightID < b.FlightID
+		}
+		return a.Subscriber.ID < b.Subscriber.ID
+	})
+}
+
+// NewLeg is the state of an airframe's tracking once it starts another leg.
+func (f TrackedFlight) NewLeg(legID string) TrackedFlight {
+	return TrackedFlight{
+		FlightID:      f.FlightID,
+		DateDeparture: f.DateDeparture,
+		Kind:          f.Kind,
+		Subscriber:    f.Subscriber,
+		CurrentLeg:    legID,
+		CreatedBy:     f.CreatedBy,
+		CreatedIn:     f.CreatedIn,
+		CreatedAt:     f.CreatedAt,
+	}
+}
+
+// Store owns everything we persist about tracked flights. Flights are keyed
+// by (FlightID, DateDeparture), the departure being the calendar day at the
+// origin airport, and each has one subscription per channel or user
+// following it.
+type Store interface {
+	// AddFlight subscribes f.Subscriber to the flight, creating the flight if
+	// nobody tracked it yet. It reports false when that subscriber already
+	// follows it.
+	AddFlight(f TrackedFlight) (bool, error)
+	// ListFlights returns one TrackedFlight per subscription, ordered so the
+	// subscriptions of a flight are next to each other.
+	ListFlights() ([]TrackedFlight, error)
+	// SaveFlightState writes the notification state and current leg of an
+	// existing subscription.
+	SaveFlightState(f TrackedFlight) error
+	// Unsubscribe removes f.Subscriber from the flight, and the flight itself
+	// once nobody follows it anymore.
+	Unsubscribe(f TrackedFlight) error
+	// FindSubscriptions returns every subscription to flights tracked under
+	// any of the given idents, latest departure first.
+	FindSubscriptions(flightIDs ...string) ([]TrackedFlight, error)
+
+	// SaveSnapshot skips a snapshot identical to the previous one of the
+	// same flight and leg: a flight waiting at the gate looks the same poll
+	// after poll.
+	SaveSnapshot(s Snapshot) error
+	ListSnapshots(flightID string) ([]Snapshot, error)
+	// PruneSnapshots deletes the snapshots observed before a time and
+	// returns how many it deleted.
+	PruneSnapshots(before time.Time) (int64, error)
+
+	// ClaimNotification records a notification as pending before it is
+	// sent. It reports false when one with the same key was already sent or
+	// is being sent; failed ones can be claimed again.
+	ClaimNotification(n Notification) (bool, error)
+	// FinishNotification stores the outcome of a claimed notification.
+	FinishNotification(n Notification) error
+	ListNotifications(flightID string) ([]Notification, error)
+
+	// SaveHistory records a completed or cancelled flight, replacing an
+	// earlier record of the same flight.
+	SaveHistory(h FlightHistory) error
+	ListHistory(since dates.Date, flightIDs ...string) ([]FlightHistory, error)
+
+	// AddTrip stores a trip and returns it with its ID.
+	AddTrip(t Trip) (Trip, error)
+	ListTrips() ([]Trip, error)
+	SaveConnectionState(tripID int64, position int, state string) error
+	RemoveTrip(tripID int64) error
+
+	// SavePreferences replaces the preferences set at one level. Those of
+	// a flight are removed with its subscription.
+	SavePreferences(p Preferences) error
+	ListPreferences() ([]Preferences, error)
+
+	// AddWatcher and RemoveWatcher report false when the user already
+	// watches, or doesn't watch, the subscription. Watchers are removed
+	// with their subscription.
+	AddWatcher(w Watcher) (bool, error)
+	RemoveWatcher(w Watcher) (bool, error)
+	ListWatchers() ([]Watcher, error)
+}
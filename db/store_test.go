@@ -0,0 +1,488 @@
+package db
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"flight-tracker-slack/dates"
+	structs "flight-tracker-slack/types"
+)
+
+// storeTests is the behaviour every Store has to share. Each test gets an
+// empty store of its own.
+var storeTests = []struct {
+	name string
+	run  func(t *testing.T, store Store)
+}{
+	{"AddFlightDedup", testAddFlightDedup},
+	{"UnsubscribeCascade", testUnsubscribeCascade},
+	{"DateRoundTrip", testDateRoundTrip},
+	{"NotificationClaims", testNotificationClaims},
+	{"Snapshots", testSnapshots},
+	{"History", testHistory},
+	{"Trips", testTrips},
+	{"Preferences", testPreferences},
+	{"SubscriberKinds", testSubscriberKinds},
+	{"Watchers", testWatchers},
+}
+
+func runStoreTests(t *testing.T, newStore func(t *testing.T) Store) {
+	for _, tt := range storeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStore(t))
+		})
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) Store {
+		return NewMemoryStore()
+	})
+}
+
+func TestSQLiteStore(t *testing.T) {
+	runStoreTests(t, func(t *testing.T) Store {
+		return openTestStore(t, filepath.Join(t.TempDir(), "flights.db"))
+	})
+}
+
+func openTestStore(t *testing.T, url string) *SQLStore {
+	t.Helper()
+	database, dialect, err := Open(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := Migrate(database, dialect); err != nil {
+		t.Fatal(err)
+	}
+	return NewSQLStore(database, dialect)
+}
+
+var (
+	testDeparture = dates.Date{Year: 2030, Month: time.January, Day: 2}
+	testCreated   = time.Date(2030, time.January, 1, 12, 30, 0, 0, time.UTC)
+)
+
+func testFlight(subscriber Subscriber) TrackedFlight {
+	return TrackedFlight{
+		FlightID:      "AFR6",
+		DateDeparture: testDeparture,
+		Kind:          "flight",
+		Subscriber:    subscriber,
+		CreatedBy:     "UOWNER",
+		CreatedIn:     "CTEAM",
+		CreatedAt:     testCreated,
+	}
+}
+
+func mustAdd(t *testing.T, store Store, f TrackedFlight) {
+	t.Helper()
+	if added, err := store.AddFlight(f); err != nil || !added {
+		t.Fatalf("AddFlight(%s) = %v, %v, want true", f.Subscriber.ID, added, err)
+	}
+}
+
+func mustFind(t *testing.T, store Store, flightID string) []TrackedFlight {
+	t.Helper()
+	found, err := store.FindSubscriptions(flightID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func testAddFlightDedup(t *testing.T, store Store) {
+	channel := testFlight(ChannelSubscriber("CTEAM"))
+	user := testFlight(UserSubscriber("UOWNER"))
+
+	mustAdd(t, store, channel)
+	mustAdd(t, store, user)
+	if added, err := store.AddFlight(channel); err != nil || added {
+		t.Errorf("AddFlight twice = %v, %v, want false", added, err)
+	}
+
+	// the same flight number on another day is another flight
+	nextDay := channel
+	nextDay.DateDeparture = testDeparture.AddDays(1)
+	mustAdd(t, store, nextDay)
+
+	flights, err := store.ListFlights()
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := GroupByFlight(flights)
+	if len(groups) != 2 || len(groups[0]) != 2 || len(groups[1]) != 1 {
+		t.Fatalf("ListFlights grouped as %v, want 2 subscriptions then 1", groups)
+	}
+	if got := mustFind(t, store, "AFR6"); len(got) != 3 || got[0].DateDeparture != nextDay.DateDeparture {
+		t.Errorf("FindSubscriptions = %+v, want 3 with the latest departure first", got)
+	}
+}
+
+func testUnsubscribeCascade(t *testing.T, store Store) {
+	channel := testFlight(ChannelSubscriber("CTEAM"))
+	user := testFlight(UserSubscriber("UOWNER"))
+	mustAdd(t, store, channel)
+	mustAdd(t, store, user)
+
+	if err := store.Unsubscribe(channel); err != nil {
+		t.Fatal(err)
+	}
+	found := mustFind(t, store, "AFR6")
+	if len(found) != 1 || found[0].Subscriber != user.Subscriber {
+		t.Fatalf("after one Unsubscribe, FindSubscriptions = %+v, want only %s", found, user.Subscriber.ID)
+	}
+
+	if err := store.Unsubscribe(user); err != nil {
+		t.Fatal(err)
+	}
+	if found := mustFind(t, store, "AFR6"); len(found) != 0 {
+		t.Fatalf("after the last Unsubscribe, FindSubscriptions = %+v, want none", found)
+	}
+
+	// the flight went with its last subscription, so it starts afresh
+	mustAdd(t, store, channel)
+	if found := mustFind(t, store, "AFR6"); len(found) != 1 || found[0].NotifiedTakeoff {
+		t.Errorf("re-added flight = %+v", found)
+	}
+}
+
+func testDateRoundTrip(t *testing.T, store Store) {
+	// created late in the evening west of UTC: neither the departure day nor
+	// the instants may move
+	local := time.FixedZone("UTC-7", -7*60*60)
+	f := testFlight(ChannelSubscriber("CTEAM"))
+	f.DateDeparture = dates.Date{Year: 2030, Month: time.December, Day: 31}
+	f.CreatedAt = time.Date(2030, time.December, 31, 23, 15, 0, 0, local)
+	mustAdd(t, store, f)
+
+	state := f
+	state.NotifiedTakeoff = true
+	state.NotifiedPreArrival = true
+	state.CurrentLeg = "leg-2"
+	state.LastCruiseNotif = time.Date(2031, time.January, 1, 2, 45, 30, 0, local)
+	if err := store.SaveFlightState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	found := mustFind(t, store, "AFR6")
+	if len(found) != 1 {
+		t.Fatalf("FindSubscriptions = %d subscriptions, want 1", len(found))
+	}
+	got := found[0]
+	if got.DateDeparture != f.DateDeparture {
+		t.Errorf("DateDeparture = %s, want %s", got.DateDeparture, f.DateDeparture)
+	}
+	if !got.CreatedAt.Equal(f.CreatedAt) || !got.LastCruiseNotif.Equal(state.LastCruiseNotif) {
+		t.Errorf("times = %s, %s, want %s, %s", got.CreatedAt, got.LastCruiseNotif, f.CreatedAt, state.LastCruiseNotif)
+	}
+	if !got.NotifiedTakeoff || !got.NotifiedPreArrival || got.NotifiedLanding || got.CurrentLeg != "leg-2" {
+		t.Errorf("saved state not read back: %+v", got)
+	}
+	if got.CreatedBy != "UOWNER" || got.CreatedIn != "CTEAM" {
+		t.Errorf("owner not read back: %+v", got)
+	}
+}
+
+func testNotificationClaims(t *testing.T, store Store) {
+	n := Notification{
+		Key:           "AFR6/2030-01-02//channel:CTEAM/landing",
+		FlightID:      "AFR6",
+		DateDeparture: testDeparture,
+		Subscriber:    ChannelSubscriber("CTEAM"),
+		Event:         "landing",
+		Payload:       `{"channel":"CTEAM"}`,
+		CreatedAt:     testCreated,
+	}
+	claims := []struct {
+		result string
+		want   bool
+	}{
+		{"", true},
+		{NotificationPending, false},
+		{NotificationFailed, true},
+		{NotificationSent, false},
+	}
+	for _, c := range claims {
+		if c.result != "" && c.result != NotificationPending {
+			finished := n
+			finished.Result = c.result
+			finished.SlackTS = "1893600000.000100"
+			if err := store.FinishNotification(finished); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if claimed, err := store.ClaimNotification(n); err != nil || claimed != c.want {
+			t.Errorf("ClaimNotification when %q = %v, %v, want %v", c.result, claimed, err, c.want)
+		}
+	}
+
+	notifications, err := store.ListNotifications("AFR6")
+	if err != nil || len(notifications) != 1 {
+		t.Fatalf("ListNotifications = %d, %v, want 1", len(notifications), err)
+	}
+	if got := notifications[0]; got.Result != NotificationSent || got.SlackTS == "" || got.DateDeparture != testDeparture {
+		t.Errorf("notification not read back: %+v", got)
+	}
+}
+
+func testSnapshots(t *testing.T, store Store) {
+	snapshot := func(minutes int, status string) Snapshot {
+		return Snapshot{
+			FlightID:      "AFR6",
+			DateDeparture: testDeparture,
+			ObservedAt:    testCreated.Add(time.Duration(minutes) * time.Minute),
+			Provider:      "flightaware",
+			Detail:        structs.FlightDetail{FlightStatus: status},
+		}
+	}
+	// at the gate for two polls, then taxiing, then back at the gate
+	for _, s := range []Snapshot{
+		snapshot(0, "scheduled"),
+		snapshot(1, "scheduled"),
+		snapshot(2, "taxiing"),
+		snapshot(3, "scheduled"),
+	} {
+		if err := store.SaveSnapshot(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshots, err := store.ListSnapshots("AFR6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []string
+	for _, s := range snapshots {
+		statuses = append(statuses, s.Detail.FlightStatus)
+	}
+	if want := []string{"scheduled", "taxiing", "scheduled"}; !slices.Equal(statuses, want) {
+		t.Errorf("snapshots = %v, want %v", statuses, want)
+	}
+
+	pruned, err := store.PruneSnapshots(testCreated.Add(2 * time.Minute))
+	if err != nil || pruned != 1 {
+		t.Errorf("PruneSnapshots = %d, %v, want 1", pruned, err)
+	}
+	if snapshots, _ := store.ListSnapshots("AFR6"); len(snapshots) != 2 || !snapshots[0].ObservedAt.Equal(testCreated.Add(2*time.Minute)) {
+		t.Errorf("after pruning, snapshots = %+v", snapshots)
+	}
+}
+
+func testHistory(t *testing.T, store Store) {
+	h := FlightHistory{
+		FlightID:      "AFR6",
+		DateDeparture: testDeparture,
+		Origin:        "CDG",
+		Destination:   "JFK",
+		Out:           EventTimes{Scheduled: testCreated, Actual: testCreated.Add(12 * time.Minute)},
+		In:            EventTimes{Scheduled: testCreated.Add(8 * time.Hour)},
+		RecordedAt:    testCreated,
+	}
+	if err := store.SaveHistory(h); err != nil {
+		t.Fatal(err)
+	}
+	// a later poll saw it arrive
+	h.In.Actual = testCreated.Add(8*time.Hour + 5*time.Minute)
+	if err := store.SaveHistory(h); err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, err := store.ListHistory(testDeparture, "AFR6", "AF6")
+	if err != nil || len(recorded) != 1 {
+		t.Fatalf("ListHistory = %d, %v, want 1", len(recorded), err)
+	}
+	if delay, ok := recorded[0].In.Delay(); !ok || delay != 5*time.Minute || recorded[0].Origin != "CDG" {
+		t.Errorf("history not read back: %+v", recorded[0])
+	}
+	if _, ok := recorded[0].Off.Delay(); ok {
+		t.Errorf("takeoff delay known without takeoff times: %+v", recorded[0].Off)
+	}
+	if later, err := store.ListHistory(testDeparture.AddDays(1), "AFR6"); err != nil || len(later) != 0 {
+		t.Errorf("ListHistory after the departure = %d, %v, want 0", len(later), err)
+	}
+}
+
+func testTrips(t *testing.T, store Store) {
+	trip, err := store.AddTrip(Trip{
+		Name:       "New York",
+		Subscriber: ChannelSubscriber("CTEAM"),
+		CreatedBy:  "UOWNER",
+		CreatedAt:  testCreated,
+		Legs: []TripLeg{
+			{FlightID: "AFR1234", DateDeparture: testDeparture},
+			{FlightID: "AFR6", DateDeparture: testDeparture.AddDays(1)},
+		},
+	})
+	if err != nil || trip.ID == 0 {
+		t.Fatalf("AddTrip = %d, %v", trip.ID, err)
+	}
+	if err := store.SaveConnectionState(trip.ID, 1, ConnectionTight); err != nil {
+		t.Fatal(err)
+	}
+
+	trips, err := store.ListTrips()
+	if err != nil || len(trips) != 1 {
+		t.Fatalf("ListTrips = %d, %v, want 1", len(trips), err)
+	}
+	got := trips[0]
+	if len(got.Legs) != 2 || got.Legs[0].FlightID != "AFR1234" || got.Legs[1].Position != 1 {
+		t.Fatalf("legs = %+v", got.Legs)
+	}
+	if got.Legs[1].ConnectionState != ConnectionTight || got.Legs[0].ConnectionState != "" {
+		t.Errorf("connection states = %q, %q", got.Legs[0].ConnectionState, got.Legs[1].ConnectionState)
+	}
+	if got.Legs[1].DateDeparture != testDeparture.AddDays(1) || !got.CreatedAt.Equal(testCreated) || got.Name != "New York" {
+		t.Errorf("trip not read back: %+v", got)
+	}
+
+	if err := store.RemoveTrip(trip.ID); err != nil {
+		t.Fatal(err)
+	}
+	if trips, err := store.ListTrips(); err != nil || len(trips) != 0 {
+		t.Errorf("after RemoveTrip, ListTrips = %+v, %v", trips, err)
+	}
+}
+
+func testPreferences(t *testing.T, store Store) {
+	f := testFlight(ChannelSubscriber("CTEAM"))
+	mustAdd(t, store, f)
+
+	channel := Preferences{Subscriber: f.Subscriber, UpdatedAt: testCreated}
+	flight := Preferences{Subscriber: f.Subscriber, FlightID: f.FlightID, DateDeparture: f.DateDeparture, UpdatedAt: testCreated}
+	for _, set := range []struct {
+		p           *Preferences
+		name, value string
+	}{
+		{&channel, "notify", "takeoff,landing"},
+		{&channel, "quiet", "22:00-07:00 Europe/Paris"},
+		{&channel, "locale", "fr"},
+		{&flight, "notify", "none"},
+		{&flight, "cruise", "milestones"},
+		{&flight, "arrival-lead", "1h"},
+	} {
+		if err := set.p.Set(set.name, set.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []Preferences{channel, flight} {
+		if err := store.SavePreferences(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := store.ListPreferences()
+	if err != nil || len(all) != 2 {
+		t.Fatalf("ListPreferences = %d, %v, want 2", len(all), err)
+	}
+	for _, want := range []Preferences{channel, flight} {
+		got, ok := FindPreferences(all, want.Subscriber, want.FlightID, want.DateDeparture)
+		if !ok {
+			t.Fatalf("preferences of %s %s not found", want.FlightID, want.DateDeparture)
+		}
+		for _, name := range PreferenceOptions {
+			if got.Get(name) != want.Get(name) {
+				t.Errorf("%s of %q = %q, want %q", name, want.FlightID, got.Get(name), want.Get(name))
+			}
+		}
+	}
+
+	// the flight's preferences go with its subscription, the channel's stay
+	if err := store.Unsubscribe(f); err != nil {
+		t.Fatal(err)
+	}
+	all, err = store.ListPreferences()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := FindPreferences(all, f.Subscriber, f.FlightID, f.DateDeparture); ok {
+		t.Error("flight preferences left after Unsubscribe")
+	}
+	if _, ok := FindPreferences(all, f.Subscriber, "", channel.DateDeparture); !ok {
+		t.Error("channel preferences removed with a flight")
+	}
+}
+
+// a user's DM subscription and a channel never share a key, whatever
+// their IDs
+func testSubscriberKinds(t *testing.T, store Store) {
+	channel := testFlight(ChannelSubscriber("U0123"))
+	user := testFlight(UserSubscriber("U0123"))
+	mustAdd(t, store, channel)
+	mustAdd(t, store, user)
+
+	state := user
+	state.NotifiedTakeoff = true
+	if err := store.SaveFlightState(state); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range mustFind(t, store, "AFR6") {
+		if f.NotifiedTakeoff != (f.Subscriber.Kind == SubscriberUser) {
+			t.Errorf("state of %s %s = %+v", f.Subscriber.Kind, f.Subscriber.ID, f)
+		}
+	}
+
+	if err := store.Unsubscribe(user); err != nil {
+		t.Fatal(err)
+	}
+	if found := mustFind(t, store, "AFR6"); len(found) != 1 || found[0].Subscriber != channel.Subscriber {
+		t.Errorf("after the DM unsubscribed, FindSubscriptions = %+v", found)
+	}
+}
+
+func testWatchers(t *testing.T, store Store) {
+	f := testFlight(ChannelSubscriber("CTEAM"))
+	other := testFlight(UserSubscriber("UOWNER"))
+	mustAdd(t, store, f)
+	mustAdd(t, store, other)
+
+	watcher := func(user string) Watcher {
+		return Watcher{FlightID: f.FlightID, DateDeparture: f.DateDeparture, Subscriber: f.Subscriber, UserID: user, AddedBy: "UOWNER", AddedAt: testCreated}
+	}
+	for _, add := range []struct {
+		user string
+		want bool
+	}{
+		{"UWATCH1", true},
+		{"UWATCH2", true},
+		{"UWATCH1", false},
+		{"UWATCH3", true},
+	} {
+		if added, err := store.AddWatcher(watcher(add.user)); err != nil || added != add.want {
+			t.Errorf("AddWatcher(%s) = %v, %v, want %v", add.user, added, err, add.want)
+		}
+	}
+	for _, remove := range []struct {
+		user string
+		want bool
+	}{
+		{"UWATCH2", true},
+		{"UWATCH2", false},
+		{"UNOBODY", false},
+	} {
+		if removed, err := store.RemoveWatcher(watcher(remove.user)); err != nil || removed != remove.want {
+			t.Errorf("RemoveWatcher(%s) = %v, %v, want %v", remove.user, removed, err, remove.want)
+		}
+	}
+
+	watchers, err := store.ListWatchers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := WatchersOf(watchers, f); len(got) != 2 || got[0] != "UWATCH1" || got[1] != "UWATCH3" {
+		t.Errorf("WatchersOf = %v, want [UWATCH1 UWATCH3]", got)
+	}
+	if got := WatchersOf(watchers, other); len(got) != 0 {
+		t.Errorf("watchers of another subscription: %v", got)
+	}
+
+	if err := store.Unsubscribe(f); err != nil {
+		t.Fatal(err)
+	}
+	if watchers, err := store.ListWatchers(); err != nil || len(WatchersOf(watchers, f)) != 0 {
+		t.Errorf("watchers left after Unsubscribe: %v, %v", watchers, err)
+	}
+}
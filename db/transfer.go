@@ -0,0 +1,592 @@
+package db
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"flight-tracker-slack/dates"
+	"flight-tracker-slack/flightcode"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// version 2 added preferences, version 3 watchers and the pre-arrival
+// notification, version 4 locales and workspace preferences
+const exportVersion = 4
+
+// Export is a backup of everything tracked, in a form that can be moved to
+// another instance whatever database it runs on. Preferences set for a
+// flight travel with its subscription; those of a whole channel, user or
+// the workspace are rows without a flight_id in CSV exports.
+type Export struct {
+	Version       int                  `json:"version"`
+	ExportedAt    time.Time            `json:"exported_at"`
+	Subscriptions []SubscriptionRecord `json:"subscriptions"`
+	Preferences   []PreferencesRecord  `json:"preferences,omitempty"`
+}
+
+// SubscriptionRecord is one subscription with its flight, flattened so the
+// same fields work as JSON and as CSV columns. Dates are YYYY-MM-DD and
+// times RFC3339.
+type SubscriptionRecord struct {
+	FlightID             string `json:"flight_id"`
+	DateDeparture        string `json:"date_departure"`
+	TargetKind           string `json:"target_kind"`
+	SubscriberKind       string `json:"subscriber_kind"`
+	SubscriberID         string `json:"subscriber_id"`
+	CurrentLeg           string `json:"current_leg,omitempty"`
+	NotifiedPreDeparture bool   `json:"notified_pre_departure"`
+	NotifiedTakeoff      bool   `json:"notified_takeoff"`
+	LastCruiseNotif      string `json:"last_cruise_notif,omitempty"`
+	NotifiedLanding      bool   `json:"notified_landing"`
+	NotifiedInboundLate  bool   `json:"notified_inbound_late"`
+	NotifiedPreArrival   bool   `json:"notified_pre_arrival"`
+	CreatedBy            string `json:"created_by,omitempty"`
+	CreatedIn            string `json:"created_in,omitempty"`
+	CreatedAt            string `json:"created_at,omitempty"`
+
+	// preferences set for this flight, spelled like Preferences.Get
+	Notify      string `json:"notify,omitempty"`
+	Lead        string `json:"lead,omitempty"`
+	ArrivalLead string `json:"arrival_lead,omitempty"`
+	Cruise      string `json:"cruise,omitempty"`
+	Maps        string `json:"maps,omitempty"`
+	Quiet       string `json:"quiet,omitempty"`
+
+	// Slack user IDs mentioned on arrival, space separated in CSV
+	Watchers []string `json:"watchers,omitempty"`
+}
+
+// PreferencesRecord is the preferences of a subscriber for all its flights,
+// or of the workspace with subscriber_kind "workspace" and no ID.
+type PreferencesRecord struct {
+	SubscriberKind string `json:"subscriber_kind"`
+	SubscriberID   string `json:"subscriber_id"`
+	Notify         string `json:"notify,omitempty"`
+	Lead           string `json:"lead,omitempty"`
+	ArrivalLead    string `json:"arrival_lead,omitempty"`
+	Cruise         string `json:"cruise,omitempty"`
+	Maps           string `json:"maps,omitempty"`
+	Quiet          string `json:"quiet,omitempty"`
+	Locale         string `json:"locale,omitempty"`
+}
+
+var csvColumns = []string{
+	"flight_id",
+	"date_departure",
+	"target_kind",
+	"subscriber_kind",
+	"subscriber_id",
+	"current_leg",
+	"notified_pre_departure",
+	"notified_takeoff",
+	"last_cruise_notif",
+	"notified_landing",
+	"notified_inbound_late",
+	"notified_pre_arrival",
+	"created_by",
+	"created_in",
+	"created_at",
+	"notify",
+	"lead",
+	"arrival_lead",
+	"cruise",
+	"maps",
+	"quiet",
+	"watchers",
+	"locale",
+}
+
+func ExportStore(store Store, now time.Time) (Export, error) {
+	flights, err := store.ListFlights()
+	if err != nil {
+		return Export{}, err
+	}
+
+	preferences, err := store.ListPreferences()
+	if err != nil {
+		return Export{}, err
+	}
+
+	watchers, err := store.ListWatchers()
+	if err != nil {
+		return Export{}, err
+	}
+
+	export := Export{Version: exportVersion, ExportedAt: now.UTC(), Subscriptions: []SubscriptionRecord{}}
+	for _, f := range flights {
+		record := recordOf(f)
+		if p, ok := FindPreferences(preferences, f.Subscriber, f.FlightID, f.DateDeparture); ok {
+			record.Notify, record.Lead, record.ArrivalLead, record.Cruise, record.Maps, record.Quiet = p.Get("notify"), p.Get("lead"), p.Get("arrival-lead"), p.Get("cruise"), p.Get("maps"), p.Get("quiet")
+		}
+		record.Watchers = WatchersOf(watchers, f)
+		export.Subscriptions = append(export.Subscriptions, record)
+	}
+	for _, p := range preferences {
+		if p.FlightID != "" || p.IsEmpty() {
+			continue
+		}
+		export.Preferences = append(export.Preferences, PreferencesRecord{
+			SubscriberKind: string(p.Subscriber.Kind),
+			SubscriberID:   p.Subscriber.ID,
+			Notify:         p.Get("notify"),
+			Lead:           p.Get("lead"),
+			ArrivalLead:    p.Get("arrival-lead"),
+			Cruise:         p.Get("cruise"),
+			Maps:           p.Get("maps"),
+			Quiet:          p.Get("quiet"),
+			Locale:         p.Get("locale"),
+		})
+	}
+	return export, nil
+}
+
+// readPreferences validates preferences spelled like Preferences.Get.
+func readPreferences(p Preferences, values map[string]string) (Preferences, error) {
+	for _, name := range PreferenceOptions {
+		if err := p.Set(name, values[name]); err != nil {
+			return p, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return p, nil
+}
+
+func (r SubscriptionRecord) preferences(f TrackedFlight) (Preferences, error) {
+	return readPreferences(Preferences{Subscriber: f.Subscriber, FlightID: f.FlightID, DateDeparture: f.DateDeparture}, map[string]string{
+		"notify": r.Notify, "lead": r.Lead, "arrival-lead": r.ArrivalLead, "cruise": r.Cruise, "maps": r.Maps, "quiet": r.Quiet,
+	})
+}
+
+func (r PreferencesRecord) preferences() (Preferences, error) {
+	subscriber := Subscriber{Kind: SubscriberKind(r.SubscriberKind), ID: strings.TrimSpace(r.SubscriberID)}
+	switch {
+	case subscriber == Workspace:
+	case subscriber.Kind != SubscriberChannel && subscriber.Kind != SubscriberUser:
+		return Preferences{}, fmt.Errorf("unknown subscriber_kind %q", r.SubscriberKind)
+	case subscriber.ID == "":
+		return Preferences{}, errors.New("missing subscriber_id")
+	}
+	return readPreferences(Preferences{Subscriber: subscriber}, map[string]string{
+		"notify": r.Notify, "lead": r.Lead, "arrival-lead": r.ArrivalLead, "cruise": r.Cruise, "maps": r.Maps, "quiet": r.Quiet, "locale": r.Locale,
+	})
+}
+
+func recordOf(f TrackedFlight) SubscriptionRecord {
+	return SubscriptionRecord{
+		FlightID:             f.FlightID,
+		DateDeparture:        f.DateDeparture.String(),
+		TargetKind:           f.Kind,
+		SubscriberKind:       string(f.Subscriber.Kind),
+		SubscriberID:         f.Subscriber.ID,
+		CurrentLeg:           f.CurrentLeg,
+		NotifiedPreDeparture: f.NotifiedPreDeparture,
+		NotifiedTakeoff:      f.NotifiedTakeoff,
+		LastCruiseNotif:      formatTime(f.LastCruiseNotif),
+		NotifiedLanding:      f.NotifiedLanding,
+		NotifiedInboundLate:  f.NotifiedInboundLate,
+		NotifiedPreArrival:   f.NotifiedPreArrival,
+		CreatedBy:            f.CreatedBy,
+		CreatedIn:            f.CreatedIn,
+		CreatedAt:            formatTime(f.CreatedAt),
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// flight validates a record and turns it back into a subscription.
+func (r SubscriptionRecord) flight() (TrackedFlight, error) {
+	f := TrackedFlight{
+		FlightID:             strings.TrimSpace(r.FlightID),
+		Kind:                 r.TargetKind,
+		Subscriber:           Subscriber{Kind: SubscriberKind(r.SubscriberKind), ID: strings.TrimSpace(r.SubscriberID)},
+		CurrentLeg:           r.CurrentLeg,
+		NotifiedPreDeparture: r.NotifiedPreDeparture,
+		NotifiedTakeoff:      r.NotifiedTakeoff,
+		NotifiedLanding:      r.NotifiedLanding,
+		NotifiedInboundLate:  r.NotifiedInboundLate,
+		NotifiedPreArrival:   r.NotifiedPreArrival,
+		CreatedBy:            r.CreatedBy,
+		CreatedIn:            r.CreatedIn,
+	}
+
+	if f.FlightID == "" {
+		return f, errors.New("missing flight_id")
+	}
+	// addresses are stored without their hex: prefix
+	id := f.FlightID
+	if flightcode.Kind(f.Kind) == flightcode.KindHex {
+		id = "hex:" + id
+	}
+	if _, err := flightcode.ParseTarget(id); err != nil {
+		return f, fmt.Errorf("flight_id: %w", err)
+	}
+	switch flightcode.Kind(f.Kind) {
+	case flightcode.KindFlight, flightcode.KindRegistration, flightcode.KindHex:
+	case "":
+		f.Kind = string(flightcode.KindFlight)
+	default:
+		return f, fmt.Errorf("unknown target_kind %q", r.TargetKind)
+	}
+	switch f.Subscriber.Kind {
+	case SubscriberChannel, SubscriberUser:
+	default:
+		return f, fmt.Errorf("unknown subscriber_kind %q", r.SubscriberKind)
+	}
+	if f.Subscriber.ID == "" {
+		return f, errors.New("missing subscriber_id")
+	}
+	for _, user := range r.Watchers {
+		if strings.TrimSpace(user) == "" {
+			return f, errors.New("empty watcher")
+		}
+	}
+
+	var err error
+	if f.DateDeparture, err = dates.Parse(r.DateDeparture); err != nil {
+		return f, fmt.Errorf("date_departure: %w", err)
+	}
+	if f.LastCruiseNotif, err = parseRecordTime(r.LastCruiseNotif); err != nil {
+		return f, fmt.Errorf("last_cruise_notif: %w", err)
+	}
+	if f.CreatedAt, err = parseRecordTime(r.CreatedAt); err != nil {
+		return f, fmt.Errorf("created_at: %w", err)
+	}
+	return f, nil
+}
+
+func parseRecordTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func WriteExport(w io.Writer, export Export, format string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(export)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(csvColumns)
+		for _, r := range export.Subscriptions {
+			cw.Write([]string{
+				r.FlightID,
+				r.DateDeparture,
+				r.TargetKind,
+				r.SubscriberKind,
+				r.SubscriberID,
+				r.CurrentLeg,
+				strconv.FormatBool(r.NotifiedPreDeparture),
+				strconv.FormatBool(r.NotifiedTakeoff),
+				r.LastCruiseNotif,
+				strconv.FormatBool(r.NotifiedLanding),
+				strconv.FormatBool(r.NotifiedInboundLate),
+				strconv.FormatBool(r.NotifiedPreArrival),
+				r.CreatedBy,
+				r.CreatedIn,
+				r.CreatedAt,
+				r.Notify,
+				r.Lead,
+				r.ArrivalLead,
+				r.Cruise,
+				r.Maps,
+				r.Quiet,
+				strings.Join(r.Watchers, " "),
+				"",
+			})
+		}
+		for _, p := range export.Preferences {
+			row := make([]string, len(csvColumns))
+			for i, column := range csvColumns {
+				switch column {
+				case "subscriber_kind":
+					row[i] = p.SubscriberKind
+				case "subscriber_id":
+					row[i] = p.SubscriberID
+				case "notify":
+					row[i] = p.Notify
+				case "lead":
+					row[i] = p.Lead
+				case "arrival_lead":
+					row[i] = p.ArrivalLead
+				case "cruise":
+					row[i] = p.Cruise
+				case "maps":
+					row[i] = p.Maps
+				case "quiet":
+					row[i] = p.Quiet
+				case "locale":
+					row[i] = p.Locale
+				}
+			}
+			cw.Write(row)
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// ReadExport parses an export. CSV files are matched by header name, so
+// columns can come in any order and optional ones can be left out.
+func ReadExport(r io.Reader, format string) (Export, error) {
+	switch format {
+	case FormatJSON:
+		var export Export
+		if err := json.NewDecoder(r).Decode(&export); err != nil {
+			return Export{}, fmt.Errorf("invalid JSON export: %w", err)
+		}
+		if export.Version > exportVersion {
+			return Export{}, fmt.Errorf("export version %d is newer than this bot understands (%d)", export.Version, exportVersion)
+		}
+		return export, nil
+	case FormatCSV:
+		return readCSV(r)
+	}
+	return Export{}, fmt.Errorf("unknown format %q", format)
+}
+
+func readCSV(r io.Reader) (Export, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return Export{}, fmt.Errorf("invalid CSV export: %w", err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	for _, required := range []string{"flight_id", "date_departure", "subscriber_kind", "subscriber_id"} {
+		if _, ok := index[required]; !ok {
+			return Export{}, fmt.Errorf("invalid CSV export: missing column %s", required)
+		}
+	}
+
+	export := Export{Version: exportVersion}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Export{}, fmt.Errorf("invalid CSV export: %w", err)
+		}
+		field := func(name string) string {
+			if i, ok := index[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		flag := func(name string) bool {
+			b, _ := strconv.ParseBool(field(name))
+			return b
+		}
+		// a channel's, user's or the workspace's preferences
+		if field("flight_id") == "" && field("date_departure") == "" {
+			export.Preferences = append(export.Preferences, PreferencesRecord{
+				SubscriberKind: field("subscriber_kind"),
+				SubscriberID:   field("subscriber_id"),
+				Notify:         field("notify"),
+				Lead:           field("lead"),
+				ArrivalLead:    field("arrival_lead"),
+				Cruise:         field("cruise"),
+				Maps:           field("maps"),
+				Quiet:          field("quiet"),
+				Locale:         field("locale"),
+			})
+			continue
+		}
+		export.Subscriptions = append(export.Subscriptions, SubscriptionRecord{
+			FlightID:             field("flight_id"),
+			DateDeparture:        field("date_departure"),
+			TargetKind:           field("target_kind"),
+			SubscriberKind:       field("subscriber_kind"),
+			SubscriberID:         field("subscriber_id"),
+			CurrentLeg:           field("current_leg"),
+			NotifiedPreDeparture: flag("notified_pre_departure"),
+			NotifiedTakeoff:      flag("notified_takeoff"),
+			LastCruiseNotif:      field("last_cruise_notif"),
+			NotifiedLanding:      flag("notified_landing"),
+			NotifiedInboundLate:  flag("notified_inbound_late"),
+			NotifiedPreArrival:   flag("notified_pre_arrival"),
+			CreatedBy:            field("created_by"),
+			CreatedIn:            field("created_in"),
+			CreatedAt:            field("created_at"),
+			Notify:               field("notify"),
+			Lead:                 field("lead"),
+			ArrivalLead:          field("arrival_lead"),
+			Cruise:               field("cruise"),
+			Maps:                 field("maps"),
+			Quiet:                field("quiet"),
+			Watchers:             strings.Fields(field("watchers")),
+		})
+	}
+	return export, nil
+}
+
+// ImportReport says what an import did, or would do on a dry run.
+type ImportReport struct {
+	DryRun   bool
+	Added    int
+	Existing int
+	Invalid  []string
+	// Preferences counts the channels and users whose preferences were set
+	Preferences int
+}
+
+func (r ImportReport) String() string {
+	var b strings.Builder
+	verb := "added"
+	switch {
+	case r.DryRun:
+		verb = "would add"
+	case len(r.Invalid) > 0:
+		verb = "nothing imported, fix the invalid rows first: would add"
+	}
+	fmt.Fprintf(&b, "%s %d subscriptions, %d already tracked, %d invalid", verb, r.Added, r.Existing, len(r.Invalid))
+	if r.Preferences > 0 {
+		fmt.Fprintf(&b, ", preferences for %d channels or users", r.Preferences)
+	}
+	for _, problem := range r.Invalid {
+		b.WriteString("\n  " + problem)
+	}
+	return b.String()
+}
+
+// importedSubscription is a validated row waiting to be written.
+type importedSubscription struct {
+	row      int
+	flight   TrackedFlight
+	prefs    Preferences
+	watchers []string
+}
+
+// Import adds the subscriptions of an export that aren't tracked yet, with
+// their notification state, preferences and watchers. Existing subscriptions and
+// preferences are left alone. Every row is validated before anything is
+// written: with an invalid row, or with dryRun, nothing is.
+func Import(store Store, export Export, dryRun bool) (ImportReport, error) {
+	report := ImportReport{DryRun: dryRun}
+	seen := map[subscriptionKey]bool{}
+
+	existing, err := store.ListPreferences()
+	if err != nil {
+		return report, err
+	}
+	// CSV exports don't say when they were made
+	updatedAt := export.ExportedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now()
+	}
+
+	var preferences []Preferences
+	for i, record := range export.Preferences {
+		p, err := record.preferences()
+		if err != nil {
+			report.Invalid = append(report.Invalid, fmt.Sprintf("preferences %d: %v", i+1, err))
+			continue
+		}
+		if _, ok := FindPreferences(existing, p.Subscriber, "", dates.Date{}); ok {
+			continue
+		}
+		existing = append(existing, p)
+		preferences = append(preferences, p)
+	}
+	report.Preferences = len(preferences)
+
+	var subscriptions []importedSubscription
+	for i, record := range export.Subscriptions {
+		row := i + 1
+
+		f, err := record.flight()
+		if err != nil {
+			report.Invalid = append(report.Invalid, fmt.Sprintf("row %d: %v", row, err))
+			continue
+		}
+		prefs, err := record.preferences(f)
+		if err != nil {
+			report.Invalid = append(report.Invalid, fmt.Sprintf("row %d: %v", row, err))
+			continue
+		}
+		if seen[keyOf(f)] {
+			report.Invalid = append(report.Invalid, fmt.Sprintf("row %d: duplicate of an earlier row", row))
+			continue
+		}
+		seen[keyOf(f)] = true
+
+		exists, err := isSubscribed(store, f)
+		if err != nil {
+			return report, err
+		}
+		if exists {
+			report.Existing++
+			continue
+		}
+		subscriptions = append(subscriptions, importedSubscription{row: row, flight: f, prefs: prefs, watchers: record.Watchers})
+	}
+	report.Added = len(subscriptions)
+
+	if dryRun || len(report.Invalid) > 0 {
+		return report, nil
+	}
+
+	for i, p := range preferences {
+		p.UpdatedAt = updatedAt
+		if err := store.SavePreferences(p); err != nil {
+			return report, fmt.Errorf("preferences %d: %w", i+1, err)
+		}
+	}
+	for _, s := range subscriptions {
+		f := s.flight
+		if _, err := store.AddFlight(f); err != nil {
+			return report, fmt.Errorf("row %d: %w", s.row, err)
+		}
+		if err := store.SaveFlightState(f); err != nil {
+			return report, fmt.Errorf("row %d: %w", s.row, err)
+		}
+		if !s.prefs.IsEmpty() {
+			s.prefs.UpdatedAt = updatedAt
+			if err := store.SavePreferences(s.prefs); err != nil {
+				return report, fmt.Errorf("row %d: %w", s.row, err)
+			}
+		}
+		for _, user := range s.watchers {
+			w := Watcher{FlightID: f.FlightID, DateDeparture: f.DateDeparture, Subscriber: f.Subscriber, UserID: user, AddedBy: f.CreatedBy, AddedAt: updatedAt}
+			if _, err := store.AddWatcher(w); err != nil {
+				return report, fmt.Errorf("row %d: %w", s.row, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+func isSubscribed(store Store, f TrackedFlight) (bool, error) {
+	subscriptions, err := store.FindSubscriptions(f.FlightID)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range subscriptions {
+		if keyOf(s) == keyOf(f) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
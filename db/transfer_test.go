@@ -0,0 +1,174 @@
+package db
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seedTransferStore tracks a flight for a channel, with its own
+// preferences, state and a watcher, one for a user, and preferences for
+// the channel, the user and the workspace.
+func seedTransferStore(t *testing.T) Store {
+	t.Helper()
+	store := NewMemoryStore()
+
+	channel := testFlight(ChannelSubscriber("CTEAM"))
+	mustAdd(t, store, channel)
+	channel.NotifiedPreDeparture = true
+	channel.NotifiedTakeoff = true
+	channel.LastCruiseNotif = testCreated.Add(3 * time.Hour)
+	if err := store.SaveFlightState(channel); err != nil {
+		t.Fatal(err)
+	}
+	mustAdd(t, store, testFlight(UserSubscriber("UOWNER")))
+
+	if _, err := store.AddWatcher(Watcher{FlightID: "AFR6", DateDeparture: testDeparture, Subscriber: channel.Subscriber, UserID: "UWATCH", AddedBy: "UOWNER", AddedAt: testCreated}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []struct {
+		prefs  Preferences
+		values map[string]string
+	}{
+		{Preferences{Subscriber: channel.Subscriber, FlightID: "AFR6", DateDeparture: testDeparture}, map[string]string{"notify": "takeoff,landing", "maps": "off"}},
+		{Preferences{Subscriber: channel.Subscriber}, map[string]string{"lead": "1h", "locale": "fr"}},
+		{Preferences{Subscriber: UserSubscriber("UOWNER")}, map[string]string{"quiet": "22:00-07:00 Europe/Paris", "arrival-lead": "45"}},
+		{Preferences{Subscriber: Workspace}, map[string]string{"cruise": "milestones", "locale": "en"}},
+	} {
+		prefs := p.prefs
+		for name, value := range p.values {
+			if err := prefs.Set(name, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		prefs.UpdatedAt = testCreated
+		if err := store.SavePreferences(prefs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func mustExport(t *testing.T, store Store) Export {
+	t.Helper()
+	export, err := ExportStore(store, testCreated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(export.Preferences, func(a, b PreferencesRecord) int {
+		return strings.Compare(a.SubscriberKind+a.SubscriberID, b.SubscriberKind+b.SubscriberID)
+	})
+	return export
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			want := mustExport(t, seedTransferStore(t))
+			if len(want.Subscriptions) != 2 || len(want.Preferences) != 3 {
+				t.Fatalf("export has %d subscriptions and %d preferences, want 2 and 3", len(want.Subscriptions), len(want.Preferences))
+			}
+
+			var buf bytes.Buffer
+			if err := WriteExport(&buf, want, format); err != nil {
+				t.Fatal(err)
+			}
+			read, err := ReadExport(&buf, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			restored := NewMemoryStore()
+			report, err := Import(restored, read, false)
+			if err != nil || report.Added != 2 || report.Preferences != 3 || len(report.Invalid) != 0 {
+				t.Fatalf("Import = %v, %v", report, err)
+			}
+
+			got := mustExport(t, restored)
+			if !reflect.DeepEqual(got.Subscriptions, want.Subscriptions) {
+				t.Errorf("subscriptions after the round trip:\n%+v\nwant\n%+v", got.Subscriptions, want.Subscriptions)
+			}
+			if !reflect.DeepEqual(got.Preferences, want.Preferences) {
+				t.Errorf("preferences after the round trip:\n%+v\nwant\n%+v", got.Preferences, want.Preferences)
+			}
+
+			// importing again changes nothing
+			report, err = Import(restored, read, false)
+			if err != nil || report.Added != 0 || report.Existing != 2 || report.Preferences != 0 {
+				t.Errorf("second Import = %v, %v", report, err)
+			}
+		})
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	export := mustExport(t, seedTransferStore(t))
+	store := NewMemoryStore()
+
+	report, err := Import(store, export, true)
+	if err != nil || report.Added != 2 || report.Preferences != 3 || !strings.HasPrefix(report.String(), "would add 2 subscriptions") {
+		t.Fatalf("dry run Import = %v, %v", report, err)
+	}
+	if flights, _ := store.ListFlights(); len(flights) != 0 {
+		t.Errorf("dry run added %d subscriptions", len(flights))
+	}
+	if preferences, _ := store.ListPreferences(); len(preferences) != 0 {
+		t.Errorf("dry run saved %d preferences", len(preferences))
+	}
+}
+
+func TestImportValidation(t *testing.T) {
+	valid := recordOf(testFlight(ChannelSubscriber("CTEAM")))
+	invalid := func(change func(r *SubscriptionRecord)) SubscriptionRecord {
+		r := recordOf(testFlight(ChannelSubscriber("COTHER")))
+		change(&r)
+		return r
+	}
+	export := Export{
+		Subscriptions: []SubscriptionRecord{
+			valid,
+			invalid(func(r *SubscriptionRecord) { r.FlightID = "" }),
+			invalid(func(r *SubscriptionRecord) { r.FlightID = "not a flight" }),
+			invalid(func(r *SubscriptionRecord) { r.DateDeparture = "2030-02-30" }),
+			invalid(func(r *SubscriptionRecord) { r.SubscriberKind = "team" }),
+			invalid(func(r *SubscriptionRecord) { r.TargetKind = "boat" }),
+			invalid(func(r *SubscriptionRecord) { r.Lead = "soon" }),
+			invalid(func(r *SubscriptionRecord) { r.Watchers = []string{" "} }),
+			valid,
+		},
+		Preferences: []PreferencesRecord{
+			{SubscriberKind: "channel", SubscriberID: "CTEAM", Notify: "all"},
+			{SubscriberKind: "channel", Locale: "fr"},
+		},
+	}
+
+	store := NewMemoryStore()
+	report, err := Import(store, export, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"row 2:", "row 3:", "row 4:", "row 5:", "row 6:", "row 7:", "row 8:", "row 9: duplicate", "preferences 2:"}
+	if len(report.Invalid) != len(want) {
+		t.Fatalf("invalid rows = %q, want %d", report.Invalid, len(want))
+	}
+	for _, prefix := range want {
+		if !slices.ContainsFunc(report.Invalid, func(problem string) bool { return strings.HasPrefix(problem, prefix) }) {
+			t.Errorf("no %q in %q", prefix, report.Invalid)
+		}
+	}
+	if !strings.HasPrefix(report.String(), "nothing imported") {
+		t.Errorf("report = %q", report)
+	}
+
+	// the valid rows wait until the invalid ones are fixed
+	if flights, _ := store.ListFlights(); len(flights) != 0 {
+		t.Errorf("import with invalid rows added %d subscriptions", len(flights))
+	}
+	if preferences, _ := store.ListPreferences(); len(preferences) != 0 {
+		t.Errorf("import with invalid rows saved %d preferences", len(preferences))
+	}
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	"flight-tracker-slack/dates"
+)
+
+const (
+	ConnectionOK         = "ok"
+	ConnectionTight      = "tight"
+	ConnectionImpossible = "impossible"
+)
+
+// Trip is an itinerary of tracked flights, in the order they are flown.
+type Trip struct {
+	ID         int64
+	Name       string
+	Subscriber Subscriber
+	CreatedBy  string
+	CreatedAt  time.Time
+	Legs       []TripLeg
+}
+
+// TripLeg is one flight of a trip. ConnectionState is what we last told
+// the subscriber about the connection from the previous leg onto this one.
+type TripLeg struct {
+	Position        int
+	FlightID        string
+	DateDeparture   dates.Date
+	ConnectionState string
+}
+
+func (store *SQLStore) AddTrip(t Trip) (Trip, error) {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return t, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(store.dialect.rebind(`
+	INSERT INTO trips (name, subscriber_kind, subscriber_id, created_by, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	RETURNING id
+	`), t.Name, t.Subscriber.Kind, t.Subscriber.ID, t.CreatedBy, encodeTime(t.CreatedAt)).Scan(&t.ID)
+	if err != nil {
+		return t, err
+	}
+
+	for i := range t.Legs {
+		t.Legs[i].Position = i
+		_, err := tx.Exec(store.dialect.rebind(`
+		INSERT INTO trip_legs (trip_id, position, flight_id, date_departure, connection_state)
+		VALUES (?, ?, ?, ?, ?)
+		`), t.ID, i, t.Legs[i].FlightID, encodeDate(t.Legs[i].DateDeparture), t.Legs[i].ConnectionState)
+		if err != nil {
+			return t, err
+		}
+	}
+	return t, tx.Commit()
+}
+
+func (store *SQLStore) ListTrips() ([]Trip, error) {
+	rows, err := store.query(`
+	SELECT t.id, t.name, t.subscriber_kind, t.subscriber_id, t.created_by, t.created_at,
+		l.position, l.flight_id, l.date_departure, l.connection_state
+	FROM trips t JOIN trip_legs l ON l.trip_id = t.id
+	ORDER BY t.id, l.position
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trips []Trip
+	for rows.Next() {
+		var t Trip
+		var leg TripLeg
+		var created, departure any
+		err := rows.Scan(&t.ID, &t.Name, &t.Subscriber.Kind, &t.Subscriber.ID, &t.CreatedBy, &created,
+			&leg.Position, &leg.FlightID, &departure, &leg.ConnectionState)
+		if err != nil {
+			return nil, err
+		}
+		if t.CreatedAt, err = decodeTime(created); err != nil {
+			return nil, err
+		}
+		if leg.DateDeparture, err = decodeDate(departure); err != nil {
+			return nil, err
+		}
+
+		if n := len(trips); n > 0 && trips[n-1].ID == t.ID {
+			trips[n-1].Legs = append(trips[n-1].Legs, leg)
+			continue
+		}
+		t.Legs = []TripLeg{leg}
+		trips = append(trips, t)
+	}
+	return trips, rows.Err()
+}
+
+func (store *SQLStore) SaveConnectionState(tripID int64, position int, state string) error {
+	_, err := store.exec(`
+	UPDATE trip_legs SET connection_state = ?
+	WHERE trip_id = ? AND position = ?
+	`, state, tripID, position)
+	return err
+}
+
+func (store *SQLStore) RemoveTrip(tripID int64) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(store.dialect.rebind("DELETE FROM trip_legs WHERE trip_id = ?"), tripID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(store.dialect.rebind("DELETE FROM trips WHERE id = ?"), tripID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *MemoryStore) AddTrip(t Trip) (Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastTripID++
+	t.ID = m.lastTripID
+	t.Legs = append([]TripLeg(nil), t.Legs...)
+	for i := range t.Legs {
+		t.Legs[i].Position = i
+	}
+	m.trips[t.ID] = t
+	return t, nil
+}
+
+func (m *MemoryStore) ListTrips() ([]Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	trips := make([]Trip, 0, len(m.trips))
+	for _, t := range m.trips {
+		t.Legs = append([]TripLeg(nil), t.Legs...)
+		trips = append(trips, t)
+	}
+	sort.Slice(trips, func(i, j int) bool { return trips[i].ID < trips[j].ID })
+	return trips, nil
+}
+
+func (m *MemoryStore) SaveConnectionState(tripID int64, position int, state string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.trips[tripID]; ok && position >= 0 && position < len(t.Legs) {
+		t.Legs[position].ConnectionState = state
+	}
+	return nil
+}
+
+func (m *MemoryStore) RemoveTrip(tripID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.trips, tripID)
+	return nil
+}
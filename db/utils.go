@@ -1,44 +1,76 @@
 package db
 
 import (
-	"database/sql"
+	"fmt"
 	"time"
+
+	"flight-tracker-slack/dates"
 )
 
-func AddFlight(db *sql.DB, flightID string, departureDate time.Time, channelID string) error {
-	query := `
-	INSERT OR IGNORE INTO tracked_flights (
-		flight_id,
-		date_departure,
-		last_status,
-		notified_pre_departure,
-		notified_takeoff,
-		last_cruise_notif,
-		notified_landing,
-		channel_id
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`
-
-	_, err := db.Exec(query,
-		flightID,
-		departureDate.UTC().Format(time.RFC3339),
-		"",
-		false,
-		false,
-		nil,
-		false,
-		channelID,
-	)
-
-	return err
+// Every time is stored as RFC3339 text in UTC, so values written by us and
+// compared in WHERE clauses always have the same representation.
+func encodeTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// legacy layout used by database/sql drivers when a time.Time is passed directly
+const driverTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+func decodeTime(value any) (time.Time, error) {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return v.UTC(), nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return time.Time{}, fmt.Errorf("unexpected time value %T", value)
+	}
+
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, driverTimeLayout} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q", s)
 }
 
-func RemoveFlight(db *sql.DB, flightID string, departureDate time.Time) error {
-	query := `
-	DELETE FROM tracked_flights
-	WHERE flight_id = ? AND date_departure = ?
-	`
+// Calendar dates are stored as YYYY-MM-DD.
+func encodeDate(d dates.Date) any {
+	return d.String()
+}
 
-	_, err := db.Exec(query, flightID, departureDate)
-	return err
+// decodeDate also reads rows written before dates were calendar days, and
+// values the driver already turned into a time.Time because of the column's
+// declared type.
+func decodeDate(value any) (dates.Date, error) {
+	switch v := value.(type) {
+	case nil:
+		return dates.Date{}, nil
+	case time.Time:
+		return dates.Of(v, time.UTC), nil
+	case []byte:
+		value = string(v)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return dates.Date{}, fmt.Errorf("unexpected date value %T", value)
+	}
+	if s == "" {
+		return dates.Date{}, nil
+	}
+	if len(s) > len("2006-01-02") {
+		s = s[:len("2006-01-02")]
+	}
+	return dates.Parse(s)
 }
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	"flight-tracker-slack/dates"
+)
+
+// Watcher is a Slack user mentioned on a subscription's arrival
+// notifications, someone picking the passengers up for instance.
+type Watcher struct {
+	FlightID      string
+	DateDeparture dates.Date
+	Subscriber    Subscriber
+	UserID        string
+	// who added them, and when
+	AddedBy string
+	AddedAt time.Time
+}
+
+// WatchersOf returns the user IDs watching one subscription, in the order
+// they were added.
+func WatchersOf(all []Watcher, f TrackedFlight) []string {
+	var users []string
+	for _, w := range all {
+		if w.FlightID == f.FlightID && w.DateDeparture == f.DateDeparture && w.Subscriber == f.Subscriber {
+			users = append(users, w.UserID)
+		}
+	}
+	return users
+}
+
+func (s *SQLStore) AddWatcher(w Watcher) (bool, error) {
+	res, err := s.exec(`
+	INSERT INTO watchers (flight_id, date_departure, subscriber_kind, subscriber_id, user_id, added_by, added_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT DO NOTHING
+	`, w.FlightID, encodeDate(w.DateDeparture), w.Subscriber.Kind, w.Subscriber.ID, w.UserID, w.AddedBy, encodeTime(w.AddedAt))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLStore) RemoveWatcher(w Watcher) (bool, error) {
+	res, err := s.exec(`
+	DELETE FROM watchers
+	WHERE flight_id = ? AND date_departure = ? AND subscriber_kind = ? AND subscriber_id = ? AND user_id = ?
+	`, w.FlightID, encodeDate(w.DateDeparture), w.Subscriber.Kind, w.Subscriber.ID, w.UserID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLStore) ListWatchers() ([]Watcher, error) {
+	rows, err := s.query(`
+	SELECT flight_id, date_departure, subscriber_kind, subscriber_id, user_id, added_by, added_at
+	FROM watchers
+	ORDER BY flight_id, date_departure, subscriber_kind, subscriber_id, added_at, user_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []Watcher
+	for rows.Next() {
+		var w Watcher
+		var departure, added any
+		err := rows.Scan(&w.FlightID, &departure, &w.Subscriber.Kind, &w.Subscriber.ID, &w.UserID, &w.AddedBy, &added)
+		if err != nil {
+			return nil, err
+		}
+		if w.DateDeparture, err = decodeDate(departure); err != nil {
+			return nil, err
+		}
+		if w.AddedAt, err = decodeTime(added); err != nil {
+			return nil, err
+		}
+		all = append(all, w)
+	}
+	return all, rows.Err()
+}
+
+func (m *MemoryStore) AddWatcher(w Watcher) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, other := range m.watchers {
+		if other.sameAs(w) {
+			return false, nil
+		}
+	}
+	w.AddedAt = w.AddedAt.UTC().Truncate(time.Second)
+	m.watchers = append(m.watchers, w)
+	return true, nil
+}
+
+func (m *MemoryStore) RemoveWatcher(w Watcher) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, other := range m.watchers {
+		if other.sameAs(w) {
+			m.watchers = append(m.watchers[:i], m.watchers[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) ListWatchers() ([]Watcher, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := append([]Watcher(nil), m.watchers...)
+	sort.SliceStable(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		if a.FlightID != b.FlightID {
+			return a.FlightID < b.FlightID
+		}
+		if a.DateDeparture != b.DateDeparture {
+			return a.DateDeparture.Before(b.DateDeparture)
+		}
+		return a.Subscriber.Mention() < b.Subscriber.Mention()
+	})
+	return all, nil
+}
+
+func (w Watcher) sameAs(other Watcher) bool {
+	return w.FlightID == other.FlightID && w.DateDeparture == other.DateDeparture && w.Subscriber == other.Subscriber && w.UserID == other.UserID
+}
@@ -0,0 +1,43 @@
+package flightcode
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"strings"
+)
+
+//go:embed airlines.csv
+var airlinesCSV string
+
+type Airline struct {
+	IATA string
+	ICAO string
+	Name string
+}
+
+var (
+	byIATA = map[string]Airline{}
+	byICAO = map[string]Airline{}
+)
+
+func init() {
+	records, err := csv.NewReader(strings.NewReader(airlinesCSV)).ReadAll()
+	if err != nil {
+		panic("flightcode: invalid airlines.csv: " + err.Error())
+	}
+	for _, r := range records[1:] {
+		a := Airline{IATA: r[0], ICAO: r[1], Name: r[2]}
+		byIATA[a.IATA] = a
+		byICAO[a.ICAO] = a
+	}
+}
+
+func ByIATA(code string) (Airline, bool) {
+	a, ok := byIATA[strings.ToUpper(code)]
+	return a, ok
+}
+
+func ByICAO(code string) (Airline, bool) {
+	a, ok := byICAO[strings.ToUpper(code)]
+	return a, ok
+}
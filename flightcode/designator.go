@@ -0,0 +1,114 @@
+package flightcode
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalid = errors.New("invalid flight designator")
+
+var (
+	icaoRe   = regexp.MustCompile(`^([A-Z]{3})(\d{1,4})([A-Z]?)$`)
+	iataRe   = regexp.MustCompile(`^([A-Z][A-Z0-9]|[0-9][A-Z])(\d{1,4})([A-Z]?)$`)
+	spacesRe = regexp.MustCompile(`[\s\-]+`)
+)
+
+// Designator is a parsed flight number such as AF123, AFR123 or BA123A.
+// Whichever airline code was typed, the other one is filled in from the
+// embedded airline table when we know it.
+type Designator struct {
+	IATA   string
+	ICAO   string
+	Number int
+	Suffix string
+}
+
+// Parse accepts IATA or ICAO designators in any case, with or without a
+// space between the airline and the number ("af 123", "U2 1234", "BAW117").
+func Parse(input string) (Designator, error) {
+	code := strings.ToUpper(spacesRe.ReplaceAllString(strings.TrimSpace(input), ""))
+
+	var d Designator
+	var number string
+
+	if m := icaoRe.FindStringSubmatch(code); m != nil {
+		d.ICAO, number, d.Suffix = m[1], m[2], m[3]
+		if a, ok := byICAO[d.ICAO]; ok {
+			d.IATA = a.IATA
+		}
+	} else if m := iataRe.FindStringSubmatch(code); m != nil {
+		d.IATA, number, d.Suffix = m[1], m[2], m[3]
+		if a, ok := byIATA[d.IATA]; ok {
+			d.ICAO = a.ICAO
+		}
+	} else {
+		return Designator{}, fmt.Errorf("%w: %q", ErrInvalid, input)
+	}
+
+	d.Number, _ = strconv.Atoi(number)
+	if d.Number == 0 {
+		return Designator{}, fmt.Errorf("%w: %q", ErrInvalid, input)
+	}
+	return d, nil
+}
+
+// Cut parses the designator at the start of a command and returns whatever
+// follows it. The airline code and number may be separate words.
+func Cut(text string) (Designator, string, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return Designator{}, "", fmt.Errorf("%w: empty", ErrInvalid)
+	}
+
+	if d, err := Parse(fields[0]); err == nil {
+		return d, strings.Join(fields[1:], " "), nil
+	}
+	if len(fields) > 1 {
+		if d, err := Parse(fields[0] + fields[1]); err == nil {
+			return d, strings.Join(fields[2:], " "), nil
+		}
+	}
+	_, err := Parse(fields[0])
+	return Designator{}, "", err
+}
+
+// Ident is the form flightaware uses, and the one we store: ICAO when the
+// airline is known, IATA otherwise.
+func (d Designator) Ident() string {
+	switch {
+	case d.ICAO != "":
+		return fmt.Sprintf("%s%d%s", d.ICAO, d.Number, d.Suffix)
+	case d.IATA != "":
+		return fmt.Sprintf("%s%d%s", d.IATA, d.Number, d.Suffix)
+	}
+	return ""
+}
+
+// IATAIdent is the form printed on boarding passes, falling back to the ICAO
+// form for airlines missing from the table.
+func (d Designator) IATAIdent() string {
+	if d.IATA == "" {
+		return d.Ident()
+	}
+	return fmt.Sprintf("%s%d%s", d.IATA, d.Number, d.Suffix)
+}
+
+func (d Designator) Airline() (Airline, bool) {
+	if d.ICAO != "" {
+		return ByICAO(d.ICAO)
+	}
+	return ByIATA(d.IATA)
+}
+
+func (d Designator) String() string {
+	return d.Ident()
+}
+
+// Same reports whether two designators name the same flight, whichever code
+// they were written with.
+func (d Designator) Same(other Designator) bool {
+	return d.Ident() == other.Ident() || d.IATAIdent() == other.IATAIdent()
+}
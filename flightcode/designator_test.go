@@ -0,0 +1,132 @@
+package flightcode
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Designator
+		ident string
+		iata  string
+	}{
+		{"AF123", Designator{IATA: "AF", ICAO: "AFR", Number: 123}, "AFR123", "AF123"},
+		{"af 123", Designator{IATA: "AF", ICAO: "AFR", Number: 123}, "AFR123", "AF123"},
+		{"AFR123", Designator{IATA: "AF", ICAO: "AFR", Number: 123}, "AFR123", "AF123"},
+		{"U2 1234", Designator{IATA: "U2", ICAO: "EZY", Number: 1234}, "EZY1234", "U21234"},
+		{"ezy-1234", Designator{IATA: "U2", ICAO: "EZY", Number: 1234}, "EZY1234", "U21234"},
+		{"BA123A", Designator{IATA: "BA", ICAO: "BAW", Number: 123, Suffix: "A"}, "BAW123A", "BA123A"},
+		{"AF0012", Designator{IATA: "AF", ICAO: "AFR", Number: 12}, "AFR12", "AF12"},
+		// airlines missing from the table keep the code they were typed with
+		{"ZZ123", Designator{IATA: "ZZ", Number: 123}, "ZZ123", "ZZ123"},
+		{"ZZZ123", Designator{ICAO: "ZZZ", Number: 123}, "ZZZ123", "ZZZ123"},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+		if got.Ident() != tt.ident || got.IATAIdent() != tt.iata {
+			t.Errorf("Parse(%q) idents = %s %s, want %s %s", tt.input, got.Ident(), got.IATAIdent(), tt.ident, tt.iata)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, input := range []string{"", "AF", "123", "AF0", "AF12345", "AFRANCE", "A-"} {
+		if d, err := Parse(input); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) = %+v, %v, want ErrInvalid", input, d, err)
+		}
+	}
+}
+
+func TestParseAirline(t *testing.T) {
+	tests := []struct {
+		input string
+		known bool
+	}{
+		{"AF123", true},
+		{"EZY1234", true},
+		{"ZZ123", false},
+		{"ZZZ123", false},
+	}
+	for _, tt := range tests {
+		d, err := Parse(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := d.Airline(); ok != tt.known {
+			t.Errorf("Parse(%q).Airline() known = %v, want %v", tt.input, ok, tt.known)
+		}
+	}
+}
+
+func TestCut(t *testing.T) {
+	tests := []struct {
+		text  string
+		ident string
+		rest  string
+	}{
+		{"AF123", "AFR123", ""},
+		{"AF123 tomorrow", "AFR123", "tomorrow"},
+		{"af 123 2026-11-02 @bob", "AFR123", "2026-11-02 @bob"},
+		{"U2 1234 next friday", "EZY1234", "next friday"},
+		{"BA123A  demain", "BAW123A", "demain"},
+	}
+	for _, tt := range tests {
+		d, rest, err := Cut(tt.text)
+		if err != nil {
+			t.Errorf("Cut(%q) error: %v", tt.text, err)
+			continue
+		}
+		if d.Ident() != tt.ident || rest != tt.rest {
+			t.Errorf("Cut(%q) = %s %q, want %s %q", tt.text, d.Ident(), rest, tt.ident, tt.rest)
+		}
+	}
+
+	for _, text := range []string{"", "   ", "tomorrow AF123", "AF next week"} {
+		if _, _, err := Cut(text); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Cut(%q) error = %v, want ErrInvalid", text, err)
+		}
+	}
+}
+
+func TestSame(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"AF123", "AFR123", true},
+		{"af 123", "AFR 123", true},
+		{"U21234", "EZY1234", true},
+		{"AF123", "AF0123", true},
+		{"AF123", "AF124", false},
+		{"AF123", "KL123", false},
+		{"BA123", "BA123A", false},
+		{"ZZ123", "ZZ123", true},
+		// an unknown airline's two codes can't be matched up
+		{"ZZ123", "ZZZ123", false},
+	}
+	for _, tt := range tests {
+		a, err := Parse(tt.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Parse(tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := a.Same(b); got != tt.want {
+			t.Errorf("%s.Same(%s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.Same(a); got != tt.want {
+			t.Errorf("%s.Same(%s) = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
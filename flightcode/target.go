@@ -0,0 +1,126 @@
+package flightcode
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Kind string
+
+const (
+	KindFlight       Kind = "flight"
+	KindRegistration Kind = "registration"
+	KindHex          Kind = "hex"
+)
+
+var (
+	// F-GKXA, EC-MXV, 9H-QAA, VH-OQA...
+	hyphenRegRe = regexp.MustCompile(`^[A-Z0-9]{1,2}-[A-Z0-9]{2,5}$`)
+	// N12345, N123AB
+	usRegRe = regexp.MustCompile(`^N[1-9](\d{0,4}|\d{0,3}[A-Z]|\d{0,2}[A-Z]{2})$`)
+	hexRe   = regexp.MustCompile(`^[0-9A-F]{6}$`)
+)
+
+// Target is what a /track command follows: either a scheduled flight or a
+// specific airframe, whatever it happens to be flying.
+type Target struct {
+	Kind       Kind
+	Ident      string
+	Designator Designator
+}
+
+func (t Target) IsAircraft() bool {
+	return t.Kind == KindRegistration || t.Kind == KindHex
+}
+
+// AmbiguousError is returned for six hex digits without a "hex:" or "0x"
+// prefix that aren't a known airline's flight: D81234 could be a flight
+// or an aircraft's address.
+// Flight is how to type the flight reading, empty when there is none.
+type AmbiguousError struct {
+	Input  string
+	Flight string
+	Hex    string
+}
+
+func (e *AmbiguousError) Error() string {
+	if e.Flight == "" {
+		return fmt.Sprintf("ambiguous target %q: hex:%s", e.Input, e.Hex)
+	}
+	return fmt.Sprintf("ambiguous target %q: %s or hex:%s", e.Input, e.Flight, e.Hex)
+}
+
+// ParseTarget recognises tail numbers and 24-bit ICAO addresses before
+// falling back to a flight designator. Six bare hex digits are a known
+// airline's flight when they read as one, AF1234; otherwise an address
+// needs its "hex:" or "0x" prefix and they return an *AmbiguousError.
+func ParseTarget(input string) (Target, error) {
+	code := strings.ToUpper(strings.TrimSpace(input))
+
+	for _, prefix := range []string{"HEX:", "0X"} {
+		if rest, ok := strings.CutPrefix(code, prefix); ok {
+			if !hexRe.MatchString(rest) {
+				return Target{}, fmt.Errorf("%w: %q is not a 24-bit address", ErrInvalid, input)
+			}
+			return Target{Kind: KindHex, Ident: rest}, nil
+		}
+	}
+
+	if hyphenRegRe.MatchString(code) || usRegRe.MatchString(code) {
+		if d, err := Parse(code); err != nil || !d.knownAirline() {
+			return Target{Kind: KindRegistration, Ident: code}, nil
+		}
+	}
+
+	d, err := Parse(code)
+	if hexRe.MatchString(code) && (err != nil || !d.knownAirline()) {
+		ambiguous := &AmbiguousError{Input: input, Hex: code}
+		if err == nil {
+			ambiguous.Flight = spaced(code)
+		}
+		return Target{}, ambiguous
+	}
+	if err != nil {
+		return Target{}, err
+	}
+	return Target{Kind: KindFlight, Ident: d.Ident(), Designator: d}, nil
+}
+
+// CutTarget is the Target counterpart of Cut.
+func CutTarget(text string) (Target, string, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return Target{}, "", fmt.Errorf("%w: empty", ErrInvalid)
+	}
+
+	t, err := ParseTarget(fields[0])
+	if err == nil {
+		return t, strings.Join(fields[1:], " "), nil
+	}
+	var ambiguous *AmbiguousError
+	if errors.As(err, &ambiguous) {
+		return Target{}, "", err
+	}
+
+	d, rest, err := Cut(text)
+	if err != nil {
+		return Target{}, "", err
+	}
+	return Target{Kind: KindFlight, Ident: d.Ident(), Designator: d}, rest, nil
+}
+
+// spaced writes a flight number with a space after the airline code, the
+// way to type one that also reads as a hex address.
+func spaced(code string) string {
+	if icaoRe.MatchString(code) {
+		return code[:3] + " " + code[3:]
+	}
+	return code[:2] + " " + code[2:]
+}
+
+func (d Designator) knownAirline() bool {
+	_, ok := d.Airline()
+	return ok
+}
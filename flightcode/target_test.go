@@ -0,0 +1,75 @@
+package flightcode
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Target
+	}{
+		{"hex:3944ef", Target{Kind: KindHex, Ident: "3944EF"}},
+		{"0xD81234", Target{Kind: KindHex, Ident: "D81234"}},
+		{"F-GKXA", Target{Kind: KindRegistration, Ident: "F-GKXA"}},
+		{"N123AB", Target{Kind: KindRegistration, Ident: "N123AB"}},
+		{"af6", Target{Kind: KindFlight, Ident: "AFR6"}},
+		{"D8 1234", Target{Kind: KindFlight, Ident: "D81234"}},
+		// hex digits, but a known airline's flight
+		{"AF1234", Target{Kind: KindFlight, Ident: "AFR1234"}},
+		{"BA1234", Target{Kind: KindFlight, Ident: "BAW1234"}},
+		{"ACA123", Target{Kind: KindFlight, Ident: "ACA123"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseTarget(tt.input)
+		if err != nil {
+			t.Errorf("ParseTarget(%q) error: %v", tt.input, err)
+			continue
+		}
+		if got.Kind != tt.want.Kind || got.Ident != tt.want.Ident {
+			t.Errorf("ParseTarget(%q) = %s %s, want %s %s", tt.input, got.Kind, got.Ident, tt.want.Kind, tt.want.Ident)
+		}
+	}
+}
+
+func TestParseTargetAmbiguous(t *testing.T) {
+	tests := []struct {
+		input  string
+		flight string
+	}{
+		{"D81234", "D8 1234"},
+		{"ab1234", "AB 1234"},
+		{"ABC123", "ABC 123"},
+		// not a flight number, but still needs the prefix
+		{"3944EF", ""},
+	}
+	for _, tt := range tests {
+		_, err := ParseTarget(tt.input)
+		var ambiguous *AmbiguousError
+		if !errors.As(err, &ambiguous) {
+			t.Errorf("ParseTarget(%q) error = %v, want an *AmbiguousError", tt.input, err)
+			continue
+		}
+		if ambiguous.Flight != tt.flight {
+			t.Errorf("ParseTarget(%q) flight reading = %q, want %q", tt.input, ambiguous.Flight, tt.flight)
+		}
+
+		// the flight reading parses as the flight
+		if tt.flight != "" {
+			if target, _, err := CutTarget(tt.flight); err != nil || target.Kind != KindFlight {
+				t.Errorf("CutTarget(%q) = %+v, %v, want a flight", tt.flight, target, err)
+			}
+		}
+		if _, _, err := CutTarget(tt.input + " tomorrow"); !errors.As(err, &ambiguous) {
+			t.Errorf("CutTarget(%q) error = %v, want an *AmbiguousError", tt.input, err)
+		}
+	}
+}
+
+func TestCutTargetKnownAirline(t *testing.T) {
+	target, rest, err := CutTarget("AF1234 2026-11-02")
+	if err != nil || target.Kind != KindFlight || target.Ident != "AFR1234" || rest != "2026-11-02" {
+		t.Errorf("CutTarget = %+v, %q, %v, want flight AFR1234 and the date", target, rest, err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+
+	"flight-tracker-slack/db"
+	"flight-tracker-slack/flightcode"
+	structs "flight-tracker-slack/types"
+)
+
+// historyOf is what we keep of a flight once it is over, landed or
+// cancelled. Airframes are recorded under the flight number of their leg so
+// that /flight stats sees every time a flight was observed.
+func historyOf(f db.TrackedFlight, data structs.FlightDetail, now time.Time) (db.FlightHistory, bool) {
+	if data.FlightStatus != "arrived" && !data.Cancelled {
+		return db.FlightHistory{}, false
+	}
+
+	h := db.FlightHistory{
+		FlightID:      f.FlightID,
+		DateDeparture: f.DateDeparture,
+		Origin:        data.Origin.Iata,
+		Destination:   data.Destination.Iata,
+		Cancelled:     data.Cancelled,
+		Diverted:      data.Diverted,
+		Out:           eventTimes(data.GateDepartureTimes),
+		Off:           eventTimes(data.TakeoffTimes),
+		On:            eventTimes(data.LandingTimes),
+		In:            eventTimes(data.GateArrivalTimes),
+		RecordedAt:    now,
+	}
+	if f.IsAircraft() {
+		operating, err := flightcode.Parse(data.Ident)
+		if err != nil {
+			return db.FlightHistory{}, false
+		}
+		h.FlightID = operating.Ident()
+		h.DateDeparture = departureDay(data)
+	}
+	return h, true
+}
+
+func eventTimes(g structs.GateTimes) db.EventTimes {
+	var times db.EventTimes
+	if g.Scheduled != 0 {
+		times.Scheduled = time.Unix(g.Scheduled, 0).UTC()
+	}
+	if g.Actual != nil {
+		times.Actual = time.Unix(*g.Actual, 0).UTC()
+	}
+	return times
+}
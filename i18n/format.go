@@ -0,0 +1,118 @@
+package i18n
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"flight-tracker-slack/dates"
+)
+
+// the layouts below are Go time layouts from the catalog, "format.date"
+// and so on. Month and weekday abbreviations come out in English and are
+// then replaced with the catalog's "month.Jan" and "weekday.Mon".
+var names = map[Locale]*strings.Replacer{}
+
+func namesOf(catalog map[string]string) *strings.Replacer {
+	var pairs []string
+	for m := time.January; m <= time.December; m++ {
+		abbr := m.String()[:3]
+		if name, ok := catalog["month."+abbr]; ok {
+			pairs = append(pairs, abbr, name)
+		}
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		abbr := d.String()[:3]
+		if name, ok := catalog["weekday."+abbr]; ok {
+			pairs = append(pairs, abbr, name)
+		}
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+func (l Locale) format(t time.Time, layout string) string {
+	return names[l].Replace(t.Format(l.T(layout)))
+}
+
+// Date is a calendar day like 02 Jan 2006.
+func (l Locale) Date(d dates.Date) string {
+	return l.format(d.In(time.UTC), "format.date")
+}
+
+// ShortDate leaves the year out.
+func (l Locale) ShortDate(d dates.Date) string {
+	return l.format(d.In(time.UTC), "format.date_short")
+}
+
+// LongDate adds the day of the week.
+func (l Locale) LongDate(d dates.Date) string {
+	return l.format(d.In(time.UTC), "format.date_weekday")
+}
+
+// Time is a time of day, in t's location.
+func (l Locale) Time(t time.Time) string {
+	return l.format(t, "format.time")
+}
+
+// TimeAndDay is a time of day with its date, for times that may not be
+// today.
+func (l Locale) TimeAndDay(t time.Time) string {
+	return l.format(t, "format.time_day")
+}
+
+// TimeZoneAndDay also names the time zone, for times at an airport the
+// reader may not be at.
+func (l Locale) TimeZoneAndDay(t time.Time) string {
+	return l.format(t, "format.time_zone_day")
+}
+
+// Int groups the digits of n by thousands.
+func (l Locale) Int(n int) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	var grouped []string
+	for len(digits) > 3 {
+		grouped = append([]string{digits[len(digits)-3:]}, grouped...)
+		digits = digits[:len(digits)-3]
+	}
+	grouped = append([]string{digits}, grouped...)
+	return sign + strings.Join(grouped, l.T("format.thousands"))
+}
+
+// Float formats f with the given number of decimals.
+func (l Locale) Float(f float64, decimals int) string {
+	s := strconv.FormatFloat(f, 'f', decimals, 64)
+	return strings.Replace(s, ".", l.T("format.decimal"), 1)
+}
+
+// Percent is n out of total, or n/a without a total.
+func (l Locale) Percent(n, total int) string {
+	if total == 0 {
+		return l.T("format.no_percent")
+	}
+	return l.T("format.percent", l.Float(100*float64(n)/float64(total), 0))
+}
+
+// Duration is d to the minute, like 1h05m or 20m.
+func (l Locale) Duration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	sign := ""
+	if minutes < 0 {
+		sign, minutes = "-", -minutes
+	}
+	if minutes >= 60 {
+		return sign + l.T("format.hours_minutes", minutes/60, minutes%60)
+	}
+	return sign + l.T("format.minutes", minutes)
+}
+
+// List joins items like "a, b and c".
+func (l Locale) List(items []string) string {
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " " + l.T("format.and") + " " + items[len(items)-1]
+}
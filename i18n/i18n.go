@@ -0,0 +1,125 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Locale is a language the bot speaks, named by its ISO 639-1 code.
+type Locale string
+
+const (
+	English Locale = "en"
+	French  Locale = "fr"
+)
+
+// Default is spoken where neither the workspace nor the channel chose.
+const Default = English
+
+var Locales = []Locale{English, French}
+
+// the messages live in one catalog per locale, locales/<locale>.json, keyed
+// by message ID. Values are fmt formats, translations can reorder their
+// arguments with %[2]s.
+//
+//go:embed locales/*.json
+var files embed.FS
+
+var catalogs = map[Locale]map[string]string{}
+
+func init() {
+	for _, l := range Locales {
+		body, err := files.ReadFile(path.Join("locales", string(l)+".json"))
+		if err != nil {
+			panic(err)
+		}
+		catalog := map[string]string{}
+		if err := json.Unmarshal(body, &catalog); err != nil {
+			panic(fmt.Sprintf("locales/%s.json: %v", l, err))
+		}
+		catalogs[l] = catalog
+		names[l] = namesOf(catalog)
+	}
+}
+
+var aliases = map[string]Locale{
+	"english":  English,
+	"anglais":  English,
+	"french":   French,
+	"français": French,
+	"francais": French,
+}
+
+// Parse reads a locale as people type it: en, fr-FR, french, français...
+func Parse(s string) (Locale, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if l, ok := aliases[s]; ok {
+		return l, nil
+	}
+	base, _, _ := strings.Cut(strings.ReplaceAll(s, "_", "-"), "-")
+	for _, l := range Locales {
+		if base == string(l) {
+			return l, nil
+		}
+	}
+	names := make([]string, len(Locales))
+	for i, l := range Locales {
+		names[i] = string(l)
+	}
+	return "", Errorf("error.locale", s, strings.Join(names, ", "))
+}
+
+// T formats the message key in l, falling back to English for messages
+// not translated yet.
+func (l Locale) T(key string, args ...any) string {
+	format, ok := catalogs[l][key]
+	if !ok {
+		format, ok = catalogs[Default][key]
+	}
+	if !ok {
+		fmt.Println("Missing message:", key)
+		return key
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Missing lists the messages of the English catalog a locale has no
+// translation for.
+func Missing(l Locale) []string {
+	var missing []string
+	for key := range catalogs[Default] {
+		if _, ok := catalogs[l][key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// Error is an error whose message is in the catalog, so it can be shown
+// to users in their language. Error() is the English message.
+type Error struct {
+	Key  string
+	Args []any
+}
+
+func Errorf(key string, args ...any) *Error {
+	return &Error{Key: key, Args: args}
+}
+
+func (e *Error) Error() string {
+	return English.T(e.Key, e.Args...)
+}
+
+// Error is the message of err in l when it comes from the catalog, and
+// err's own message otherwise.
+func (l Locale) Error(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return l.T(e.Key, e.Args...)
+	}
+	return err.Error()
+}
@@ -0,0 +1,100 @@
+package i18n
+
+import (
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCatalogKeys(t *testing.T) {
+	for _, l := range Locales {
+		for _, key := range Missing(l) {
+			t.Errorf("%s.json has no %q", l, key)
+		}
+		for key := range catalogs[l] {
+			// month and weekday names replace English ones, see namesOf
+			if strings.HasPrefix(key, "month.") || strings.HasPrefix(key, "weekday.") {
+				continue
+			}
+			if _, ok := catalogs[Default][key]; !ok {
+				t.Errorf("%s.json has %q, which %s.json doesn't", l, key, Default)
+			}
+		}
+	}
+}
+
+var verbPattern = regexp.MustCompile(`%(?:\[(\d+)\])?[-+# 0]*\d*(?:\.\d+)?([a-zA-Z%])`)
+
+// verbs maps each argument a format uses to its verb.
+func verbs(format string) map[int]string {
+	used := map[int]string{}
+	next := 1
+	for _, m := range verbPattern.FindAllStringSubmatch(format, -1) {
+		if m[2] == "%" {
+			continue
+		}
+		if m[1] != "" {
+			next, _ = strconv.Atoi(m[1])
+		}
+		used[next] = m[2]
+		next++
+	}
+	return used
+}
+
+// translations may reorder their arguments but must use each like English
+func TestCatalogArguments(t *testing.T) {
+	for _, l := range Locales {
+		for key, format := range catalogs[l] {
+			want := verbs(catalogs[Default][key])
+			if got := verbs(format); !maps.Equal(got, want) {
+				t.Errorf("%s %q uses arguments %v, %s uses %v", l, key, got, Default, want)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]Locale{
+		"en":       English,
+		"FR":       French,
+		"fr-CA":    French,
+		"fr_FR":    French,
+		"français": French,
+		"English":  English,
+	}
+	for input, want := range tests {
+		if got, err := Parse(input); err != nil || got != want {
+			t.Errorf("Parse(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := Parse("de"); err == nil {
+		t.Error("Parse(de) accepted")
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{English.Int(1234567), "1,234,567"},
+		{English.Int(-999), "-999"},
+		{English.Float(2.25, 1), "2.2"},
+		{English.Percent(0, 0), English.T("format.no_percent")},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q, want %q", tt.got, tt.want)
+		}
+	}
+
+	// French groups and separates decimals differently
+	if got, want := French.Float(1.5, 1), "1"+French.T("format.decimal")+"5"; got != want {
+		t.Errorf("French.Float = %q, want %q", got, want)
+	}
+	if got, want := French.Int(12345), "12"+French.T("format.thousands")+"345"; got != want {
+		t.Errorf("French.Int = %q, want %q", got, want)
+	}
+}
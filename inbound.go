@@ -0,0 +1,146 @@
+package main
+
+import (
+	"time"
+
+	"flight-tracker-slack/db"
+	"flight-tracker-slack/i18n"
+	structs "flight-tracker-slack/types"
+)
+
+// only follow the inbound leg once our departure is this close, no need to
+// scrape twice as much for flights that are days away
+const inboundLookahead = 12 * time.Hour
+
+// inboundCheckDue reports whether the inbound leg of a flight is worth
+// fetching: it is known, and we haven't left yet but will soon.
+func inboundCheckDue(data structs.FlightDetail, now time.Time) bool {
+	if data.InboundFlight == nil || data.InboundFlight.FlightID == "" {
+		return false
+	}
+
+	schedule := data.GetSchedule()
+	if !schedule.DepartureActual.IsZero() || data.FlightStatus == "airborne" || data.FlightStatus == "arrived" {
+		return false
+	}
+	untilDeparture := schedule.DepartureScheduled.Sub(now)
+	return untilDeparture > 0 && untilDeparture <= inboundLookahead
+}
+
+// inboundInterval is how long an inbound leg fetched untilDeparture before
+// our departure is good for. Hours ahead, its estimate hardly moves.
+func inboundInterval(untilDeparture time.Duration) time.Duration {
+	switch {
+	case untilDeparture > 6*time.Hour:
+		return 30 * time.Minute
+	case untilDeparture > 2*time.Hour:
+		return 10 * time.Minute
+	}
+	return 0
+}
+
+type inboundLookup struct {
+	at     time.Time
+	detail structs.FlightDetail
+}
+
+var fetchInbound = fetchInboundData
+
+// inboundLeg is the inbound leg of data for the poll started at polled. It
+// is fetched once per poll, however many flights share it, and reused for
+// inboundInterval afterwards; a failed fetch is retried on the next poll.
+func (b *Bot) inboundLeg(data structs.FlightDetail, polled time.Time) structs.FlightDetail {
+	id := data.InboundFlight.FlightID
+	interval := inboundInterval(data.GetSchedule().DepartureScheduled.Sub(polled))
+	if last, ok := b.inbound[id]; ok {
+		fresh := last.detail.Airline.FullName != "" && polled.Sub(last.at) < interval
+		if last.at.Equal(polled) || fresh {
+			return last.detail
+		}
+	}
+
+	if b.inbound == nil {
+		b.inbound = map[string]inboundLookup{}
+	}
+	detail := fetchInbound(data.InboundFlight)
+	b.inbound[id] = inboundLookup{at: polled, detail: detail}
+	return detail
+}
+
+// forgetInbound drops the inbound legs no poll can reuse anymore.
+func (b *Bot) forgetInbound(polled time.Time) {
+	for id, last := range b.inbound {
+		if polled.Sub(last.at) >= inboundInterval(inboundLookahead) {
+			delete(b.inbound, id)
+		}
+	}
+}
+
+func anyInboundPending(subscriptions []db.TrackedFlight) bool {
+	for _, f := range subscriptions {
+		if !f.NotifiedInboundLate {
+			return true
+		}
+	}
+	return false
+}
+
+// checkInbound warns a subscriber when the aircraft operating our flight is
+// still on its previous leg and won't be on the ground long enough before
+// our scheduled departure. inbound is that previous leg, fetched once by the
+// poller when inboundCheckDue. The warning is in locale.
+func (b *Bot) checkInbound(f db.TrackedFlight, data structs.FlightDetail, inbound structs.FlightDetail, locale i18n.Locale) (FlightUpdate, bool) {
+	if f.NotifiedInboundLate || inbound.Airline.FullName == "" {
+		return FlightUpdate{}, false
+	}
+
+	schedule := data.GetSchedule()
+
+	inboundSchedule := inbound.GetSchedule()
+	if !inboundSchedule.ArrivalActual.IsZero() {
+		// already on the ground, the turnaround is the airline's problem now
+		return FlightUpdate{}, false
+	}
+
+	inboundArrival := inboundSchedule.ArrivalEstimated
+	if inboundArrival.IsZero() {
+		inboundArrival = inboundSchedule.ArrivalScheduled
+	}
+
+	turnaround := schedule.DepartureScheduled.Sub(inboundArrival)
+	if turnaround >= b.MinTurnaround {
+		return FlightUpdate{}, false
+	}
+
+	ident := data.InboundFlight.DisplayIdent
+	if ident == "" {
+		ident = data.InboundFlight.Ident
+	}
+
+	var margin string
+	if turnaround > 0 {
+		margin = locale.T("notify.inbound_before", locale.Duration(turnaround.Truncate(time.Minute)))
+	} else {
+		margin = locale.T("notify.inbound_after", locale.Duration((-turnaround).Truncate(time.Minute)))
+	}
+
+	blocks := []any{
+		map[string]any{
+			"type": "section",
+			"text": map[string]string{
+				"type": "mrkdwn",
+				"text": locale.T(
+					"notify.inbound_late",
+					flightLabel(f, data),
+					ident,
+					inbound.Origin.Iata,
+					inbound.Destination.Iata,
+					locale.Time(inboundArrival),
+					margin,
+					locale.Time(schedule.DepartureScheduled),
+				),
+			},
+		},
+	}
+	return newFlightUpdate(f, InboundLate, blocks), true
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	structs "flight-tracker-slack/types"
+)
+
+func TestInboundLegFetches(t *testing.T) {
+	fetches := 0
+	failing := false
+	previous := fetchInbound
+	fetchInbound = func(ref *structs.InboundFlight) structs.FlightDetail {
+		fetches++
+		if failing {
+			return structs.FlightDetail{}
+		}
+		return structs.FlightDetail{Airline: structs.AirlineDetail{FullName: "Air France"}}
+	}
+	t.Cleanup(func() { fetchInbound = previous })
+
+	start := time.Date(2030, time.January, 2, 6, 0, 0, 0, time.UTC)
+	departure := start.Add(8 * time.Hour)
+	data := structs.FlightDetail{
+		InboundFlight:      &structs.InboundFlight{FlightID: "AFR5-1893456000-schedule-0001"},
+		GateDepartureTimes: structs.GateTimes{Scheduled: departure.Unix()},
+	}
+	bot := &Bot{}
+
+	steps := []struct {
+		name    string
+		polled  time.Time
+		failing bool
+		fetches int
+	}{
+		{"first poll", start, false, 1},
+		{"another flight with the same inbound leg", start, false, 1},
+		{"next poll, 8h before departure", start.Add(time.Minute), false, 1},
+		{"30 minutes later", start.Add(30 * time.Minute), false, 2},
+		{"5h before departure", departure.Add(-5 * time.Hour), false, 3},
+		{"5 minutes later", departure.Add(-5*time.Hour + 5*time.Minute), false, 3},
+		{"1h before departure", departure.Add(-time.Hour), true, 4},
+		{"failed fetch, same poll", departure.Add(-time.Hour), true, 4},
+		{"failed fetch, next poll", departure.Add(-time.Hour + time.Minute), false, 5},
+		{"every poll close to departure", departure.Add(-time.Hour + 2*time.Minute), false, 6},
+	}
+	for _, step := range steps {
+		failing = step.failing
+		bot.forgetInbound(step.polled)
+		bot.inboundLeg(data, step.polled)
+		if fetches != step.fetches {
+			t.Fatalf("%s: %d fetches, want %d", step.name, fetches, step.fetches)
+		}
+	}
+
+	bot.forgetInbound(departure.Add(time.Hour))
+	if len(bot.inbound) != 0 {
+		t.Errorf("inbound legs kept after departure: %v", bot.inbound)
+	}
+}
@@ -2,45 +2,95 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
-	_ "modernc.org/sqlite"
 
-	"flight-tracker-slack/cdn"
-	"flight-tracker-slack/maps"
+	"flight-tracker-slack/db"
 	"flight-tracker-slack/scraps"
 	"flight-tracker-slack/slack"
-	structs "flight-tracker-slack/types"
 )
 
 type Bot struct {
-	SlackToken string
-	Db         *sql.DB
-}
-
-type TrackedFlight struct {
-	FlightID             string    `db:"flight_id"`
-	ChannelID            string    `db:"channel_id"`
-	DateDeparture        time.Time `db:"date_departure"`
-	NotifiedPreDeparture bool      `db:"notified_pre_departure"`
-	NotifiedTakeoff      bool      `db:"notified_takeoff"`
-	LastCruiseNotif      time.Time `db:"last_cruise_notif"`
-	NotifiedLanding      bool      `db:"notified_landing"`
+	SlackToken        string
+	AdminChannel      string
+	AdminToken        string
+	MinTurnaround     time.Duration
+	MinConnection     time.Duration
+	SnapshotRetention time.Duration
+	Clock             Clock
+	Store             db.Store
+
+	// inbound legs fetched by earlier polls, by flightaware flight id
+	inbound map[string]inboundLookup
 }
 
 func main() {
+	dumpSnapshots := flag.String("dump-snapshots", "", "print the recorded snapshots of this flight and exit")
+	dumpNotifications := flag.String("dump-notifications", "", "print the notifications sent about this flight and exit")
+	replayFlight := flag.String("replay", "", "replay the recorded snapshots of this flight and print the notifications it would send")
+	replayFile := flag.String("replay-file", "", "replay the snapshots stored in this JSON file")
+	prefs := flag.String("prefs", "", "with -replay or -replay-file, preferences of the replayed subscription, like \"notify=takeoff,landing cruise=milestones\"")
+	exportPath := flag.String("export", "", "write every tracked flight and subscription to this file (- for stdout) and exit")
+	importPath := flag.String("import", "", "add the flights and subscriptions from this export file (- for stdin) and exit")
+	format := flag.String("format", "", "with -export or -import, json or csv (default: from the file extension, else json)")
+	dryRun := flag.Bool("dry-run", false, "with -import, validate and report without writing anything")
+	migrate := flag.Bool("migrate", false, "apply pending database migrations and exit")
+	migrateStatus := flag.Bool("migrate-status", false, "print the database schema version and pending migrations and exit")
+	flag.Parse()
+
 	godotenv.Load()
-	bot := &Bot{
-		SlackToken: os.Getenv("SLACK_BOT_TOKEN"),
-		Db:         nil,
+	databaseURL := os.Getenv("DATABASE_URL")
+
+	if *migrate || *migrateStatus {
+		os.Exit(runMigrate(databaseURL, *migrateStatus))
+	}
+	if *dumpSnapshots != "" {
+		os.Exit(runDumpSnapshots(initDB(databaseURL), *dumpSnapshots))
+	}
+	if *exportPath != "" {
+		os.Exit(runExport(initDB(databaseURL), *exportPath, *format))
+	}
+	if *importPath != "" {
+		os.Exit(runImport(initDB(databaseURL), *importPath, *format, *dryRun))
+	}
+	if *dumpNotifications != "" {
+		os.Exit(runDumpNotifications(initDB(databaseURL), *dumpNotifications))
+	}
+	if *replayFlight != "" || *replayFile != "" {
+		os.Exit(runReplay(databaseURL, *replayFlight, *replayFile, *prefs))
 	}
-	db := initDB("flights.db")
-	bot.Db = db
+
+	bot := &Bot{
+		SlackToken:        os.Getenv("SLACK_BOT_TOKEN"),
+		AdminChannel:      os.Getenv("ADMIN_CHANNEL_ID"),
+		AdminToken:        os.Getenv("ADMIN_TOKEN"),
+		MinTurnaround:     envMinutes("MIN_TURNAROUND_MINUTES", 45),
+		MinConnection:     envMinutes("MIN_CONNECTION_MINUTES", 60),
+		SnapshotRetention: time.Duration(envInt("SNAPSHOT_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		Clock:             realClock{},
+		Store:             initDB(databaseURL),
+	}
+
+	slack.DefaultJobs.Timeout = envSeconds("COMMAND_TIMEOUT_SECONDS", 25)
+
+	scraps.DefaultBreaker.OnStateChange(func(state scraps.BreakerState, lastErr error) {
+		switch state {
+		case scraps.BreakerOpen:
+			bot.notifyAdmin("admin.scraping_paused", scraps.DefaultBreaker.Cooldown, lastErr)
+		case scraps.BreakerClosed:
+			bot.notifyAdmin("admin.scraping_recovered")
+		}
+	})
+	scraps.OnSchemaDrift(func(report scraps.DriftReport) {
+		bot.notifyAdmin("admin.schema_drift", report.String())
+	})
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -49,14 +99,22 @@ func main() {
 
 	r := chi.NewRouter()
 	r.Post("/api/track", func(w http.ResponseWriter, r *http.Request) {
-		slack.AddFlightHandler(w, r, bot.Db)
+		slack.AddFlightHandler(w, r, bot.Store, bot.SlackToken)
 	})
 	r.Post("/api/untrack", func(w http.ResponseWriter, r *http.Request) {
-		slack.RemoveFlightHandler(w, r, bot.Db)
+		slack.RemoveFlightHandler(w, r, bot.Store, bot.SlackToken)
 	})
 	r.Post("/api/list", func(w http.ResponseWriter, r *http.Request) {
-		slack.PrintAllTrackedFlights(w, r, bot.Db)
+		slack.PrintAllTrackedFlights(w, r, bot.Store, bot.SlackToken)
+	})
+	r.Post("/api/trip", func(w http.ResponseWriter, r *http.Request) {
+		slack.TripHandler(w, r, bot.Store, bot.SlackToken)
 	})
+	r.Post("/api/flight", func(w http.ResponseWriter, r *http.Request) {
+		slack.FlightCommandHandler(w, r, bot.Store, bot.SlackToken)
+	})
+	r.Get("/admin/export", bot.requireAdmin(bot.handleExport))
+	r.Post("/admin/import", bot.requireAdmin(bot.handleImport))
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("hi :3"))
 	})
@@ -66,344 +124,103 @@ func main() {
 	bot.Run()
 }
 
-func initDB(path string) *sql.DB {
-	db, err := sql.Open("sqlite", "file:"+path+"?_busy_timeout=5000")
+func runDumpSnapshots(store db.Store, flightID string) int {
+	snapshots, err := store.ListSnapshots(flightID)
 	if err != nil {
-		panic(err)
-	}
+		fmt.Println("Error reading snapshots:", err)
+		return 1
+	}
+	for _, s := range snapshots {
+		schedule := s.Detail.GetSchedule()
+		fmt.Printf("%s %s leg=%s status=%s dep=%s/%s arr=%s/%s\n",
+			s.ObservedAt.UTC().Format(time.RFC3339),
+			s.Provider,
+			s.LegID,
+			s.Detail.FlightStatus,
+			schedule.DepartureScheduled.UTC().Format("15:04"),
+			schedule.DepartureActual.UTC().Format("15:04"),
+			schedule.ArrivalScheduled.UTC().Format("15:04"),
+			schedule.ArrivalActual.UTC().Format("15:04"),
+		)
+	}
+	fmt.Printf("%d snapshots\n", len(snapshots))
+	return 0
+}
 
-	createTable := `
-	CREATE TABLE IF NOT EXISTS tracked_flights (
-		flight_id TEXT NOT NULL,
-		date_departure TIMESTAMP NOT NULL,
-		channel_id TEXT NOT NULL,
-		last_status TEXT,
-		notified_pre_departure BOOLEAN DEFAULT 0,
-		notified_takeoff BOOLEAN DEFAULT 0,
-		last_cruise_notif TIMESTAMP,
-		notified_landing BOOLEAN DEFAULT 0,
-		PRIMARY KEY (flight_id, date_departure)
-	);
-	`
-	_, err = db.Exec(createTable)
+// openDB connects to DATABASE_URL, a PostgreSQL URL or a SQLite file
+// (flights.db by default).
+func openDB(url string) (*sql.DB, db.Dialect) {
+	database, dialect, err := db.Open(url)
 	if err != nil {
 		panic(err)
 	}
-	return db
-}
-
-func (b *Bot) Run() {
-	b.pollFlights()
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-	for range ticker.C {
-		b.pollFlights()
-	}
+	return database, dialect
 }
 
-func (b *Bot) pollFlights() {
+func initDB(url string) *db.SQLStore {
+	database, dialect := openDB(url)
 
-	fmt.Println("Polling tracked flights...")
-
-	rows, err := b.Db.Query("SELECT flight_id, channel_id, date_departure, notified_pre_departure, notified_takeoff, last_cruise_notif, notified_landing FROM tracked_flights")
+	applied, err := db.Migrate(database, dialect)
 	if err != nil {
-		fmt.Println("Error querying tracked flights:", err)
-		return
+		panic(err)
 	}
-
-	var flights []TrackedFlight
-	for rows.Next() {
-		var f TrackedFlight
-		var lastCruise sql.NullTime
-		if err := rows.Scan(&f.FlightID, &f.ChannelID, &f.DateDeparture, &f.NotifiedPreDeparture, &f.NotifiedTakeoff, &lastCruise, &f.NotifiedLanding); err != nil {
-			fmt.Println(err)
-			continue
-		}
-		if lastCruise.Valid {
-			f.LastCruiseNotif = lastCruise.Time
-		}
-		flights = append(flights, f)
-		fmt.Printf("Tracked flight: %s departing at %s\n", f.FlightID, f.DateDeparture.UTC().Format(time.RFC3339))
+	for _, m := range applied {
+		fmt.Println("Applied migration", m.Name)
 	}
+	return db.NewSQLStore(database, dialect)
+}
 
-	rows.Close()
-
-	var updates []FlightUpdate
-
-	for _, f := range flights {
-
-		data := fetchFlightData(f)
-		if data.Airline.FullName == "" {
-			continue
-		}
-
-		now := time.Now().UTC()
-		diff := data.GetSchedule().DepartureScheduled.Sub(now)
-
-		switch {
-		case !f.NotifiedPreDeparture && diff <= 30*time.Minute && diff > 0:
-			blocks := []any{
-				map[string]any{
-					"type": "section",
-					"text": map[string]string{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("Flight *%s* (%s → %s) is scheduled to depart in less than 30 minutes!", f.FlightID, data.Origin.Iata, data.Destination.Iata),
-					},
-				},
-				map[string]any{
-					"type": "divider",
-				},
-				map[string]any{
-					"type": "section",
-					"text": map[string]string{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("_Terminal %s, Gate %s_", data.Origin.Terminal, data.Origin.Gate),
-					},
-				},
-			}
-			updates = append(updates, newFlightUpdate(f, PreDeparture, blocks))
-		case !f.NotifiedTakeoff && data.FlightStatus == "airborne":
-
-			var delayTime = data.GetSchedule().DepartureActual.Sub(data.GetSchedule().DepartureScheduled)
-			var delayNote string
-			if delayTime > 0 {
-				delayNote = fmt.Sprintf("\n(delayed by %s)", delayTime.Truncate(time.Minute))
-			} else {
-				delayNote = ""
-			}
-
-			arrivalEstimated := data.GetSchedule().ArrivalEstimated
-
-			blocks := []any{
-				map[string]any{
-					"type": "section",
-					"text": map[string]string{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf(
-							"🛫 Flight *%s* has taken off!\nEstimated Arrival: %s (in about %.1f hours) %s",
-							f.FlightID,
-							arrivalEstimated.Format("03:04 PM (2 Jan)"),
-							arrivalEstimated.Sub(now).Truncate(time.Minute).Hours(),
-							delayNote,
-						),
-					},
-				},
-				map[string]any{
-					"type": "divider",
-				},
-				map[string]any{
-					"type": "section",
-					"text": map[string]string{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("_Aircraft : *%s*_", data.Aircraft.FriendlyType),
-					},
-				},
-			}
-			updates = append(updates, newFlightUpdate(f, Takeoff, blocks))
-		case !f.NotifiedLanding && data.FlightStatus == "arrived":
-
-			delayTime := data.GetSchedule().ArrivalActual.Sub(data.GetSchedule().ArrivalScheduled)
-			var delayNote string
-			if delayTime > 0 {
-				delayNote = fmt.Sprintf("\n(The flight was delayed by %s)", delayTime.Truncate(time.Minute))
-			} else {
-				delayNote = ""
-			}
-
-			var gate = data.Destination.Gate
-			if gate == "" {
-				gate = "unknown"
-			}
-			var terminal = data.Destination.Terminal
-			if terminal == "" {
-				terminal = "unknown"
-			}
-
-			blocks := []any{
-				map[string]any{
-					"type": "section",
-					"text": map[string]string{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("🛬 Flight *%s* has landed! %s", f.FlightID, delayNote),
-					},
-				},
-				map[string]any{
-					"type": "divider",
-				},
-				map[string]any{
-					"type": "section",
-					"text": map[string]string{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("_Arrived at Terminal %s, Gate %s_", terminal, gate),
-					},
-				},
-			}
-			updates = append(updates, newFlightUpdate(f, Landing, blocks))
-		case data.FlightStatus == "airborne" && now.Sub(f.LastCruiseNotif) >= 2*time.Hour && f.NotifiedTakeoff:
-
-			var lastTrackPoint structs.TrackPoint
-
-			// take the one with the biggest timestamp
-
-			for _, tp := range data.Track {
-				if tp.Timestamp > lastTrackPoint.Timestamp {
-					lastTrackPoint = tp
-				}
-			}
-
-			mapImagePath, err := maps.GenerateAircraftMap(lastTrackPoint.Coord[1], lastTrackPoint.Coord[0], data.Track, data.Heading)
-			if err != nil {
-				fmt.Println("Error generating map:", err)
-				continue
-			}
-			defer os.Remove(mapImagePath)
-
-			flightMapURL, err := cdn.UploadFile(mapImagePath)
-			if err != nil {
-				fmt.Println("Error uploading map to CDN:", err)
-				continue
-			}
-
-			arrivalTime := data.GetSchedule().ArrivalEstimated
+func runMigrate(url string, statusOnly bool) int {
+	database, dialect := openDB(url)
 
-			blocks := []any{
-				map[string]any{
-					"type": "section",
-					"text": map[string]string{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("✈️ Flight *%s* is currently cruising with a ground speed *%d knots*. (%d km remaining)", f.FlightID, data.Groundspeed, data.Distance.Remaining),
-					},
-				},
-				map[string]any{
-					"type":      "image",
-					"image_url": flightMapURL,
-					"alt_text":  "Aircraft Position Map",
-				},
-				map[string]any{
-					"type": "divider",
-				},
-				map[string]any{
-					"type": "section",
-					"text": map[string]string{
-						"type": "mrkdwn",
-						"text": fmt.Sprintf("_Estimated Arrival: %s_ (in %f hours)", arrivalTime.Format("03:04 PM"), arrivalTime.Sub(now).Hours()),
-					},
-				},
-			}
-			updates = append(updates, newFlightUpdate(f, Cruise, blocks))
-		}
-
-		fmt.Printf("Checked flight %s: status=%s\n", f.FlightID, data.FlightStatus)
+	version, err := db.SchemaVersion(database, dialect)
+	if err != nil {
+		fmt.Println("Error reading schema version:", err)
+		return 1
 	}
-
-	for _, update := range updates {
-		fmt.Printf("Sending update for flight %s: type=%d\n", update.Flight.FlightID, update.Type)
-		b.updateFlightStatus(update)
+	pending, err := db.PendingMigrations(database, dialect)
+	if err != nil {
+		fmt.Println("Error listing migrations:", err)
+		return 1
 	}
-}
-
-func (b *Bot) updateFlightStatus(update FlightUpdate) {
-	var query string
-	args := []any{}
 
-	switch update.Type {
-	case PreDeparture:
-		if !update.Flight.NotifiedPreDeparture {
-			query = "UPDATE tracked_flights SET notified_pre_departure = 1 WHERE flight_id = ? AND date_departure = ?"
-			args = []any{update.Flight.FlightID, update.Flight.DateDeparture.UTC().Format(time.RFC3339)}
+	fmt.Println("Schema version:", version)
+	if statusOnly {
+		for _, m := range pending {
+			fmt.Println("Pending:", m.Name)
 		}
-	case Takeoff:
-		if !update.Flight.NotifiedTakeoff {
-			query = "UPDATE tracked_flights SET notified_takeoff = 1, last_cruise_notif = ? WHERE flight_id = ? AND date_departure = ?"
-			args = []any{time.Now().UTC().Format(time.RFC3339), update.Flight.FlightID, update.Flight.DateDeparture.UTC().Format(time.RFC3339)}
+		if len(pending) == 0 {
+			fmt.Println("Up to date")
 		}
-	case Landing:
-		if !update.Flight.NotifiedLanding {
-			query = "UPDATE tracked_flights SET notified_landing = 1 WHERE flight_id = ? AND date_departure = ?"
-			args = []any{update.Flight.FlightID, update.Flight.DateDeparture.UTC().Format(time.RFC3339)}
-		}
-	case Cruise:
-		query = "UPDATE tracked_flights SET last_cruise_notif = ? WHERE flight_id = ? AND date_departure = ?"
-		args = []any{time.Now().UTC().Format(time.RFC3339), update.Flight.FlightID, update.Flight.DateDeparture.UTC().Format(time.RFC3339)}
+		return 0
 	}
 
-	_, err := b.Db.Exec(query, args...)
-	if err != nil {
-		fmt.Println("Error updating flight status:", err)
-		slack.SendSlackMessageTyped(slack.SlackMessage{
-			Channel: update.Flight.ChannelID,
-			Text:    fmt.Sprintf("Error updating flight %s status in database: %v", update.Flight.FlightID, err),
-			Blocks:  nil,
-		}, b.SlackToken)
-		return
+	applied, err := db.Migrate(database, dialect)
+	for _, m := range applied {
+		fmt.Println("Applied:", m.Name)
 	}
-
-	err = slack.SendSlackMessageTyped(update.Msg, b.SlackToken)
 	if err != nil {
-		fmt.Println("Slack error:", err)
-		return
+		fmt.Println("Error migrating:", err)
+		return 1
 	}
-
-	if update.Type == Landing {
-		_, err := b.Db.Exec("DELETE FROM tracked_flights WHERE flight_id = ? AND date_departure = ?", update.Flight.FlightID, update.Flight.DateDeparture.UTC().Format(time.RFC3339))
-		if err != nil {
-			b.sendSimpleSlack(update.Flight, fmt.Sprintf("Error removing landed flight %s from tracking: %v", update.Flight.FlightID, err))
-			fmt.Println("Error removing landed flight:", err)
-		}
+	if len(applied) == 0 {
+		fmt.Println("Up to date")
 	}
+	return 0
 }
 
-type UpdateType int
-
-const (
-	PreDeparture UpdateType = iota // 0
-	Takeoff                        // 1
-	Landing                        // 2
-	Cruise                         // 3
-)
-
-type FlightUpdate struct {
-	Flight TrackedFlight
-	Type   UpdateType
-	Msg    slack.SlackMessage
+func envMinutes(key string, fallback int) time.Duration {
+	return time.Duration(envInt(key, fallback)) * time.Minute
 }
 
-func newFlightUpdate(flight TrackedFlight, updateType UpdateType, blocks []any) FlightUpdate {
-	return FlightUpdate{
-		Flight: flight,
-		Type:   updateType,
-		Msg: slack.SlackMessage{
-			Channel: flight.ChannelID,
-			Blocks:  blocks,
-		},
-	}
+func envSeconds(key string, fallback int) time.Duration {
+	return time.Duration(envInt(key, fallback)) * time.Second
 }
 
-func fetchFlightData(f TrackedFlight) structs.FlightDetail {
-	wrapper, err := scraps.GetFlightInfo(f.FlightID)
-	if err != nil {
-		fmt.Println("Error fetching flight info:", err)
-		return structs.FlightDetail{}
-	}
-
-	for _, v := range wrapper.Flights {
-		return v
-	}
-	return structs.FlightDetail{}
-}
-
-func (b *Bot) sendSimpleSlack(f TrackedFlight, msg string) {
-	blocks := []any{
-		map[string]any{
-			"type": "section",
-			"text": map[string]string{
-				"type": "mrkdwn",
-				"text": msg,
-			},
-		},
-	}
-	err := slack.SendSlackMessage(f.ChannelID, b.SlackToken, "", blocks)
-	if err != nil {
-		fmt.Println("Slack error:", err)
+func envInt(key string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n <= 0 {
+		n = fallback
 	}
+	return n
 }
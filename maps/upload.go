@@ -0,0 +1,33 @@
+package maps
+
+import (
+	"flight-tracker-slack/cdn"
+	structs "flight-tracker-slack/types"
+	"fmt"
+	"os"
+)
+
+// UploadAircraftMap renders the aircraft at its latest track point and
+// returns the map's CDN URL.
+func UploadAircraftMap(data structs.FlightDetail) (string, error) {
+	var lastTrackPoint structs.TrackPoint
+
+	// take the one with the biggest timestamp
+	for _, tp := range data.Track {
+		if tp.Timestamp > lastTrackPoint.Timestamp {
+			lastTrackPoint = tp
+		}
+	}
+
+	mapImagePath, err := GenerateAircraftMap(lastTrackPoint.Coord[1], lastTrackPoint.Coord[0], data.Track, data.Heading)
+	if err != nil {
+		return "", fmt.Errorf("generating map: %w", err)
+	}
+	defer os.Remove(mapImagePath)
+
+	flightMapURL, err := cdn.UploadFile(mapImagePath)
+	if err != nil {
+		return "", fmt.Errorf("uploading map to CDN: %w", err)
+	}
+	return flightMapURL, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"flight-tracker-slack/db"
+	"flight-tracker-slack/slack"
+)
+
+// notificationKey identifies an event for one subscriber: the flight
+// instance (and leg, for airframes), the subscriber and the event type.
+// Cruise updates repeat, each is keyed by the one before it.
+func notificationKey(update FlightUpdate) string {
+	f := update.Flight
+	parts := []string{
+		f.FlightID,
+		f.DateDeparture.String(),
+		f.CurrentLeg,
+		string(f.Subscriber.Kind) + ":" + f.Subscriber.ID,
+		update.Type.String(),
+	}
+	if update.Type == Cruise {
+		parts = append(parts, f.LastCruiseNotif.UTC().Format(time.RFC3339))
+	}
+	return strings.Join(parts, "/")
+}
+
+// claimNotification records the update in the audit log before it is sent.
+// It returns false when the same event was already sent to this subscriber,
+// by an earlier poll or another instance of the bot.
+func (b *Bot) claimNotification(update FlightUpdate) (db.Notification, bool) {
+	n := db.Notification{
+		Key:           notificationKey(update),
+		FlightID:      update.Flight.FlightID,
+		DateDeparture: update.Flight.DateDeparture,
+		Subscriber:    update.Flight.Subscriber,
+		Event:         update.Type.String(),
+		Payload:       payloadOf(update.Msg),
+		CreatedAt:     b.Clock.Now().UTC(),
+	}
+	return n, b.claim(n)
+}
+
+func (b *Bot) claim(n db.Notification) bool {
+	claimed, err := b.Store.ClaimNotification(n)
+	if err != nil {
+		fmt.Println("Error recording notification:", err)
+		return false
+	}
+	if !claimed {
+		fmt.Printf("Skipping %s: already sent\n", n.Key)
+	}
+	return claimed
+}
+
+// handled reports whether a notification that couldn't be claimed was
+// sent. One left pending by a poll that stopped while sending counts as
+// sent: better a message missing than the same one twice.
+func (b *Bot) handled(n db.Notification) bool {
+	notifications, err := b.Store.ListNotifications(n.FlightID)
+	if err != nil {
+		fmt.Println("Error reading notifications:", err)
+		return false
+	}
+	for _, existing := range notifications {
+		if existing.Key == n.Key {
+			return existing.Result != db.NotificationFailed
+		}
+	}
+	return false
+}
+
+// finishNotification stores what happened to a claimed notification.
+func (b *Bot) finishNotification(n db.Notification, update FlightUpdate, ts string, sendErr error) {
+	n.Payload = payloadOf(update.Msg)
+	b.finish(n, ts, sendErr)
+}
+
+func (b *Bot) finish(n db.Notification, ts string, sendErr error) {
+	n.SlackTS = ts
+	n.Result = db.NotificationSent
+	n.SentAt = b.Clock.Now().UTC()
+	if sendErr != nil {
+		n.Result = db.NotificationFailed
+		n.Error = sendErr.Error()
+		n.SentAt = time.Time{}
+	}
+
+	if err := b.Store.FinishNotification(n); err != nil {
+		fmt.Println("Error recording notification result:", err)
+	}
+}
+
+func payloadOf(msg slack.SlackMessage) string {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return ""
+	}
+	return string(payload)
+}
+
+func runDumpNotifications(store db.Store, flightID string) int {
+	notifications, err := store.ListNotifications(flightID)
+	if err != nil {
+		fmt.Println("Error reading notifications:", err)
+		return 1
+	}
+	for _, n := range notifications {
+		line := fmt.Sprintf("%s %s %-13s %s %-7s ts=%s",
+			n.CreatedAt.UTC().Format(time.RFC3339),
+			n.DateDeparture,
+			n.Event,
+			n.Subscriber.Mention(),
+			n.Result,
+			n.SlackTS,
+		)
+		if n.Error != "" {
+			line += " error=" + n.Error
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("%d notifications\n", len(notifications))
+	return 0
+}
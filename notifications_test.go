@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"flight-tracker-slack/dates"
+	"flight-tracker-slack/db"
+)
+
+func TestNotificationKey(t *testing.T) {
+	flight := db.TrackedFlight{
+		FlightID:      "AFR6",
+		DateDeparture: dates.Date{Year: 2030, Month: time.January, Day: 2},
+		Subscriber:    db.ChannelSubscriber("U0123"),
+	}
+	dm := flight
+	dm.Subscriber = db.UserSubscriber("U0123")
+
+	channelKey := notificationKey(FlightUpdate{Flight: flight, Type: Takeoff})
+	dmKey := notificationKey(FlightUpdate{Flight: dm, Type: Takeoff})
+	if channelKey != "AFR6/2030-01-02//channel:U0123/takeoff" || dmKey != "AFR6/2030-01-02//user:U0123/takeoff" {
+		t.Errorf("keys = %q, %q", channelKey, dmKey)
+	}
+
+	// each cruise update is keyed by the one before it
+	first := notificationKey(FlightUpdate{Flight: dm, Type: Cruise})
+	dm.LastCruiseNotif = time.Date(2030, time.January, 2, 12, 0, 0, 0, time.UTC)
+	second := notificationKey(FlightUpdate{Flight: dm, Type: Cruise})
+	if first == second || second != "AFR6/2030-01-02//user:U0123/cruise/2030-01-02T12:00:00Z" {
+		t.Errorf("cruise keys = %q, %q", first, second)
+	}
+}
@@ -0,0 +1,675 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"flight-tracker-slack/dates"
+	"flight-tracker-slack/db"
+	"flight-tracker-slack/flightcode"
+	"flight-tracker-slack/i18n"
+	"flight-tracker-slack/maps"
+	"flight-tracker-slack/scraps"
+	"flight-tracker-slack/slack"
+	structs "flight-tracker-slack/types"
+)
+
+func (b *Bot) Run() {
+	b.pollFlights()
+	b.pruneSnapshots()
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+	prune := time.NewTicker(1 * time.Hour)
+	defer prune.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.pollFlights()
+		case <-prune.C:
+			b.pruneSnapshots()
+		}
+	}
+}
+
+// pruneSnapshots deletes the snapshots older than the retention.
+func (b *Bot) pruneSnapshots() {
+	pruned, err := b.Store.PruneSnapshots(b.Clock.Now().Add(-b.SnapshotRetention))
+	if err != nil {
+		fmt.Println("Error pruning snapshots:", err)
+		return
+	}
+	if pruned > 0 {
+		fmt.Printf("Pruned %d snapshots older than %s\n", pruned, b.SnapshotRetention)
+	}
+}
+
+func (b *Bot) pollFlights() {
+
+	fmt.Println("Polling tracked flights...")
+	polled := b.Clock.Now().UTC()
+	b.forgetInbound(polled)
+
+	flights, err := b.Store.ListFlights()
+	if err != nil {
+		fmt.Println("Error querying tracked flights:", err)
+		return
+	}
+
+	for _, f := range flights {
+		fmt.Printf("Tracked flight: %s departing on %s for %s %s\n", f.FlightID, f.DateDeparture, f.Subscriber.Kind, f.Subscriber.ID)
+	}
+
+	preferences, err := b.Store.ListPreferences()
+	if err != nil {
+		// better the default notifications than none
+		fmt.Println("Error querying preferences:", err)
+	}
+
+	watchers, err := b.Store.ListWatchers()
+	if err != nil {
+		fmt.Println("Error querying watchers:", err)
+	}
+
+	var updates []FlightUpdate
+	observed := map[legInstance]structs.FlightDetail{}
+
+	// fetch each flight once, however many channels and users follow it
+	for _, subscriptions := range db.GroupByFlight(flights) {
+
+		f := subscriptions[0]
+		legID, data := fetchFlightData(f)
+		if data.Airline.FullName == "" {
+			continue
+		}
+
+		if otherInstance(f, data) {
+			fmt.Printf("Skipping flight %s: FlightAware shows the %s departure\n", f.FlightID, departureDay(data))
+			continue
+		}
+
+		// only what we based this subscription's notifications on
+		err := b.Store.SaveSnapshot(db.Snapshot{
+			FlightID:      f.FlightID,
+			DateDeparture: f.DateDeparture,
+			LegID:         legID,
+			ObservedAt:    b.Clock.Now(),
+			Provider:      scraps.ProviderName,
+			Detail:        data,
+		})
+		if err != nil {
+			fmt.Println("Error saving snapshot:", err)
+		}
+
+		now := b.Clock.Now().UTC()
+		if !f.IsAircraft() {
+			observed[instanceOf(f.FlightID, f.DateDeparture)] = data
+		}
+
+		if history, ok := historyOf(f, data, now); ok {
+			if err := b.Store.SaveHistory(history); err != nil {
+				fmt.Println("Error saving flight history:", err)
+			}
+		}
+
+		var inbound structs.FlightDetail
+		if inboundCheckDue(data, now) && anyInboundPending(subscriptions) {
+			inbound = b.inboundLeg(data, polled)
+		}
+
+		for _, f := range subscriptions {
+			if f.IsAircraft() && legID != f.CurrentLeg {
+				// the airframe started a new leg, start over with its notifications
+				f = b.startNewLeg(f, legID)
+			}
+
+			p := db.ResolvePreferences(preferences, f)
+			watching := db.WatchersOf(watchers, f)
+			if len(watching) > 0 {
+				p = p.Watched()
+			}
+
+			if update, ok := b.checkInbound(f, data, inbound, *p.Locale); ok {
+				if update, ok := screen(update, p, now); ok {
+					updates = append(updates, update)
+				}
+			}
+
+			if update, ok := b.decideUpdate(f, data, now, p); ok {
+				update = mentionWatchers(update, watching)
+				if update, ok := screen(update, p, now); ok {
+					updates = append(updates, update)
+				}
+			}
+		}
+
+		fmt.Printf("Checked flight %s: status=%s\n", f.FlightID, data.FlightStatus)
+	}
+
+	for _, update := range updates {
+		fmt.Printf("Sending update for flight %s to %s: type=%d\n", update.Flight.FlightID, update.Flight.Subscriber.ID, update.Type)
+		b.updateFlightStatus(update)
+	}
+
+	b.checkConnections(flights, observed, preferences)
+}
+
+// decideUpdate picks the notification, if any, that the latest data calls for.
+// It has no side effects so it can be replayed against recorded snapshots.
+// p is the subscription's resolved preferences.
+func (b *Bot) decideUpdate(f db.TrackedFlight, data structs.FlightDetail, now time.Time, p db.Preferences) (FlightUpdate, bool) {
+	label := flightLabel(f, data)
+	locale := *p.Locale
+
+	diff := data.GetSchedule().DepartureScheduled.Sub(now)
+	untilArrival := firstTime(data.GetSchedule().ArrivalEstimated, data.GetSchedule().ArrivalScheduled).Sub(now)
+	preDeparture, preArrival := *p.PreDeparture, *p.PreArrival
+
+	switch {
+	case !f.NotifiedPreDeparture && diff <= preDeparture && diff > 0:
+		blocks := []any{
+			map[string]any{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": locale.T("notify.pre_departure", label, data.Origin.Iata, data.Destination.Iata, int(preDeparture.Minutes())),
+				},
+			},
+			map[string]any{
+				"type": "divider",
+			},
+			map[string]any{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": locale.T("notify.terminal_gate", data.Origin.Terminal, data.Origin.Gate),
+				},
+			},
+		}
+		return newFlightUpdate(f, PreDeparture, blocks), true
+	case !f.NotifiedTakeoff && data.FlightStatus == "airborne":
+
+		var delayTime = data.GetSchedule().DepartureActual.Sub(data.GetSchedule().DepartureScheduled)
+		var delayNote string
+		if delayTime > 0 {
+			delayNote = "\n" + locale.T("notify.takeoff_delay", locale.Duration(delayTime.Truncate(time.Minute)))
+		} else {
+			delayNote = ""
+		}
+
+		arrivalEstimated := data.GetSchedule().ArrivalEstimated
+
+		blocks := []any{
+			map[string]any{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": locale.T(
+						"notify.takeoff",
+						label,
+						locale.TimeAndDay(arrivalEstimated),
+						locale.Float(arrivalEstimated.Sub(now).Truncate(time.Minute).Hours(), 1),
+						delayNote,
+					),
+				},
+			},
+			map[string]any{
+				"type": "divider",
+			},
+			map[string]any{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": locale.T("notify.aircraft", data.Aircraft.FriendlyType),
+				},
+			},
+		}
+		return newFlightUpdate(f, Takeoff, blocks), true
+	case !f.NotifiedLanding && data.FlightStatus == "arrived":
+
+		delayTime := data.GetSchedule().ArrivalActual.Sub(data.GetSchedule().ArrivalScheduled)
+		var delayNote string
+		if delayTime > 0 {
+			delayNote = "\n" + locale.T("notify.landing_delay", locale.Duration(delayTime.Truncate(time.Minute)))
+		} else {
+			delayNote = ""
+		}
+
+		var gate = data.Destination.Gate
+		if gate == "" {
+			gate = locale.T("notify.unknown")
+		}
+		var terminal = data.Destination.Terminal
+		if terminal == "" {
+			terminal = locale.T("notify.unknown")
+		}
+
+		blocks := []any{
+			map[string]any{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": locale.T("notify.landing", label, delayNote),
+				},
+			},
+			map[string]any{
+				"type": "divider",
+			},
+			map[string]any{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": locale.T("notify.arrived_terminal_gate", terminal, gate),
+				},
+			},
+		}
+		return newFlightUpdate(f, Landing, blocks), true
+	case !f.NotifiedPreArrival && data.FlightStatus == "airborne" && untilArrival <= preArrival && untilArrival > 0:
+
+		arrival := now.Add(untilArrival).In(data.Destination.Location())
+
+		var gate = data.Destination.Gate
+		if gate == "" {
+			gate = locale.T("notify.unknown")
+		}
+		var terminal = data.Destination.Terminal
+		if terminal == "" {
+			terminal = locale.T("notify.unknown")
+		}
+
+		blocks := []any{
+			map[string]any{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": locale.T("notify.pre_arrival", label, data.Destination.Iata, int(preArrival.Minutes()), locale.Time(arrival)),
+				},
+			},
+			map[string]any{
+				"type": "divider",
+			},
+			map[string]any{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": locale.T("notify.arriving_terminal_gate", terminal, gate),
+				},
+			},
+		}
+		return newFlightUpdate(f, PreArrival, blocks), true
+	case data.FlightStatus == "airborne" && f.NotifiedTakeoff && cruiseDue(f, data, now, *p.CruiseEvery):
+
+		arrivalTime := data.GetSchedule().ArrivalEstimated
+
+		blocks := []any{
+			map[string]any{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": locale.T("notify.cruise", label, locale.Int(data.Groundspeed), locale.Int(data.Distance.Remaining)),
+				},
+			},
+			map[string]any{
+				"type": "divider",
+			},
+			map[string]any{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": locale.T("notify.cruise_arrival", locale.Time(arrivalTime), locale.Float(arrivalTime.Sub(now).Hours(), 1)),
+				},
+			},
+		}
+		update := newFlightUpdate(f, Cruise, blocks)
+		if *p.Maps {
+			update.Data = data
+		}
+		return update, true
+	}
+
+	return FlightUpdate{}, false
+}
+
+// mentionWatchers pings the users watching a subscription on the updates
+// about its arrival, the ones someone waiting at the airport cares about.
+func mentionWatchers(update FlightUpdate, watchers []string) FlightUpdate {
+	if len(watchers) == 0 || (update.Type != PreArrival && update.Type != Landing) {
+		return update
+	}
+	var mentions []string
+	for _, user := range watchers {
+		mentions = append(mentions, "<@"+user+">")
+	}
+	update.Msg.Blocks = append(update.Msg.Blocks, map[string]any{
+		"type": "context",
+		"elements": []any{
+			map[string]string{
+				"type": "mrkdwn",
+				"text": "👋 " + strings.Join(mentions, " "),
+			},
+		},
+	})
+	return update
+}
+
+// cruiseDue reports whether the next cruise update is due: every interval,
+// or with an interval of 0, each time the flight passes another quarter of
+// its duration.
+func cruiseDue(f db.TrackedFlight, data structs.FlightDetail, now time.Time, every time.Duration) bool {
+	if every > 0 {
+		return now.Sub(f.LastCruiseNotif) >= every
+	}
+	return milestone(data, now) > milestone(data, f.LastCruiseNotif)
+}
+
+// milestone is how many quarters of the flight are behind it at t, from
+// takeoff to the estimated arrival. It stops at 3, arriving is the landing
+// notification's job.
+func milestone(data structs.FlightDetail, t time.Time) int {
+	schedule := data.GetSchedule()
+	off := firstTime(data.TakeoffTimes.ToTime(data.TakeoffTimes.Actual), schedule.DepartureActual)
+	arrival := firstTime(schedule.ArrivalEstimated, schedule.ArrivalScheduled)
+	if off.IsZero() || !arrival.After(off) || t.Before(off) {
+		return 0
+	}
+	return min(int(4*t.Sub(off)/arrival.Sub(off)), 3)
+}
+
+// screen applies a subscriber's preferences to an update. Updates wait
+// while it is quiet hours for the subscriber, and events it turned off are
+// marked as handled without being sent.
+func screen(update FlightUpdate, p db.Preferences, now time.Time) (FlightUpdate, bool) {
+	if p.IsQuiet(now) {
+		fmt.Printf("Holding %s for %s %s: quiet hours\n", update.Type, update.Flight.FlightID, update.Flight.Subscriber.ID)
+		return update, false
+	}
+	update.Silent = !p.Notifies(update.Type.String())
+	return update, true
+}
+
+func (b *Bot) updateFlightStatus(update FlightUpdate) {
+	if update.Silent {
+		if err := b.recordUpdate(update); err != nil {
+			fmt.Println("Error updating flight status:", err)
+			return
+		}
+		b.retireLanded(update)
+		return
+	}
+
+	notification, claimed := b.claimNotification(update)
+	if !claimed {
+		// sent already, but the state may not have been saved after it
+		if b.handled(notification) {
+			b.catchUp(update)
+		}
+		return
+	}
+
+	if update.Data.Airline.FullName != "" {
+		if err := attachMap(&update); err != nil {
+			// try again on the next poll
+			fmt.Println("Error attaching map:", err)
+			b.finishNotification(notification, update, "", err)
+			return
+		}
+	}
+
+	// the state is only saved once the message is out, so a failed post
+	// leaves the event to be decided, and claimed, again on the next poll
+	ts, err := slack.PostTo(update.Flight.Subscriber, update.Msg, b.SlackToken)
+	b.finishNotification(notification, update, ts, err)
+	if err != nil {
+		fmt.Println("Slack error:", err)
+		return
+	}
+
+	if err := b.recordUpdate(update); err != nil {
+		fmt.Println("Error updating flight status:", err)
+		slack.PostTo(update.Flight.Subscriber, slack.SlackMessage{
+			Text: b.localeOf(update.Flight.Subscriber).T("notify.save_error", update.Flight.FlightID, err),
+		}, b.SlackToken)
+		return
+	}
+
+	b.retireLanded(update)
+}
+
+// catchUp saves the state of an update that was sent before but not
+// recorded, so the poller moves on from it.
+func (b *Bot) catchUp(update FlightUpdate) {
+	if err := b.recordUpdate(update); err != nil {
+		fmt.Println("Error updating flight status:", err)
+		return
+	}
+	b.retireLanded(update)
+}
+
+// recordUpdate persists the notification state an update leaves behind.
+func (b *Bot) recordUpdate(update FlightUpdate) error {
+	return b.Store.SaveFlightState(applyUpdate(update.Flight, update.Type, b.Clock.Now().UTC()))
+}
+
+// retireLanded ends a subscription once its landing was announced, the
+// flight goes with the last one. Airframes stay tracked and pick up their
+// next leg.
+func (b *Bot) retireLanded(update FlightUpdate) {
+	if update.Type != Landing || update.Flight.IsAircraft() {
+		return
+	}
+	err := b.Store.Unsubscribe(update.Flight)
+	if err != nil {
+		b.sendSimpleSlack(update.Flight, b.localeOf(update.Flight.Subscriber).T("notify.remove_error", update.Flight.FlightID, err))
+		fmt.Println("Error removing landed flight:", err)
+	}
+}
+
+type UpdateType int
+
+const (
+	PreDeparture UpdateType = iota // 0
+	Takeoff                        // 1
+	Landing                        // 2
+	Cruise                         // 3
+	InboundLate                    // 4
+	PreArrival                     // 5
+)
+
+func (t UpdateType) String() string {
+	switch t {
+	case PreDeparture:
+		return "pre_departure"
+	case Takeoff:
+		return "takeoff"
+	case Landing:
+		return "landing"
+	case Cruise:
+		return "cruise"
+	case InboundLate:
+		return "inbound_late"
+	case PreArrival:
+		return "pre_arrival"
+	}
+	return fmt.Sprintf("unknown(%d)", int(t))
+}
+
+type FlightUpdate struct {
+	Flight db.TrackedFlight
+	Type   UpdateType
+	Msg    slack.SlackMessage
+	// Data is only set on updates that need a map
+	Data structs.FlightDetail
+	// Silent updates are recorded as sent without sending anything, the
+	// subscriber turned the event off
+	Silent bool
+}
+
+func newFlightUpdate(flight db.TrackedFlight, updateType UpdateType, blocks []any) FlightUpdate {
+	return FlightUpdate{
+		Flight: flight,
+		Type:   updateType,
+		Msg: slack.SlackMessage{
+			Channel: flight.Subscriber.ID,
+			Blocks:  blocks,
+		},
+	}
+}
+
+// attachMap renders the aircraft's current position and adds it under the
+// first block of the message.
+func attachMap(update *FlightUpdate) error {
+	flightMapURL, err := maps.UploadAircraftMap(update.Data)
+	if err != nil {
+		return err
+	}
+
+	image := map[string]any{
+		"type":      "image",
+		"image_url": flightMapURL,
+		"alt_text":  "Aircraft Position Map",
+	}
+	blocks := update.Msg.Blocks
+	update.Msg.Blocks = append([]any{blocks[0], image}, blocks[1:]...)
+	return nil
+}
+
+func fetchFlightData(f db.TrackedFlight) (string, structs.FlightDetail) {
+	var wrapper structs.FlightDataWrapper
+	var err error
+	switch flightcode.Kind(f.Kind) {
+	case flightcode.KindRegistration:
+		wrapper, err = scraps.GetAircraftInfo(context.Background(), f.FlightID)
+	case flightcode.KindHex:
+		wrapper, err = scraps.GetAircraftInfoByHex(context.Background(), f.FlightID)
+	default:
+		wrapper, err = scraps.GetFlightInfo(context.Background(), f.FlightID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, scraps.ErrCircuitOpen):
+			fmt.Printf("Skipping flight %s: %v\n", f.FlightID, err)
+		case errors.Is(err, scraps.ErrNotFound):
+			fmt.Printf("Flight %s not found on FlightAware\n", f.FlightID)
+		default:
+			fmt.Printf("Error fetching flight info for %s: %v\n", f.FlightID, err)
+		}
+		return "", structs.FlightDetail{}
+	}
+
+	for k, v := range wrapper.Flights {
+		return k, v
+	}
+	return "", structs.FlightDetail{}
+}
+
+// otherInstance reports whether flightaware is showing another day's
+// departure of a tracked flight number, like yesterday's flight still
+// airborne, rather than the one we track.
+func otherInstance(f db.TrackedFlight, data structs.FlightDetail) bool {
+	if f.IsAircraft() || data.GetSchedule().DepartureScheduled.IsZero() {
+		return false
+	}
+	return departureDay(data) != f.DateDeparture
+}
+
+// departureDay is the scheduled departure's calendar day at the origin.
+func departureDay(data structs.FlightDetail) dates.Date {
+	return dates.Of(data.GetSchedule().DepartureScheduled, data.Origin.Location())
+}
+
+func (b *Bot) startNewLeg(f db.TrackedFlight, legID string) db.TrackedFlight {
+	next := f.NewLeg(legID)
+	if err := b.Store.SaveFlightState(next); err != nil {
+		fmt.Println("Error starting new leg:", err)
+	}
+
+	fmt.Printf("Aircraft %s started leg %s\n", f.FlightID, legID)
+	return next
+}
+
+// applyUpdate is the flight's notification state once an update was sent.
+func applyUpdate(f db.TrackedFlight, t UpdateType, now time.Time) db.TrackedFlight {
+	switch t {
+	case PreDeparture:
+		f.NotifiedPreDeparture = true
+	case Takeoff:
+		f.NotifiedTakeoff = true
+		f.LastCruiseNotif = now
+	case Landing:
+		f.NotifiedLanding = true
+	case Cruise:
+		f.LastCruiseNotif = now
+	case InboundLate:
+		f.NotifiedInboundLate = true
+	case PreArrival:
+		f.NotifiedPreArrival = true
+	}
+	return f
+}
+
+// flightLabel is how the flight is named in messages. Airframes also show
+// the flight they are currently operating.
+func flightLabel(f db.TrackedFlight, data structs.FlightDetail) string {
+	if !f.IsAircraft() || data.Ident == "" {
+		return f.FlightID
+	}
+	return fmt.Sprintf("%s (%s)", f.FlightID, data.Ident)
+}
+
+func fetchInboundData(ref *structs.InboundFlight) structs.FlightDetail {
+	wrapper, err := scraps.GetFlightInfoByID(context.Background(), ref.FlightID)
+	if err != nil {
+		fmt.Printf("Error fetching inbound flight %s: %v\n", ref.Ident, err)
+		return structs.FlightDetail{}
+	}
+
+	if v, ok := wrapper.Flights[ref.FlightID]; ok {
+		return v
+	}
+	for _, v := range wrapper.Flights {
+		return v
+	}
+	return structs.FlightDetail{}
+}
+
+func (b *Bot) sendSimpleSlack(f db.TrackedFlight, msg string) {
+	blocks := []any{
+		map[string]any{
+			"type": "section",
+			"text": map[string]string{
+				"type": "mrkdwn",
+				"text": msg,
+			},
+		},
+	}
+	_, err := slack.PostTo(f.Subscriber, slack.SlackMessage{Blocks: blocks}, b.SlackToken)
+	if err != nil {
+		fmt.Println("Slack error:", err)
+	}
+}
+
+// localeOf is the language of a subscriber, for the few messages sent
+// without its preferences at hand.
+func (b *Bot) localeOf(subscriber db.Subscriber) i18n.Locale {
+	preferences, err := b.Store.ListPreferences()
+	if err != nil {
+		fmt.Println("Error querying preferences:", err)
+	}
+	return *db.ResolvePreferences(preferences, db.TrackedFlight{Subscriber: subscriber}).Locale
+}
+
+// notifyAdmin posts the catalog message key to the admin channel, in its
+// language.
+func (b *Bot) notifyAdmin(key string, args ...any) {
+	msg := b.localeOf(db.ChannelSubscriber(b.AdminChannel)).T(key, args...)
+	fmt.Println("Admin:", msg)
+	if b.AdminChannel == "" {
+		return
+	}
+	err := slack.SendSlackMessage(b.AdminChannel, b.SlackToken, msg, nil)
+	if err != nil {
+		fmt.Println("Slack error:", err)
+	}
+}
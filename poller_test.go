@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"flight-tracker-slack/dates"
+	"flight-tracker-slack/db"
+)
+
+// roundTripFunc answers the bot's Slack API calls in tests.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// stubSlack makes every Slack call return body and counts the calls.
+func stubSlack(t *testing.T, body string) *int {
+	t.Helper()
+	calls := new(int)
+	previous := http.DefaultClient.Transport
+	http.DefaultClient.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		*calls++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     http.Header{},
+		}, nil
+	})
+	t.Cleanup(func() { http.DefaultClient.Transport = previous })
+	return calls
+}
+
+func newTestBot(t *testing.T, f db.TrackedFlight) (*Bot, *db.MemoryStore) {
+	t.Helper()
+	store := db.NewMemoryStore()
+	if _, err := store.AddFlight(f); err != nil {
+		t.Fatal(err)
+	}
+	clock := &simClock{}
+	clock.Set(time.Date(2030, time.January, 2, 18, 0, 0, 0, time.UTC))
+	return &Bot{Store: store, Clock: clock}, store
+}
+
+func landingUpdate(f db.TrackedFlight) FlightUpdate {
+	return newFlightUpdate(f, Landing, []any{
+		map[string]any{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": "landed"}},
+	})
+}
+
+func lastNotification(t *testing.T, store db.Store, flightID string) db.Notification {
+	t.Helper()
+	notifications, err := store.ListNotifications(flightID)
+	if err != nil || len(notifications) == 0 {
+		t.Fatalf("ListNotifications = %d, %v", len(notifications), err)
+	}
+	return notifications[len(notifications)-1]
+}
+
+func TestFailedPostIsRetried(t *testing.T) {
+	f := db.TrackedFlight{
+		FlightID:      "AFR6",
+		DateDeparture: dates.Date{Year: 2030, Month: time.January, Day: 2},
+		Kind:          "flight",
+		Subscriber:    db.ChannelSubscriber("CTEAM"),
+	}
+	bot, store := newTestBot(t, f)
+
+	stubSlack(t, `{"ok":false,"error":"channel_not_found"}`)
+	bot.updateFlightStatus(landingUpdate(f))
+
+	if n := lastNotification(t, store, "AFR6"); n.Result != db.NotificationFailed {
+		t.Fatalf("notification after a failed post = %s, want failed", n.Result)
+	}
+	found, _ := store.FindSubscriptions("AFR6")
+	if len(found) != 1 || found[0].NotifiedLanding {
+		t.Fatalf("after a failed post, subscriptions = %+v, want one not notified of the landing", found)
+	}
+
+	// the next poll decides the same landing and sends it this time
+	stubSlack(t, `{"ok":true,"ts":"1893600000.000100"}`)
+	bot.updateFlightStatus(landingUpdate(found[0]))
+
+	if n := lastNotification(t, store, "AFR6"); n.Result != db.NotificationSent || n.SlackTS == "" {
+		t.Errorf("notification after the retry = %+v, want sent", n)
+	}
+	if found, _ := store.FindSubscriptions("AFR6"); len(found) != 0 {
+		t.Errorf("landed flight still tracked: %+v", found)
+	}
+}
+
+func TestSentUpdateCatchesUpState(t *testing.T) {
+	f := db.TrackedFlight{
+		FlightID:      "AFR6",
+		DateDeparture: dates.Date{Year: 2030, Month: time.January, Day: 2},
+		Kind:          "flight",
+		Subscriber:    db.ChannelSubscriber("CTEAM"),
+	}
+	bot, store := newTestBot(t, f)
+
+	// sent by an earlier poll that stopped before saving the state
+	update := landingUpdate(f)
+	n, claimed := bot.claimNotification(update)
+	if !claimed {
+		t.Fatal("could not claim the first notification")
+	}
+	bot.finish(n, "1893600000.000100", nil)
+
+	calls := stubSlack(t, `{"ok":true,"ts":"1893600000.000200"}`)
+	bot.updateFlightStatus(update)
+
+	if *calls != 0 {
+		t.Errorf("landing posted again, %d Slack calls", *calls)
+	}
+	if found, _ := store.FindSubscriptions("AFR6"); len(found) != 0 {
+		t.Errorf("landed flight still tracked: %+v", found)
+	}
+}
+
+func TestMentionWatchers(t *testing.T) {
+	f := db.TrackedFlight{FlightID: "AFR6", Subscriber: db.ChannelSubscriber("CTEAM")}
+	update := func(kind UpdateType) FlightUpdate {
+		return newFlightUpdate(f, kind, []any{map[string]any{"type": "section"}})
+	}
+
+	for _, kind := range []UpdateType{PreArrival, Landing} {
+		got := mentionWatchers(update(kind), []string{"UWATCH1", "UWATCH2"})
+		if len(got.Msg.Blocks) != 2 || !strings.Contains(fmt.Sprint(got.Msg.Blocks[1]), "<@UWATCH1> <@UWATCH2>") {
+			t.Errorf("%s with watchers = %s", kind, payloadOf(got.Msg))
+		}
+	}
+	for _, kind := range []UpdateType{PreDeparture, Takeoff, Cruise} {
+		if got := mentionWatchers(update(kind), []string{"UWATCH1"}); len(got.Msg.Blocks) != 1 {
+			t.Errorf("%s mentions watchers: %s", kind, payloadOf(got.Msg))
+		}
+	}
+	if got := mentionWatchers(update(Landing), nil); len(got.Msg.Blocks) != 1 {
+		t.Errorf("landing without watchers = %s", payloadOf(got.Msg))
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"flight-tracker-slack/db"
+	"flight-tracker-slack/flightcode"
+	structs "flight-tracker-slack/types"
+)
+
+// replayFile is the on-disk format for -replay-file: a flight and the
+// observations the poller made of it, in order.
+type replayFile struct {
+	FlightID string       `json:"flight_id"`
+	Steps    []replayStep `json:"steps"`
+}
+
+type replayStep struct {
+	ObservedAt time.Time            `json:"observed_at"`
+	LegID      string               `json:"leg_id"`
+	Detail     structs.FlightDetail `json:"detail"`
+}
+
+type replayEvent struct {
+	At   time.Time
+	Type UpdateType
+	Msg  string
+}
+
+// replay runs the poller's decisions over recorded observations, moving a
+// simulated clock to each observation time and keeping state in a
+// MemoryStore. Nothing is fetched or sent.
+func (b *Bot) replay(flight db.TrackedFlight, steps []replayStep, prefs db.Preferences) []replayEvent {
+	clock := &simClock{}
+	store := db.NewMemoryStore()
+	b.Clock = clock
+	b.Store = store
+
+	if _, err := store.AddFlight(flight); err != nil {
+		fmt.Println("Error adding replayed flight:", err)
+		return nil
+	}
+
+	var events []replayEvent
+	for _, step := range steps {
+		clock.Set(step.ObservedAt)
+		now := clock.Now().UTC()
+
+		flights, _ := store.ListFlights()
+		if len(flights) == 0 {
+			// untracked after landing, like the real poller
+			break
+		}
+		f := flights[0]
+
+		if otherInstance(f, step.Detail) {
+			continue
+		}
+
+		if f.IsAircraft() && step.LegID != f.CurrentLeg {
+			f = b.startNewLeg(f, step.LegID)
+		}
+
+		update, ok := b.decideUpdate(f, step.Detail, now, prefs)
+		if ok {
+			update, ok = screen(update, prefs, now)
+		}
+		if !ok {
+			continue
+		}
+
+		if !update.Silent {
+			events = append(events, replayEvent{At: now, Type: update.Type, Msg: firstText(update.Msg.Blocks)})
+		}
+		if err := b.recordUpdate(update); err != nil {
+			fmt.Println("Error recording replayed update:", err)
+		}
+		b.retireLanded(update)
+	}
+	return events
+}
+
+func runReplay(databaseURL string, flightID string, path string, prefsOption string) int {
+	prefs, err := replayPreferences(prefsOption)
+	if err != nil {
+		fmt.Println("Invalid -prefs:", err)
+		return 1
+	}
+
+	var steps []replayStep
+
+	if path != "" {
+		file, err := readReplayFile(path)
+		if err != nil {
+			fmt.Println("Error reading replay file:", err)
+			return 1
+		}
+		flightID = file.FlightID
+		steps = file.Steps
+	} else {
+		snapshots, err := initDB(databaseURL).ListSnapshots(flightID)
+		if err != nil {
+			fmt.Println("Error reading snapshots:", err)
+			return 1
+		}
+		for _, s := range snapshots {
+			steps = append(steps, replayStep{ObservedAt: s.ObservedAt, LegID: s.LegID, Detail: s.Detail})
+		}
+	}
+
+	flight := replayedFlight(flightID, steps)
+	bot := &Bot{MinTurnaround: envMinutes("MIN_TURNAROUND_MINUTES", 45)}
+	events := bot.replay(flight, steps, db.ResolvePreferences([]db.Preferences{prefs}, flight))
+
+	for _, e := range events {
+		fmt.Printf("%s %-13s %s\n", e.At.Format(time.RFC3339), e.Type, e.Msg)
+	}
+	fmt.Printf("%d steps, %d notifications\n", len(steps), len(events))
+	return 0
+}
+
+func readReplayFile(path string) (replayFile, error) {
+	var file replayFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, err
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return file, fmt.Errorf("invalid replay file: %w", err)
+	}
+	return file, nil
+}
+
+// replayedFlight is the subscription a replay follows: the departure day
+// of the first observation, like /track without a date.
+func replayedFlight(flightID string, steps []replayStep) db.TrackedFlight {
+	kind := flightcode.KindFlight
+	var ambiguous *flightcode.AmbiguousError
+	if target, err := flightcode.ParseTarget(flightID); err == nil {
+		kind = target.Kind
+	} else if errors.As(err, &ambiguous) && ambiguous.Flight == "" {
+		// addresses are recorded without their hex: prefix
+		kind = flightcode.KindHex
+	}
+
+	flight := db.TrackedFlight{FlightID: flightID, Kind: string(kind)}
+	if len(steps) > 0 {
+		flight.DateDeparture = departureDay(steps[0].Detail)
+	}
+	return flight
+}
+
+// replayPreferences reads -prefs, space-separated options like
+// "notify=takeoff,landing cruise=milestones", into the preferences of the
+// replayed subscription.
+func replayPreferences(option string) (db.Preferences, error) {
+	var prefs db.Preferences
+	for _, field := range strings.Fields(option) {
+		name, value, _ := strings.Cut(field, "=")
+		if err := prefs.Set(name, value); err != nil {
+			return prefs, err
+		}
+	}
+	return prefs, nil
+}
+
+func firstText(blocks []any) string {
+	for _, block := range blocks {
+		m, ok := block.(map[string]any)
+		if !ok {
+			continue
+		}
+		if text, ok := m["text"].(map[string]string); ok {
+			return strings.ReplaceAll(text["text"], "\n", " ")
+		}
+	}
+	return ""
+}
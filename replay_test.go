@@ -0,0 +1,54 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"flight-tracker-slack/db"
+)
+
+func TestReplay(t *testing.T) {
+	file, err := readReplayFile("testdata/replay/afr6.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flight := replayedFlight(file.FlightID, file.Steps)
+
+	tests := []struct {
+		prefs string
+		want  []string
+		// when the first notification goes out, HH:MM UTC
+		first string
+	}{
+		{"", []string{"pre_departure", "takeoff", "cruise", "landing"}, "09:35"},
+		{"lead=8h", []string{"pre_departure", "takeoff", "cruise", "landing"}, "09:00"},
+		{"notify=all arrival-lead=8h", []string{"pre_departure", "takeoff", "pre_arrival", "cruise", "landing"}, "09:35"},
+		{"notify=takeoff,landing", []string{"takeoff", "landing"}, "10:40"},
+		{"cruise=milestones", []string{"pre_departure", "takeoff", "cruise", "landing"}, "09:35"},
+		// the pre-departure notification is too late once quiet hours end
+		{"quiet=09:00-11:00", []string{"takeoff", "landing"}, "12:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefs, func(t *testing.T) {
+			prefs, err := replayPreferences(tt.prefs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bot := &Bot{MinTurnaround: 45 * time.Minute}
+			events := bot.replay(flight, file.Steps, db.ResolvePreferences([]db.Preferences{prefs}, flight))
+
+			var got []string
+			for _, e := range events {
+				got = append(got, e.Type.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("notifications = %v, want %v", got, tt.want)
+			}
+			if first := events[0].At.UTC().Format("15:04"); first != tt.first {
+				t.Errorf("first notification at %s, want %s", first, tt.first)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package scraps
+
+import (
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // 0
+	BreakerOpen                         // 1
+	BreakerHalfOpen                     // 2
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker stops us from hammering flightaware once it starts blocking us or
+// falling over. After Threshold consecutive failures it opens for Cooldown,
+// then lets a single request through to decide whether to close again.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	onChange func(state BreakerState, lastErr error)
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+	}
+}
+
+// OnStateChange registers a callback fired (in its own goroutine) whenever the
+// breaker opens or closes.
+func (b *Breaker) OnStateChange(fn func(state BreakerState, lastErr error)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onChange = fn
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow reports whether a request may be made right now.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.Cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		return true
+	case BreakerHalfOpen:
+		// a probe is already in flight
+		return false
+	}
+	return true
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasOpen := b.state != BreakerClosed
+	b.state = BreakerClosed
+	b.failures = 0
+	if wasOpen {
+		b.notify(BreakerClosed, nil)
+	}
+}
+
+func (b *Breaker) Failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.Threshold) {
+		wasOpen := b.state != BreakerClosed
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		if !wasOpen {
+			b.notify(BreakerOpen, err)
+		}
+	}
+}
+
+// Cancel gives back a request allowed by Allow that was cancelled before
+// it told us anything: a half-open breaker goes back to open, still out of
+// its cooldown, so the next request probes again.
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+	}
+}
+
+func (b *Breaker) notify(state BreakerState, err error) {
+	if b.onChange != nil {
+		go b.onChange(state, err)
+	}
+}
@@ -0,0 +1,155 @@
+package scraps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	failure := errors.New("blocked")
+
+	// each step is done to the breaker in order, then its state checked
+	type step struct {
+		do    string
+		allow bool
+		state BreakerState
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"opens after threshold", []step{
+			{do: "failure", state: BreakerClosed},
+			{do: "failure", state: BreakerClosed},
+			{do: "allow", allow: true, state: BreakerClosed},
+			{do: "failure", state: BreakerOpen},
+			{do: "allow", allow: false, state: BreakerOpen},
+		}},
+		{"success resets the count", []step{
+			{do: "failure", state: BreakerClosed},
+			{do: "failure", state: BreakerClosed},
+			{do: "success", state: BreakerClosed},
+			{do: "failure", state: BreakerClosed},
+			{do: "failure", state: BreakerClosed},
+		}},
+		{"half-open after cooldown, one probe at a time", []step{
+			{do: "open", state: BreakerOpen},
+			{do: "wait", state: BreakerOpen},
+			{do: "allow", allow: true, state: BreakerHalfOpen},
+			{do: "allow", allow: false, state: BreakerHalfOpen},
+		}},
+		{"probe success closes", []step{
+			{do: "open", state: BreakerOpen},
+			{do: "wait", state: BreakerOpen},
+			{do: "allow", allow: true, state: BreakerHalfOpen},
+			{do: "success", state: BreakerClosed},
+			{do: "allow", allow: true, state: BreakerClosed},
+		}},
+		{"probe failure reopens", []step{
+			{do: "open", state: BreakerOpen},
+			{do: "wait", state: BreakerOpen},
+			{do: "allow", allow: true, state: BreakerHalfOpen},
+			{do: "failure", state: BreakerOpen},
+			{do: "allow", allow: false, state: BreakerOpen},
+		}},
+		{"cancelled probe", []step{
+			{do: "open", state: BreakerOpen},
+			{do: "wait", state: BreakerOpen},
+			{do: "allow", allow: true, state: BreakerHalfOpen},
+			{do: "cancel", state: BreakerOpen},
+			{do: "allow", allow: true, state: BreakerHalfOpen},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker(3, cooldown)
+			for i, s := range tt.steps {
+				switch s.do {
+				case "failure":
+					b.Failure(failure)
+				case "success":
+					b.Success()
+				case "cancel":
+					b.Cancel()
+				case "open":
+					for range b.Threshold {
+						b.Failure(failure)
+					}
+				case "wait":
+					time.Sleep(cooldown + 5*time.Millisecond)
+				case "allow":
+					if got := b.Allow(); got != s.allow {
+						t.Fatalf("step %d: Allow() = %v, want %v", i, got, s.allow)
+					}
+				}
+				if got := b.State(); got != s.state {
+					t.Fatalf("step %d (%s): state %s, want %s", i, s.do, got, s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerNotFoundIsSuccess(t *testing.T) {
+	previousBreaker, previousTransport := DefaultBreaker, httpClient.Transport
+	t.Cleanup(func() { DefaultBreaker, httpClient.Transport = previousBreaker, previousTransport })
+
+	DefaultBreaker = NewBreaker(1, 0)
+	DefaultBreaker.Failure(errors.New("blocked"))
+	httpClient.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody, Header: http.Header{}}, nil
+	})
+
+	if _, err := GetFlightInfo(context.Background(), "AFR0"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetFlightInfo error = %v, want not found", err)
+	}
+	if state := DefaultBreaker.State(); state != BreakerClosed {
+		t.Errorf("breaker %s after a not found probe, want closed", state)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&FetchError{Kind: ErrBlocked, URL: "u", StatusCode: 429}, true},
+		{&FetchError{Kind: ErrUpstream, URL: "u", StatusCode: 502}, true},
+		{fmt.Errorf("fetching: %w", &FetchError{Kind: ErrUpstream, URL: "u"}), true},
+		{&FetchError{Kind: ErrNotFound, URL: "u", StatusCode: 404}, false},
+		{&FetchError{Kind: ErrParseFailure, URL: "u"}, false},
+		{&FetchError{Kind: ErrCircuitOpen, URL: "u"}, false},
+		{context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, baseBackoff},
+		{2, 2 * baseBackoff},
+		{3, 4 * baseBackoff},
+		{10, maxBackoff},
+	}
+	for _, tt := range tests {
+		// half of it is jitter
+		for range 20 {
+			if d := backoff(tt.attempt); d < tt.base/2 || d >= tt.base {
+				t.Errorf("backoff(%d) = %s, want in [%s, %s)", tt.attempt, d, tt.base/2, tt.base)
+			}
+		}
+	}
+}
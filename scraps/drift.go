@@ -0,0 +1,190 @@
+package scraps
+
+import (
+	"encoding/json"
+	structs "flight-tracker-slack/types"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// requiredFields are the paths the poller can't work without. A missing one
+// would otherwise silently decode to a zero value.
+var requiredFields = []string{
+	"flightStatus",
+	"airline",
+	"aircraft",
+	"origin",
+	"origin.TZ",
+	"destination",
+	"destination.TZ",
+	"gateDepartureTimes.scheduled",
+	"gateArrivalTimes.scheduled",
+}
+
+// ignoredFields are sent by flightaware on every flight but we don't use
+// them. Anything that is neither here nor in structs.FlightDetail is new.
+var ignoredFields = []string{
+	"adhoc",
+	"altitudeChange",
+	"atcIdent",
+	"blocked",
+	"codeShare",
+	"coord",
+	"encryptedFlightId",
+	"flightId",
+	"fpasAvailable",
+	"friendlyIdent",
+	"fruOverride",
+	"ga",
+	"globalIdent",
+	"hexid",
+	"interactiveMap",
+	"links",
+	"permaLink",
+	"poweredOff",
+	"predictedAvailable",
+	"predictedTimes",
+	"redirectUrl",
+	"resultUnknown",
+	"roundedTimestamp",
+	"taxiIn",
+	"taxiOut",
+	"thumbnail",
+	"useSeoTitle",
+	"waypoints",
+}
+
+var knownFields = func() map[string]bool {
+	known := map[string]bool{}
+	t := reflect.TypeOf(structs.FlightDetail{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := jsonName(t.Field(i)); name != "" {
+			known[name] = true
+		}
+	}
+	for _, name := range ignoredFields {
+		known[name] = true
+	}
+	return known
+}()
+
+type DriftReport struct {
+	Unknown []string
+	Missing []string
+}
+
+func (r DriftReport) Empty() bool {
+	return len(r.Unknown) == 0 && len(r.Missing) == 0
+}
+
+func (r DriftReport) String() string {
+	var parts []string
+	if len(r.Missing) > 0 {
+		parts = append(parts, "missing required fields: "+strings.Join(r.Missing, ", "))
+	}
+	if len(r.Unknown) > 0 {
+		parts = append(parts, "unknown fields: "+strings.Join(r.Unknown, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// CheckSchema compares a raw trackpollBootstrap payload against the fields we
+// know about.
+func CheckSchema(bootstrap []byte) DriftReport {
+	var raw struct {
+		Flights map[string]map[string]json.RawMessage `json:"flights"`
+	}
+	if err := json.Unmarshal(bootstrap, &raw); err != nil {
+		return DriftReport{Missing: []string{"flights"}}
+	}
+
+	unknown := map[string]bool{}
+	missing := map[string]bool{}
+
+	for _, flight := range raw.Flights {
+		for key := range flight {
+			if !knownFields[key] {
+				unknown[key] = true
+			}
+		}
+		for _, path := range requiredFields {
+			if !hasPath(flight, strings.Split(path, ".")) {
+				missing[path] = true
+			}
+		}
+	}
+
+	return DriftReport{
+		Unknown: sortedKeys(unknown),
+		Missing: sortedKeys(missing),
+	}
+}
+
+func hasPath(obj map[string]json.RawMessage, path []string) bool {
+	value, ok := obj[path[0]]
+	if !ok || string(value) == "null" {
+		return false
+	}
+	if len(path) == 1 {
+		return true
+	}
+	var child map[string]json.RawMessage
+	if err := json.Unmarshal(value, &child); err != nil {
+		return false
+	}
+	return hasPath(child, path[1:])
+}
+
+var (
+	driftMu   sync.Mutex
+	driftSeen = map[string]bool{}
+	driftHook func(DriftReport)
+)
+
+// OnSchemaDrift registers a callback for drift reports. Each distinct report
+// is only delivered once per process so a changed page doesn't flood the logs.
+func OnSchemaDrift(fn func(DriftReport)) {
+	driftMu.Lock()
+	defer driftMu.Unlock()
+	driftHook = fn
+}
+
+func reportDrift(report DriftReport) {
+	driftMu.Lock()
+	defer driftMu.Unlock()
+
+	key := report.String()
+	if driftSeen[key] {
+		return
+	}
+	driftSeen[key] = true
+
+	fmt.Println("FlightAware schema drift:", key)
+	if driftHook != nil {
+		go driftHook(report)
+	}
+}
+
+func jsonName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
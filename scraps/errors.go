@@ -0,0 +1,52 @@
+package scraps
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotFound     = errors.New("flight not found")
+	ErrBlocked      = errors.New("blocked by flightaware")
+	ErrParseFailure = errors.New("could not parse flightaware page")
+	ErrUpstream     = errors.New("flightaware upstream error")
+	ErrCircuitOpen  = errors.New("scraping paused after repeated failures")
+)
+
+// FetchError wraps one of the sentinel errors above with the details of the
+// request that failed, so callers can use errors.Is and still log something useful.
+type FetchError struct {
+	Kind       error
+	URL        string
+	StatusCode int
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	msg := e.Kind.Error()
+	if e.StatusCode != 0 {
+		msg = fmt.Sprintf("%s (status %d)", msg, e.StatusCode)
+	}
+	switch {
+	case e.Err == nil:
+	case errors.Is(e.Err, e.Kind):
+		// already carries the kind in its message
+		msg = e.Err.Error()
+	default:
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+	return msg + " [" + e.URL + "]"
+}
+
+func (e *FetchError) Is(target error) bool {
+	return e.Kind == target
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// retryable reports whether another attempt has a chance of succeeding.
+func retryable(err error) bool {
+	return errors.Is(err, ErrBlocked) || errors.Is(err, ErrUpstream)
+}
@@ -1,11 +1,16 @@
 package scraps
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	structs "flight-tracker-slack/types"
+	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"regexp"
+	"strings"
 	"time"
 )
 
@@ -15,6 +20,15 @@ const (
 	KtToMph float64 = 1.15078
 )
 
+// ProviderName is recorded with every snapshot taken from this package.
+const ProviderName = "flightaware"
+
+const (
+	maxAttempts = 3
+	baseBackoff = 2 * time.Second
+	maxBackoff  = 30 * time.Second
+)
+
 func unixToTime(timestamp int64) time.Time {
 	if timestamp == 0 {
 		return time.Time{}
@@ -24,49 +38,176 @@ func unixToTime(timestamp int64) time.Time {
 
 var dataRegex = regexp.MustCompile(`trackpollBootstrap = (\{.*?\});`)
 
-func GetFlightInfo(flightNumber string) (structs.FlightDataWrapper, error) {
-	// create a http client with timeout
+// DefaultBreaker guards every request made to flightaware.
+var DefaultBreaker = NewBreaker(5, 10*time.Minute)
+
+var httpClient = &http.Client{
+	Timeout: 100 * time.Second,
+}
+
+func GetFlightInfo(ctx context.Context, flightNumber string) (structs.FlightDataWrapper, error) {
+	return getFlightPage(ctx, "https://fr.flightaware.com/live/flight/"+flightNumber, flightNumber)
+}
+
+// GetFlightInfoByID fetches one specific leg using flightaware's own flight
+// id, as found in structs.InboundFlight.
+func GetFlightInfoByID(ctx context.Context, faFlightID string) (structs.FlightDataWrapper, error) {
+	return getFlightPage(ctx, "https://fr.flightaware.com/live/flight/id/"+faFlightID, faFlightID)
+}
+
+// GetAircraftInfo fetches whatever flight the aircraft with this tail number
+// is currently flying, or flew last.
+func GetAircraftInfo(ctx context.Context, registration string) (structs.FlightDataWrapper, error) {
+	return getFlightPage(ctx, "https://fr.flightaware.com/live/flight/"+registration, registration)
+}
+
+// GetAircraftInfoByHex does the same from the 24-bit ICAO transponder address.
+func GetAircraftInfoByHex(ctx context.Context, hex string) (structs.FlightDataWrapper, error) {
+	return getFlightPage(ctx, "https://fr.flightaware.com/live/modes/"+strings.ToLower(hex)+"/redirect", hex)
+}
+
+// getFlightPage fetches and parses a page, retrying until ctx is done. A
+// request cancelled with ctx says nothing about flightaware's health and
+// is left out of the breaker.
+func getFlightPage(ctx context.Context, url string, label string) (structs.FlightDataWrapper, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff(attempt)):
+			case <-ctx.Done():
+				return structs.FlightDataWrapper{}, ctx.Err()
+			}
+		}
 
-	client := &http.Client{
-		Timeout: 100 * time.Second,
+		if ctx.Err() != nil {
+			return structs.FlightDataWrapper{}, ctx.Err()
+		}
+		if !DefaultBreaker.Allow() {
+			return structs.FlightDataWrapper{}, &FetchError{Kind: ErrCircuitOpen, URL: url, Err: lastErr}
+		}
+
+		data, err := fetchFlightPage(ctx, url)
+		if ctx.Err() != nil {
+			DefaultBreaker.Cancel()
+			return structs.FlightDataWrapper{}, ctx.Err()
+		}
+		if err == nil || errors.Is(err, ErrNotFound) {
+			DefaultBreaker.Success()
+			return data, err
+		}
+
+		// a captcha or block page comes back as a 200 that doesn't parse, so
+		// parse failures count against the breaker like any other
+		DefaultBreaker.Failure(err)
+		if !retryable(err) {
+			return data, err
+		}
+		lastErr = err
+		fmt.Printf("Fetching %s failed (attempt %d/%d): %v\n", label, attempt+1, maxAttempts, err)
 	}
+
+	return structs.FlightDataWrapper{}, lastErr
+}
+
+func fetchFlightPage(ctx context.Context, url string) (structs.FlightDataWrapper, error) {
 	headers := map[string]string{
 		"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36",
 	}
 
 	// make a get request
-	req, err := http.NewRequest("GET", "https://fr.flightaware.com/live/flight/"+flightNumber, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return structs.FlightDataWrapper{}, err
 	}
 	for key, value := range headers {
 		req.Header.Set(key, value)
 	}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return structs.FlightDataWrapper{}, err
+		return structs.FlightDataWrapper{}, &FetchError{Kind: ErrUpstream, URL: url, Err: err}
 	}
 	defer resp.Body.Close()
 
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return structs.FlightDataWrapper{}, &FetchError{Kind: ErrNotFound, URL: url, StatusCode: resp.StatusCode}
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+		return structs.FlightDataWrapper{}, &FetchError{Kind: ErrBlocked, URL: url, StatusCode: resp.StatusCode}
+	case resp.StatusCode != http.StatusOK:
+		return structs.FlightDataWrapper{}, &FetchError{Kind: ErrUpstream, URL: url, StatusCode: resp.StatusCode}
+	}
+
 	// read the response body
 
 	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return structs.FlightDataWrapper{}, &FetchError{Kind: ErrUpstream, URL: url, Err: err}
+	}
+
+	flightData, err := ParseFlightPage(body)
+	if err != nil {
+		kind := errorKind(err)
+		if err == kind {
+			err = nil
+		}
+		return structs.FlightDataWrapper{}, &FetchError{Kind: kind, URL: url, Err: err}
+	}
+
+	return flightData, nil
+}
+
+// ParseFlightPage extracts the trackpollBootstrap payload from a flightaware
+// flight page and reports any schema drift it finds.
+func ParseFlightPage(body []byte) (structs.FlightDataWrapper, error) {
+	flightData, raw, err := parseFlightPage(body)
 	if err != nil {
 		return structs.FlightDataWrapper{}, err
 	}
 
+	if report := CheckSchema(raw); !report.Empty() {
+		reportDrift(report)
+	}
+
+	return flightData, nil
+}
+
+func parseFlightPage(body []byte) (structs.FlightDataWrapper, []byte, error) {
 	matches := dataRegex.FindSubmatch(body)
 	if len(matches) < 2 {
-		return structs.FlightDataWrapper{}, nil
+		return structs.FlightDataWrapper{}, nil, fmt.Errorf("%w: trackpollBootstrap not found", ErrParseFailure)
 	}
 
 	jsonData := matches[1]
 
 	var flightData structs.FlightDataWrapper
-	err = json.Unmarshal(jsonData, &flightData)
+	err := json.Unmarshal(jsonData, &flightData)
 	if err != nil {
-		return structs.FlightDataWrapper{}, err
+		return structs.FlightDataWrapper{}, nil, fmt.Errorf("%w: %v", ErrParseFailure, err)
 	}
 
-	return flightData, nil
+	if len(flightData.Flights) == 0 {
+		return structs.FlightDataWrapper{}, nil, ErrNotFound
+	}
+
+	return flightData, jsonData, nil
+}
+
+func errorKind(err error) error {
+	for _, kind := range []error{ErrNotFound, ErrBlocked, ErrParseFailure, ErrUpstream, ErrCircuitOpen} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return ErrUpstream
+}
+
+// backoff returns an exponential delay for the given retry, with half of it
+// jittered so concurrent polls don't retry in lockstep.
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << (attempt - 1)
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
 }
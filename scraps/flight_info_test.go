@@ -0,0 +1,133 @@
+package scraps
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseFlightPage(t *testing.T) {
+	tests := []struct {
+		file        string
+		err         error
+		status      string
+		origin      string
+		destination string
+		departed    bool
+		arrived     bool
+		cancelled   bool
+		diverted    bool
+		trackPoints int
+		inbound     string
+		unknown     []string
+		missing     []string
+	}{
+		{file: "scheduled.html", status: "scheduled", origin: "CDG", destination: "JFK", inbound: "AFR5"},
+		{file: "taxiing.html", status: "taxiing", origin: "CDG", destination: "JFK", inbound: "AFR5", departed: true},
+		{file: "airborne.html", status: "airborne", origin: "CDG", destination: "JFK", inbound: "AFR5", departed: true, trackPoints: 6},
+		{file: "arrived.html", status: "arrived", origin: "CDG", destination: "JFK", inbound: "AFR5", departed: true, arrived: true},
+		{file: "cancelled.html", status: "cancelled", origin: "CDG", destination: "JFK", inbound: "AFR5", cancelled: true},
+		{file: "diverted.html", status: "diverted", origin: "CDG", destination: "BOS", inbound: "AFR5", departed: true, arrived: true, diverted: true},
+		{
+			file: "drift_renamed_status.html", origin: "CDG", destination: "JFK", inbound: "AFR5",
+			unknown: []string{"flightState"},
+			missing: []string{"flightStatus", "gateArrivalTimes.scheduled"},
+		},
+		{file: "not_found.html", err: ErrNotFound},
+		{file: "blocked.html", err: ErrParseFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wrapper, raw, err := parseFlightPage(body)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(wrapper.Flights) != 1 {
+				t.Fatalf("got %d flights, want 1", len(wrapper.Flights))
+			}
+			for _, f := range wrapper.Flights {
+				schedule := f.GetSchedule()
+				check(t, "flightStatus", f.FlightStatus, tt.status)
+				check(t, "origin", f.Origin.Iata, tt.origin)
+				check(t, "destination", f.Destination.Iata, tt.destination)
+				check(t, "departed", !schedule.DepartureActual.IsZero(), tt.departed)
+				check(t, "arrived", !schedule.ArrivalActual.IsZero(), tt.arrived)
+				check(t, "cancelled", f.Cancelled, tt.cancelled)
+				check(t, "diverted", f.Diverted, tt.diverted)
+				check(t, "track points", len(f.Track), tt.trackPoints)
+
+				var inbound string
+				if f.InboundFlight != nil {
+					inbound = f.InboundFlight.Ident
+				}
+				check(t, "inbound", inbound, tt.inbound)
+			}
+
+			report := CheckSchema(raw)
+			if !slices.Equal(report.Unknown, tt.unknown) {
+				t.Errorf("unknown fields = %v, want %v", report.Unknown, tt.unknown)
+			}
+			if !slices.Equal(report.Missing, tt.missing) {
+				t.Errorf("missing fields = %v, want %v", report.Missing, tt.missing)
+			}
+		})
+	}
+}
+
+func check[T comparable](t *testing.T, field string, got, want T) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %v, want %v", field, got, want)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// a lookup cancelled while it holds the half-open probe mustn't leave the
+// breaker waiting for an answer that never comes
+func TestCancelledProbe(t *testing.T) {
+	previousBreaker, previousTransport := DefaultBreaker, httpClient.Transport
+	t.Cleanup(func() { DefaultBreaker, httpClient.Transport = previousBreaker, previousTransport })
+
+	DefaultBreaker = NewBreaker(1, 0)
+	DefaultBreaker.Failure(errors.New("blocked"))
+	httpClient.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		<-r.Context().Done()
+		return nil, r.Context().Err()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := GetFlightInfo(ctx, "AFR6"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetFlightInfo error = %v, want the deadline", err)
+	}
+
+	if state := DefaultBreaker.State(); state != BreakerOpen {
+		t.Errorf("breaker %s after a cancelled probe, want open", state)
+	}
+	if !DefaultBreaker.Allow() {
+		t.Error("no probe allowed after a cancelled one")
+	}
+}
@@ -2,253 +2,389 @@ package slack
 
 import (
 	"bytes"
-	sqlite "database/sql"
+	"context"
 	"encoding/json"
+	"errors"
+	"flight-tracker-slack/dates"
 	"flight-tracker-slack/db"
+	"flight-tracker-slack/flightcode"
+	"flight-tracker-slack/i18n"
 	"flight-tracker-slack/scraps"
+	structs "flight-tracker-slack/types"
 	"fmt"
 	"io"
 	"net/http"
-	"regexp"
 	"strings"
 	"time"
 )
 
-func AddFlightHandler(w http.ResponseWriter, r *http.Request, database *sqlite.DB) {
+// trackCommand adds a subscription for the channel, or the user with
+// --dm, to a flight or an aircraft. The people mentioned become its
+// watchers.
+func trackCommand(req Request) Reply {
+	// format [flight_number|registration|hex] [date]
+	if req.Args == "" {
+		return usageError(req, "track", nil)
+	}
+	var prefs db.Preferences
+	notify, setNotify := req.Flags["notify"]
+	if err := prefs.Set("notify", notify); setNotify && err != nil {
+		return usageError(req, "track", err)
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	target, date, err := flightcode.CutTarget(req.Args)
+	if err != nil {
+		return Reply{Text: flightCodeErrorMessage(req.Locale, err)}
+	}
 
-	// get the command content
+	flightNumber, flight, err := resolveTarget(req.Context(), target)
+	if err != nil {
+		return Reply{Text: flightCodeErrorMessage(req.Locale, err)}
+	}
 
-	// format [flight_number] [date]
+	// relative dates are the user's today, not the server's
+	loc := userLocation(req.UserID, req.SlackToken)
 
-	err := r.ParseForm()
+	flightDate, err := departureDate(date, target, flight, time.Now(), loc)
 	if err != nil {
-		fmt.Println("Error parsing form:", err)
-		return
+		return Reply{Text: dateErrorMessage(req.Locale, date, err)}
 	}
 
-	commandText := r.FormValue("text")
-	webhookURL := r.FormValue("response_url")
-
-	var flightNumber string
-	var date string
+	message := req.Locale.T("track.added", flightNumber, req.Locale.Date(flightDate))
+	if target.IsAircraft() {
+		message = req.Locale.T("track.added_aircraft", flightNumber, req.Locale.Date(flightDate))
+	} else if requested := target.Designator.Ident(); requested != flightNumber {
+		message = req.Locale.T("track.added_operated", target.Designator.IATAIdent(), flightNumber, req.Locale.Date(flightDate))
+	}
 
-	splitIndex := -1
-	for i, char := range commandText {
-		if char == ' ' {
-			splitIndex = i
-			break
+	subscriber := req.Subscriber()
+	if subscriber.Kind == db.SubscriberUser {
+		// fail now rather than on the first update if we can't DM the user
+		if _, err := ChannelOf(subscriber, req.SlackToken); err != nil {
+			fmt.Println("Error opening DM:", err)
+			return Reply{Text: req.Locale.T("track.dm_failed")}
 		}
 	}
 
-	if splitIndex != -1 {
-		flightNumber = commandText[:splitIndex]
-		date = commandText[splitIndex+1:]
-	} else {
-		flightNumber = commandText
-		date = ""
+	// out of time, the user was told it didn't work
+	if req.Context().Err() != nil {
+		return Reply{}
+	}
+	added, err := req.Store.AddFlight(db.TrackedFlight{
+		FlightID:      flightNumber,
+		DateDeparture: flightDate,
+		Kind:          string(target.Kind),
+		Subscriber:    subscriber,
+		CreatedBy:     req.UserID,
+		CreatedIn:     req.ChannelID,
+		CreatedAt:     time.Now(),
+	})
+	if err != nil {
+		message = req.Locale.T("track.error", flightNumber, err)
+	} else if !added {
+		message = req.Locale.T("track.already", flightNumber, req.Locale.Date(flightDate), channelName(req, subscriber))
+	} else if subscriber != db.ChannelSubscriber(req.ChannelID) {
+		message = req.Locale.T("track.added_in", strings.TrimSuffix(message, "."), channelName(req, subscriber))
 	}
 
-	var message string
-
-	if !isValidFlightCode(flightNumber) {
-		message = "Invalid or unknown flight code. Please provide a valid flight number (e.g., AA100)."
-		err = answerWebhook(webhookURL, message, true)
-		if err != nil {
-			fmt.Println("Error sending Slack message:", err)
+	if err == nil && setNotify {
+		prefs.Subscriber = subscriber
+		prefs.FlightID = flightNumber
+		prefs.DateDeparture = flightDate
+		prefs.UpdatedAt = time.Now()
+		if err := req.Store.SavePreferences(prefs); err != nil {
+			message += " " + req.Locale.T("track.notify_error", err)
+		} else {
+			message += " " + req.Locale.T("track.notify", prefs.Get("notify"))
 		}
-		return
 	}
+	if err == nil && len(req.Mentions) > 0 {
+		f := db.TrackedFlight{FlightID: flightNumber, DateDeparture: flightDate, Subscriber: subscriber}
+		message += " " + addWatchers(req, f, req.Mentions)
+	}
+	return Reply{Text: message, InChannel: subscriber.Kind == db.SubscriberChannel}
+}
 
-	// parse date
-	var flightDate time.Time
-	if date == "" {
-		flightDate = time.Now()
-	} else {
-		parsedDate, err := parseDate(date)
-		if err != nil {
-			message = "Invalid date format. Please use 'today', 'tomorrow', 'DD/MM/YYYY', 'YYYY-MM-DD', or 'DD-MM-YYYY'."
-			err = answerWebhook(webhookURL, message, true)
-			if err != nil {
-				fmt.Println("Error sending Slack message:", err)
-			}
-			return
-		}
-		flightDate = parsedDate
+// channelName is how replies refer to where a subscriber's updates go.
+func channelName(req Request, subscriber db.Subscriber) string {
+	switch subscriber {
+	case db.ChannelSubscriber(req.ChannelID):
+		return req.Locale.T("where.this_channel")
+	case db.UserSubscriber(req.UserID):
+		return req.Locale.T("where.your_dms")
+	case db.Workspace:
+		return req.Locale.T("where.workspace")
 	}
+	return subscriber.Mention()
+}
 
-	message = fmt.Sprintf("Flight %s has been added for tracking on %s.", flightNumber, flightDate.Format("02 Jan 2006"))
+// answerWebhookBlocks replies with a block kit message, message is the
+// notification fallback.
+func answerWebhookBlocks(webhookURL string, message string, blocks []any, ephemeral bool) error {
+	payloadBytes, err := json.Marshal(replyPayload(message, blocks, ephemeral))
+	if err != nil {
+		return err
+	}
 
-	err = db.AddFlight(database, flightNumber, flightDate, r.FormValue("channel_id"))
+	resp, err := http.Post(webhookURL, "application/json", bytes.NewBuffer(payloadBytes))
 	if err != nil {
-		message = fmt.Sprintf("Error adding flight %s: %v", flightNumber, err)
+		return err
 	}
-	err = answerWebhook(webhookURL, message, false)
+	defer resp.Body.Close()
+
+	_, err = io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Println("Error sending Slack message:", err)
+		return err
 	}
 
+	return nil
 }
 
-func answerWebhook(webhookURL string, message string, ephemeral bool) error {
+func replyPayload(message string, blocks []any, ephemeral bool) map[string]any {
 	var responseType string
 	if ephemeral {
 		responseType = "ephemeral"
 	} else {
 		responseType = "in_channel"
 	}
-	payload := map[string]string{
+	payload := map[string]any{
 		"text":          message,
 		"response_type": responseType,
 	}
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return err
+	if len(blocks) > 0 {
+		payload["blocks"] = blocks
 	}
+	return payload
+}
 
-	resp, err := http.Post(webhookURL, "application/json", bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		return err
+// getFlightInfo looks a designator up on flightaware, a variable so the
+// tests can answer for it.
+var getFlightInfo = scraps.GetFlightInfo
+
+// resolveTarget checks the flight or aircraft exists and returns the ident we
+// track it under, along with the flight flightaware currently shows for it.
+// Marketing codeshare numbers resolve to the operating flight, so AF123,
+// AFR123 and a partner's number for it all end up as the same row.
+func resolveTarget(ctx context.Context, target flightcode.Target) (string, structs.FlightDetail, error) {
+	switch target.Kind {
+	case flightcode.KindRegistration:
+		result, err := scraps.GetAircraftInfo(ctx, target.Ident)
+		return target.Ident, firstFlight(result), err
+	case flightcode.KindHex:
+		result, err := scraps.GetAircraftInfoByHex(ctx, target.Ident)
+		return target.Ident, firstFlight(result), err
 	}
-	defer resp.Body.Close()
 
-	_, err = io.ReadAll(resp.Body)
+	designator := target.Designator
+	result, err := getFlightInfo(ctx, designator.Ident())
 	if err != nil {
-		return err
+		return "", structs.FlightDetail{}, err
 	}
-
-	return nil
+	for _, flight := range result.Flights {
+		if operating, err := flightcode.Parse(flight.Ident); err == nil {
+			return operating.Ident(), flight, nil
+		}
+	}
+	return designator.Ident(), firstFlight(result), nil
 }
 
-func isValidFlightCode(code string) bool {
-	re := regexp.MustCompile(`^[A-Z]{2,3}\d{1,4}$`)
-	if re.MatchString(code) == false {
-		return false
-	}
-	// now make a request to flightaware to see if the flight exists
-	var result, err = scraps.GetFlightInfo(code)
-	if err != nil {
-		return false
-	}
-	var counter int = 0
-	for range result.Flights {
-		counter++
-	}
-	if counter > 0 {
-		return true
+func firstFlight(result structs.FlightDataWrapper) structs.FlightDetail {
+	for _, flight := range result.Flights {
+		return flight
 	}
-	return false
+	return structs.FlightDetail{}
 }
 
-func parseDate(input string) (time.Time, error) {
-	input = strings.ToLower(strings.TrimSpace(input))
-	now := time.Now()
+func flightCodeErrorMessage(locale i18n.Locale, err error) string {
+	var ambiguous *flightcode.AmbiguousError
+	switch {
+	case errors.As(err, &ambiguous) && ambiguous.Flight == "":
+		return locale.T("error.hex_prefix", ambiguous.Input, ambiguous.Hex)
+	case errors.As(err, &ambiguous):
+		return locale.T("error.target_ambiguous", ambiguous.Input, ambiguous.Flight, ambiguous.Hex)
+	case errors.Is(err, flightcode.ErrInvalid), errors.Is(err, scraps.ErrNotFound):
+		return locale.T("error.flight_code")
+	case errors.Is(err, scraps.ErrCircuitOpen), errors.Is(err, scraps.ErrBlocked):
+		return locale.T("error.flightaware_down")
+	default:
+		fmt.Println("Error looking up flight:", err)
+		return locale.T("error.flight_lookup")
+	}
+}
 
-	switch input {
-	case "today":
-		return now, nil
-	case "tomorrow":
-		return now.AddDate(0, 0, 1), nil
+// departureDate is the calendar day at the origin airport a /track command
+// refers to. Without a date we take the departure flightaware shows for the
+// flight, in the origin's time zone, so a 00:30 departure isn't filed under
+// the previous day because the server or the user is further west.
+func departureDate(input string, target flightcode.Target, flight structs.FlightDetail, now time.Time, loc *time.Location) (dates.Date, error) {
+	if input != "" {
+		return parseDate(input, now, loc)
+	}
+	if departure := flight.GetSchedule().DepartureScheduled; !target.IsAircraft() && !departure.IsZero() {
+		return dates.Of(departure, flight.Origin.Location()), nil
 	}
+	return dates.Today(now, loc), nil
+}
 
-	layouts := []string{
-		"02/01/2006",
-		"2006-01-02",
-		"02-01-2006",
-		time.RFC3339,
+// parseDate reads the date typed after a flight number, see
+// dates.ParseExpression. Relative words are taken in loc, the requesting
+// user's time zone.
+func parseDate(input string, now time.Time, loc *time.Location) (dates.Date, error) {
+	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(input)); err == nil {
+		return dates.Of(t, t.Location()), nil
 	}
+	return dates.ParseExpression(input, dates.Today(now, loc))
+}
 
-	for _, layout := range layouts {
-		if t, err := time.Parse(layout, input); err == nil {
-			return t, nil
+// dateErrorMessage explains a date we couldn't read, suggesting what an
+// ambiguous one could mean.
+func dateErrorMessage(locale i18n.Locale, input string, err error) string {
+	var ambiguous *dates.AmbiguousError
+	if errors.As(err, &ambiguous) {
+		var options []string
+		for _, c := range ambiguous.Candidates {
+			options = append(options, fmt.Sprintf("%s (`%s`)", locale.LongDate(c), c))
 		}
+		return locale.T("error.date_ambiguous", input, strings.Join(options, " "+locale.T("format.or")+" "))
 	}
-
-	return time.Time{}, fmt.Errorf("invalid date format")
+	return locale.T("error.date", input)
 }
 
-func PrintAllTrackedFlights(w http.ResponseWriter, r *http.Request, database *sqlite.DB) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+func listCommand(req Request) Reply {
+	if req.Args != "" {
+		return usageError(req, "list", i18n.Errorf("error.no_arguments", "list"))
+	}
 
-	rows, err := database.Query("SELECT flight_id, date_departure, channel_id FROM tracked_flights")
+	flights, err := req.Store.ListFlights()
 	if err != nil {
 		fmt.Println("Error querying database:", err)
-		return
+		return Reply{Text: req.Locale.T("list.error")}
+	}
+
+	// without them the list is still worth showing
+	watchers, err := req.Store.ListWatchers()
+	if err != nil {
+		fmt.Println("Error querying watchers:", err)
 	}
-	defer rows.Close()
+
+	filtered := req.Flags["channel"] != "" || req.Flags["dm"] != ""
 
 	var message strings.Builder
-	message.WriteString("Tracked Flights:\n")
+	message.WriteString(req.Locale.T("list.title") + "\n")
 
-	for rows.Next() {
-		var flightID string
-		var dateDeparture time.Time
-		var channelID string
+	for _, subscriptions := range db.GroupByFlight(flights) {
+		f := subscriptions[0]
 
-		err := rows.Scan(&flightID, &dateDeparture, &channelID)
-		if err != nil {
-			fmt.Println("Error scanning row:", err)
-			return
+		var subscribers []string
+		for _, s := range subscriptions {
+			// personal tracking is only listed to its owner
+			if s.Subscriber.Kind == db.SubscriberUser && s.Subscriber.ID != req.UserID {
+				continue
+			}
+			if filtered && s.Subscriber != req.Subscriber() {
+				continue
+			}
+			subscriber := s.Subscriber.Mention()
+			if users := db.WatchersOf(watchers, s); len(users) > 0 {
+				subscriber += " 👋 <@" + strings.Join(users, "> <@") + ">"
+			}
+			subscribers = append(subscribers, subscriber)
 		}
+		if len(subscribers) == 0 {
+			continue
+		}
+		following := strings.Join(subscribers, ", ")
 
-		message.WriteString(fmt.Sprintf("- Flight %s on %s (Channel: %s)\n", flightID, dateDeparture.Format("02 Jan 2006"), channelID))
+		if f.IsAircraft() {
+			message.WriteString("- " + req.Locale.T("list.aircraft", f.FlightID, req.Locale.Date(f.DateDeparture), following) + "\n")
+		} else {
+			message.WriteString("- " + req.Locale.T("list.flight", f.FlightID, req.Locale.Date(f.DateDeparture), following) + "\n")
+		}
 	}
 
-	err = answerWebhook(r.FormValue("response_url"), message.String(), true)
-	if err != nil {
-		fmt.Println("Error sending Slack message:", err)
-	}
+	return Reply{Text: message.String()}
 }
 
-func RemoveFlightHandler(w http.ResponseWriter, r *http.Request, database *sqlite.DB) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+// untrackCommand removes a subscription to the latest departure of a
+// flight, by default this channel's, or the user's own with --dm.
+func untrackCommand(req Request) Reply {
+	// only check for the flight number
+	if req.Args == "" {
+		return usageError(req, "untrack", nil)
+	}
 
-	// get the command content
-	err := r.ParseForm()
+	target, err := flightcode.ParseTarget(req.Args)
+	var ambiguous *flightcode.AmbiguousError
+	if err != nil && !errors.As(err, &ambiguous) {
+		// "af 123"
+		var designator flightcode.Designator
+		designator, err = flightcode.Parse(req.Args)
+		target = flightcode.Target{Kind: flightcode.KindFlight, Ident: designator.Ident(), Designator: designator}
+	}
 	if err != nil {
-		fmt.Println("Error parsing form:", err)
-		return
+		return Reply{Text: flightCodeErrorMessage(req.Locale, err)}
 	}
 
-	commandText := r.FormValue("text")
+	flightNumber, _, err := resolveTarget(req.Context(), target)
+	if err != nil {
+		return Reply{Text: flightCodeErrorMessage(req.Locale, err)}
+	}
 
-	// only check for the flight number
-	flightNumber := strings.TrimSpace(commandText)
+	// rows added before designators were normalized may use the IATA form
+	legacyNumber := flightNumber
+	if operating, err := flightcode.Parse(flightNumber); err == nil {
+		legacyNumber = operating.IATAIdent()
+	}
 
-	var message string
+	subscriptions, err := req.Store.FindSubscriptions(flightNumber, legacyNumber)
+	if err == nil && (req.Flags["channel"] != "" || req.Flags["dm"] != "") {
+		subscriptions = subscribedBy(subscriptions, req.Subscriber())
+	}
+	if err == nil && len(subscriptions) == 0 {
+		err = db.ErrNotTracked
+	}
 
-	if !isValidFlightCode(flightNumber) {
-		message = "Invalid or unknown flight code. Please provide a valid flight number (e.g., AA100)."
-		err = answerWebhook(r.FormValue("response_url"), message, true)
-		if err != nil {
-			fmt.Println("Error sending Slack message:", err)
+	var subscription db.TrackedFlight
+	if err == nil {
+		subscription, _ = pickSubscription(subscriptions, req.UserID, req.Subscriber())
+
+		allowed, permErr := canUntrack(subscription, req.UserID, req.ChannelID, req.SlackToken)
+		if permErr != nil {
+			fmt.Println("Error checking untrack permission:", permErr)
+		}
+		if !allowed {
+			return Reply{Text: req.Locale.T("untrack.forbidden", flightNumber, creatorMention(req.Locale, subscription), subscription.Subscriber.Mention())}
 		}
-		return
-	}
 
-	// Delete the most recent flight for this flight ID
-	_, err = database.Exec(`
-			DELETE FROM tracked_flights
-			WHERE flight_id = ?
-			  AND date_departure = (
-				SELECT MAX(date_departure)
-				FROM tracked_flights
-				WHERE flight_id = ?
-			  )
-		`, flightNumber, flightNumber)
+		err = req.Store.Unsubscribe(subscription)
+	}
 
-	if err != nil {
-		message = fmt.Sprintf("Error removing latest flight %s: %v", flightNumber, err)
+	var message string
+	if errors.Is(err, db.ErrNotTracked) {
+		message = req.Locale.T("untrack.not_tracked", flightNumber)
+	} else if err != nil {
+		message = req.Locale.T("untrack.error", flightNumber, err)
+	} else if subscription.Subscriber != db.ChannelSubscriber(req.ChannelID) {
+		message = req.Locale.T("untrack.removed_in", flightNumber, channelName(req, subscription.Subscriber))
 	} else {
-		message = fmt.Sprintf("Latest flight %s has been removed from tracking.", flightNumber)
+		message = req.Locale.T("untrack.removed", flightNumber)
+	}
+	return Reply{Text: message, InChannel: subscription.Subscriber.Kind == db.SubscriberChannel}
+}
+
+func subscribedBy(subscriptions []db.TrackedFlight, subscriber db.Subscriber) []db.TrackedFlight {
+	var matching []db.TrackedFlight
+	for _, f := range subscriptions {
+		if f.Subscriber == subscriber {
+			matching = append(matching, f)
+		}
 	}
+	return matching
+}
 
-	err = answerWebhook(r.FormValue("response_url"), message, false)
-	if err != nil {
-		fmt.Println("Error sending Slack message:", err)
+func creatorMention(locale i18n.Locale, f db.TrackedFlight) string {
+	if f.CreatedBy == "" {
+		return locale.T("untrack.unknown_user")
 	}
+	return "<@" + f.CreatedBy + ">"
 }
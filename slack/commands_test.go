@@ -0,0 +1,78 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"flight-tracker-slack/flightcode"
+	"flight-tracker-slack/scraps"
+	structs "flight-tracker-slack/types"
+)
+
+func TestResolveTarget(t *testing.T) {
+	// what flightaware shows for each ident it is asked about
+	shown := map[string]structs.FlightDataWrapper{
+		"AFR6": {Flights: map[string]structs.FlightDetail{
+			"AFR6-1761900000-schedule-0001": {Ident: "AFR6"},
+		}},
+		// KLM's number for the Air France flight
+		"KLM2006": {Flights: map[string]structs.FlightDetail{
+			"AFR6-1761900000-schedule-0001": {Ident: "AFR6"},
+		}},
+		// easyJet's number, shown under its IATA code
+		"EZY1234": {Flights: map[string]structs.FlightDetail{
+			"EZY1234-1761900000-schedule-0002": {Ident: "U21234"},
+		}},
+		"ZZ123": {Flights: map[string]structs.FlightDetail{
+			"ZZ123-1761900000-schedule-0003": {Ident: "ZZ123"},
+		}},
+		// nothing that reads as a flight number
+		"BAW117": {Flights: map[string]structs.FlightDetail{
+			"BAW117-1761900000-schedule-0004": {},
+		}},
+	}
+	previous := getFlightInfo
+	t.Cleanup(func() { getFlightInfo = previous })
+	getFlightInfo = func(ctx context.Context, ident string) (structs.FlightDataWrapper, error) {
+		if result, ok := shown[ident]; ok {
+			return result, nil
+		}
+		return structs.FlightDataWrapper{}, scraps.ErrNotFound
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"AF6", "AFR6"},
+		{"AFR6", "AFR6"},
+		{"KL2006", "AFR6"},
+		{"KLM 2006", "AFR6"},
+		{"U2 1234", "EZY1234"},
+		{"ZZ123", "ZZ123"},
+		{"BA117", "BAW117"},
+	}
+	for _, tt := range tests {
+		target, err := flightcode.ParseTarget(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, err := resolveTarget(context.Background(), target)
+		if err != nil {
+			t.Errorf("resolveTarget(%s) error: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolveTarget(%s) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+
+	target, err := flightcode.ParseTarget("ZZ999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := resolveTarget(context.Background(), target); !errors.Is(err, scraps.ErrNotFound) {
+		t.Errorf("resolveTarget(ZZ999) error = %v, want ErrNotFound", err)
+	}
+}
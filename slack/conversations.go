@@ -0,0 +1,86 @@
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"flight-tracker-slack/db"
+)
+
+// dmChannels caches the bot's DM channel with each user, Slack hands back
+// the same one every time it is opened.
+var dmChannels sync.Map
+
+// OpenDM returns the ID of the bot's direct message channel with a user,
+// opening it with conversations.open the first time.
+func OpenDM(userID string, slackToken string) (string, error) {
+	if channel, ok := dmChannels.Load(userID); ok {
+		return channel.(string), nil
+	}
+
+	body, err := json.Marshal(map[string]string{"users": userID})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", "https://slack.com/api/conversations.open", bytes.NewBuffer(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+slackToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Slack API returned status %d", resp.StatusCode)
+	}
+
+	var respData struct {
+		OK      bool   `json:"ok"`
+		Error   string `json:"error,omitempty"`
+		Channel struct {
+			ID string `json:"id"`
+		} `json:"channel"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
+		return "", err
+	}
+	if !respData.OK {
+		return "", fmt.Errorf("Slack API error: %s", respData.Error)
+	}
+
+	dmChannels.Store(userID, respData.Channel.ID)
+	return respData.Channel.ID, nil
+}
+
+// ChannelOf is where messages for a subscriber are posted: the channel
+// itself, or the bot's DM with a user.
+func ChannelOf(subscriber db.Subscriber, slackToken string) (string, error) {
+	if subscriber.Kind != db.SubscriberUser {
+		return subscriber.ID, nil
+	}
+	channel, err := OpenDM(subscriber.ID, slackToken)
+	if err != nil {
+		return "", fmt.Errorf("opening DM with %s: %w", subscriber.ID, err)
+	}
+	return channel, nil
+}
+
+// PostTo sends a message to a subscriber, see ChannelOf. It returns the
+// message's ts like PostMessage.
+func PostTo(subscriber db.Subscriber, msg SlackMessage, slackToken string) (string, error) {
+	channel, err := ChannelOf(subscriber, slackToken)
+	if err != nil {
+		return "", err
+	}
+	msg.Channel = channel
+	return PostMessage(msg, slackToken)
+}
@@ -0,0 +1,74 @@
+package slack
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"flight-tracker-slack/db"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRequestSubscriber(t *testing.T) {
+	tests := []struct {
+		name      string
+		channelID string
+		flags     map[string]string
+		want      db.Subscriber
+	}{
+		{"in a channel", "C0123456789", nil, db.ChannelSubscriber("C0123456789")},
+		{"--dm in a channel", "C0123456789", map[string]string{"dm": "true"}, db.UserSubscriber("U0123")},
+		{"in a DM", "D0123456789", nil, db.UserSubscriber("U0123")},
+		{"--channel from a DM", "D0123456789", map[string]string{"channel": "C0987654321"}, db.ChannelSubscriber("C0987654321")},
+		{"--channel and --dm", "C0123456789", map[string]string{"channel": "C0987654321", "dm": "true"}, db.UserSubscriber("U0123")},
+	}
+	for _, tt := range tests {
+		req := Request{UserID: "U0123", ChannelID: tt.channelID, Flags: tt.flags}
+		if got := req.Subscriber(); got != tt.want {
+			t.Errorf("%s: Subscriber() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChannelOf(t *testing.T) {
+	opened := 0
+	previous := http.DefaultClient.Transport
+	http.DefaultClient.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if !strings.HasSuffix(r.URL.Path, "/conversations.open") {
+			t.Errorf("unexpected call to %s", r.URL)
+		}
+		opened++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"ok":true,"channel":{"id":"D0DM00001"}}`)),
+			Header:     http.Header{},
+		}, nil
+	})
+	t.Cleanup(func() {
+		http.DefaultClient.Transport = previous
+		dmChannels.Delete("UDMTEST")
+	})
+
+	if got, err := ChannelOf(db.ChannelSubscriber("C0123456789"), "xoxb-test"); err != nil || got != "C0123456789" {
+		t.Errorf("ChannelOf(channel) = %q, %v", got, err)
+	}
+	if opened != 0 {
+		t.Errorf("a channel subscriber opened %d DMs", opened)
+	}
+
+	// a user's updates go to the DM, opened once
+	for i := 0; i < 2; i++ {
+		if got, err := ChannelOf(db.UserSubscriber("UDMTEST"), "xoxb-test"); err != nil || got != "D0DM00001" {
+			t.Errorf("ChannelOf(user) = %q, %v, want the DM", got, err)
+		}
+	}
+	if opened != 1 {
+		t.Errorf("conversations.open called %d times, want 1", opened)
+	}
+}
@@ -0,0 +1,79 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"flight-tracker-slack/dates"
+	"flight-tracker-slack/db"
+	"flight-tracker-slack/flightcode"
+	"flight-tracker-slack/i18n"
+)
+
+func statusCommand(req Request) Reply {
+	if req.Args == "" {
+		return usageError(req, "status", nil)
+	}
+	target, date, err := flightcode.CutTarget(req.Args)
+	if err != nil {
+		return Reply{Text: flightCodeErrorMessage(req.Locale, err)}
+	}
+	// an airframe has no departures to pick from, only where it is now
+	if date != "" && target.IsAircraft() {
+		return usageError(req, "status", i18n.Errorf("error.status_date"))
+	}
+	var day dates.Date
+	if date != "" {
+		day, err = parseDate(date, time.Now(), userLocation(req.UserID, req.SlackToken))
+		if err != nil {
+			return Reply{Text: dateErrorMessage(req.Locale, date, err)}
+		}
+	}
+	text, blocks := flightStatus(req.Context(), req.Locale, target, day)
+	return Reply{Text: text, Blocks: blocks}
+}
+
+// lookingUpStatus acknowledges /flight status, but not for an aircraft
+// with a date: that is refused straight away.
+func lookingUpStatus(req Request) string {
+	if target, date, err := flightcode.CutTarget(req.Args); err == nil && date != "" && target.IsAircraft() {
+		return ""
+	}
+	return lookingUp(req)
+}
+
+func statsCommand(req Request) Reply {
+	if req.Args == "" {
+		return usageError(req, "stats", nil)
+	}
+	return Reply{Text: flightStatsMessage(req.Context(), req.Locale, req.Store, req.Args)}
+}
+
+func flightStatsMessage(ctx context.Context, locale i18n.Locale, store db.Store, args string) string {
+	designator, rest, err := flightcode.Cut(args)
+	if err != nil {
+		return flightCodeErrorMessage(locale, err)
+	}
+	days, err := parseWindow(rest)
+	if err != nil {
+		return locale.T("stats.window")
+	}
+
+	since := dates.Today(time.Now(), time.UTC).AddDays(-days)
+	idents := []string{designator.Ident(), designator.IATAIdent()}
+
+	history, err := store.ListHistory(since, idents...)
+	if err == nil && len(history) == 0 {
+		// a marketing number, the history is under the operating flight
+		if operating, _, resolveErr := resolveTarget(ctx, flightcode.Target{Kind: flightcode.KindFlight, Ident: designator.Ident(), Designator: designator}); resolveErr == nil && operating != designator.Ident() {
+			history, err = store.ListHistory(since, operating)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error reading flight history:", err)
+		return locale.T("stats.error")
+	}
+
+	return summarize(history).message(locale, designator.IATAIdent(), days)
+}
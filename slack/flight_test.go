@@ -0,0 +1,76 @@
+package slack
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"flight-tracker-slack/dates"
+	"flight-tracker-slack/i18n"
+	structs "flight-tracker-slack/types"
+)
+
+func TestStatusRejectsAircraftDate(t *testing.T) {
+	for _, args := range []string{"F-GKXA tomorrow", "hex:3944EF tomorrow"} {
+		req := Request{Locale: i18n.English, Args: args}
+		if ack := lookingUpStatus(req); ack != "" {
+			t.Errorf("status %s acknowledged as a lookup: %q", args, ack)
+		}
+		reply := statusCommand(req)
+		if !strings.Contains(reply.Text, "only goes with a flight number") || !strings.Contains(reply.Text, "/flight status <flight|registration|hex> [date]") {
+			t.Errorf("status %s = %q, want the usage error", args, reply.Text)
+		}
+	}
+	for _, args := range []string{"AF6", "AF6 tomorrow", "F-GKXA"} {
+		if ack := lookingUpStatus(Request{Locale: i18n.English, Args: args}); ack == "" {
+			t.Errorf("status %s not acknowledged", args)
+		}
+	}
+}
+
+func TestDepartureOn(t *testing.T) {
+	paris := structs.AirportDetail{TZ: ":Europe/Paris"}
+	newYork := structs.AirportDetail{TZ: ":America/New_York"}
+	departure := func(id string, origin structs.AirportDetail, scheduled time.Time) structs.ActivityFlight {
+		return structs.ActivityFlight{
+			FlightID:           id,
+			Origin:             origin,
+			GateDepartureTimes: structs.GateTimes{Scheduled: scheduled.Unix()},
+		}
+	}
+	data := structs.FlightDetail{
+		Origin: paris,
+		ActivityLog: structs.ActivityLog{Flights: []structs.ActivityFlight{
+			departure("AFR6-1", paris, time.Date(2026, 11, 1, 8, 0, 0, 0, time.UTC)),
+			// 23:30 in Paris, still November 2nd there
+			departure("AFR6-2", paris, time.Date(2026, 11, 2, 22, 30, 0, 0, time.UTC)),
+			// no timezone of its own: the flight's origin
+			departure("AFR6-3", structs.AirportDetail{}, time.Date(2026, 11, 3, 23, 30, 0, 0, time.UTC)),
+			// the return leg, in New York
+			departure("AFR6-5", newYork, time.Date(2026, 11, 6, 2, 0, 0, 0, time.UTC)),
+			{FlightID: "AFR6-unscheduled", Origin: paris},
+		}},
+	}
+
+	tests := []struct {
+		day  string
+		want string
+	}{
+		{"2026-11-01", "AFR6-1"},
+		{"2026-11-02", "AFR6-2"},
+		{"2026-11-04", "AFR6-3"},
+		{"2026-11-05", "AFR6-5"},
+		{"2026-11-06", ""},
+		{"2026-11-07", ""},
+	}
+	for _, tt := range tests {
+		day, err := dates.Parse(tt.day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := departureOn(data, day)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("departureOn(%s) = %q, %v, want %q", tt.day, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"flight-tracker-slack/i18n"
+)
+
+// Jobs runs the slow part of slash commands after Slack got its answer:
+// Slack gives up on a command after 3 seconds, a FlightAware lookup can take
+// much longer. Jobs keeps count of what is running and cancels a job that
+// overruns its timeout.
+type Jobs struct {
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	nextID  int
+	running map[int]job
+}
+
+type job struct {
+	name    string
+	started time.Time
+}
+
+// DefaultJobs runs the command handlers' background work.
+var DefaultJobs = NewJobs(25 * time.Second)
+
+func NewJobs(timeout time.Duration) *Jobs {
+	return &Jobs{Timeout: timeout, running: map[int]job{}}
+}
+
+// Go runs work in the background and hands its reply to report. work gets
+// a context that is cancelled after the timeout; report then gets a
+// message saying so, in locale, and whatever work answers is dropped.
+func (j *Jobs) Go(name string, locale i18n.Locale, work func(ctx context.Context) Reply, report func(Reply)) {
+	id := j.start(name)
+	ctx, cancel := context.WithTimeout(context.Background(), j.Timeout)
+
+	done := make(chan Reply, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				fmt.Printf("Job %d (%s) panicked: %v\n", id, name, p)
+				done <- Reply{Text: locale.T("error.job_panic")}
+			}
+		}()
+		done <- work(ctx)
+	}()
+
+	go func() {
+		defer j.finish(id)
+		defer cancel()
+
+		select {
+		case reply := <-done:
+			report(reply)
+			return
+		case <-ctx.Done():
+		}
+
+		fmt.Printf("Job %d (%s) cancelled after %s\n", id, name, j.Timeout)
+		report(Reply{Text: locale.T("error.job_slow", name, j.Timeout)})
+		// wait for the lookups to give up, the job runs until then
+		<-done
+	}()
+}
+
+// Running is the number of jobs that haven't reported yet.
+func (j *Jobs) Running() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.running)
+}
+
+func (j *Jobs) start(name string) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.nextID++
+	j.running[j.nextID] = job{name: name, started: time.Now()}
+	fmt.Printf("Job %d started: %s (%d running)\n", j.nextID, name, len(j.running))
+	return j.nextID
+}
+
+func (j *Jobs) finish(id int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if started, ok := j.running[id]; ok {
+		fmt.Printf("Job %d (%s) finished in %s\n", id, started.name, time.Since(started.started).Truncate(time.Millisecond))
+	}
+	delete(j.running, id)
+}
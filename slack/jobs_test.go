@@ -0,0 +1,54 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"flight-tracker-slack/i18n"
+)
+
+func TestJobsReport(t *testing.T) {
+	jobs := NewJobs(time.Second)
+	reports := make(chan Reply, 2)
+	jobs.Go("/flight track AF6", i18n.English, func(ctx context.Context) Reply {
+		return Reply{Text: "tracked"}
+	}, func(r Reply) { reports <- r })
+
+	if r := <-reports; r.Text != "tracked" {
+		t.Errorf("report = %q, want the job's reply", r.Text)
+	}
+}
+
+func TestJobsCancelSlowWork(t *testing.T) {
+	jobs := NewJobs(20 * time.Millisecond)
+	reports := make(chan Reply, 2)
+	cancelled := make(chan error, 1)
+	jobs.Go("/flight track AF6", i18n.English, func(ctx context.Context) Reply {
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return Reply{Text: "tracked"}
+	}, func(r Reply) { reports <- r })
+
+	if err := <-cancelled; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("work context error = %v, want the deadline", err)
+	}
+	want := i18n.English.T("error.job_slow", "/flight track AF6", 20*time.Millisecond)
+	if r := <-reports; r.Text != want {
+		t.Errorf("report = %q, want %q", r.Text, want)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for jobs.Running() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := jobs.Running(); n != 0 {
+		t.Errorf("%d jobs still running", n)
+	}
+	select {
+	case r := <-reports:
+		t.Errorf("cancelled job still reported %q", r.Text)
+	default:
+	}
+}
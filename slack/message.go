@@ -19,20 +19,25 @@ func SendSlackMessageTyped(msg SlackMessage, slackToken string) error {
 }
 
 func SendSlackMessage(channelID string, slackToken string, message string, blocks []interface{}) error {
-	payload := SlackMessage{
+	_, err := PostMessage(SlackMessage{
 		Channel: channelID,
 		Text:    message,
 		Blocks:  blocks,
-	}
+	}, slackToken)
+	return err
+}
 
-	body, err := json.Marshal(payload)
+// PostMessage sends a message with chat.postMessage and returns its ts, the
+// ID Slack gives the message within its channel.
+func PostMessage(msg SlackMessage, slackToken string) (string, error) {
+	body, err := json.Marshal(msg)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	req, err := http.NewRequest("POST", "https://slack.com/api/chat.postMessage", bytes.NewBuffer(body))
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	req.Header.Set("Authorization", "Bearer "+slackToken)
@@ -40,26 +45,27 @@ func SendSlackMessage(channelID string, slackToken string, message string, block
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Slack API returned status %d", resp.StatusCode)
+		return "", fmt.Errorf("Slack API returned status %d", resp.StatusCode)
 	}
 
 	var respData struct {
 		OK    bool   `json:"ok"`
 		Error string `json:"error,omitempty"`
+		TS    string `json:"ts"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
-		return err
+		return "", err
 	}
 
 	if !respData.OK {
-		return fmt.Errorf("Slack API error: %s", respData.Error)
+		return "", fmt.Errorf("Slack API error: %s", respData.Error)
 	}
 
-	return nil
+	return respData.TS, nil
 }
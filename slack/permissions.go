@@ -0,0 +1,52 @@
+package slack
+
+import (
+	"flight-tracker-slack/db"
+)
+
+// pickSubscription chooses which of a flight's subscriptions an /untrack
+// refers to: the one of the subscriber it is about, the channel it was run
+// in or the user in a DM, then one the user created elsewhere, then
+// anyone's. subscriptions come latest departure
+// first, so the most recent flight wins within each group.
+func pickSubscription(subscriptions []db.TrackedFlight, userID string, subscriber db.Subscriber) (db.TrackedFlight, bool) {
+	for _, f := range subscriptions {
+		if f.Subscriber == subscriber {
+			return f, true
+		}
+	}
+	for _, f := range subscriptions {
+		if f.CreatedBy != "" && f.CreatedBy == userID {
+			return f, true
+		}
+	}
+	if len(subscriptions) > 0 {
+		return subscriptions[0], true
+	}
+	return db.TrackedFlight{}, false
+}
+
+// canUntrack allows the user who tracked the flight or gets it in their
+// DMs, anyone in the channel the flight is posted to, and workspace admins
+// and owners.
+func canUntrack(f db.TrackedFlight, userID string, channelID string, slackToken string) (bool, error) {
+	if (f.CreatedBy != "" && f.CreatedBy == userID) || f.Subscriber == db.UserSubscriber(userID) {
+		return true, nil
+	}
+	// slash commands only run in channels the user is a member of
+	if f.Subscriber == db.ChannelSubscriber(channelID) {
+		return true, nil
+	}
+
+	return isAdmin(userID, slackToken)
+}
+
+// isAdmin tells workspace admins and owners apart, a variable so the tests
+// can answer without Slack.
+var isAdmin = func(userID string, slackToken string) (bool, error) {
+	user, err := GetUserInfo(userID, slackToken)
+	if err != nil {
+		return false, err
+	}
+	return user.IsAdmin || user.IsOwner, nil
+}
@@ -0,0 +1,112 @@
+package slack
+
+import (
+	"errors"
+	"testing"
+
+	"flight-tracker-slack/db"
+)
+
+// stubAdmins answers isAdmin from a fixed set of users.
+func stubAdmins(t *testing.T, admins ...string) {
+	previous := isAdmin
+	t.Cleanup(func() { isAdmin = previous })
+	isAdmin = func(userID string, slackToken string) (bool, error) {
+		for _, admin := range admins {
+			if admin == userID {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+func TestCanUntrack(t *testing.T) {
+	stubAdmins(t, "UADMIN")
+
+	inGeneral := db.TrackedFlight{FlightID: "AFR6", Subscriber: db.ChannelSubscriber("CGENERAL"), CreatedBy: "UOWNER", CreatedIn: "CGENERAL"}
+	inOps := db.TrackedFlight{FlightID: "AFR6", Subscriber: db.ChannelSubscriber("COPS"), CreatedBy: "UOWNER", CreatedIn: "CGENERAL"}
+	inDM := db.TrackedFlight{FlightID: "AFR6", Subscriber: db.UserSubscriber("UTRAVELLER"), CreatedBy: "UOWNER", CreatedIn: "CGENERAL"}
+	legacy := db.TrackedFlight{FlightID: "AFR6", Subscriber: db.ChannelSubscriber("COPS")}
+
+	tests := []struct {
+		name      string
+		flight    db.TrackedFlight
+		userID    string
+		channelID string
+		want      bool
+	}{
+		{"owner", inOps, "UOWNER", "CRANDOM", true},
+		{"owner of a DM subscription", inDM, "UOWNER", "CRANDOM", true},
+		{"DM recipient", inDM, "UTRAVELLER", "CRANDOM", true},
+		{"channel member", inGeneral, "UMEMBER", "CGENERAL", true},
+		// --channel #ops run from #general: being in #general, even where
+		// it was tracked, says nothing about #ops
+		{"member of another channel", inOps, "UMEMBER", "CGENERAL", false},
+		{"--channel for the real channel", inGeneral, "UMEMBER", "CGENERAL", true},
+		{"someone else's DM", inDM, "UMEMBER", "CGENERAL", false},
+		{"admin", inOps, "UADMIN", "CGENERAL", true},
+		{"admin on a DM", inDM, "UADMIN", "CRANDOM", true},
+		{"no creator recorded", legacy, "UMEMBER", "CGENERAL", false},
+		{"no creator recorded, channel member", legacy, "UMEMBER", "COPS", true},
+		{"no creator recorded, no user", legacy, "", "CGENERAL", false},
+	}
+	for _, tt := range tests {
+		got, err := canUntrack(tt.flight, tt.userID, tt.channelID, "xoxb-test")
+		if err != nil {
+			t.Errorf("%s: error %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: canUntrack = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCanUntrackAdminError(t *testing.T) {
+	previous := isAdmin
+	t.Cleanup(func() { isAdmin = previous })
+	isAdmin = func(userID string, slackToken string) (bool, error) {
+		return false, errors.New("users.info: ratelimited")
+	}
+
+	f := db.TrackedFlight{FlightID: "AFR6", Subscriber: db.ChannelSubscriber("COPS"), CreatedBy: "UOWNER"}
+	if got, err := canUntrack(f, "UMEMBER", "CGENERAL", "xoxb-test"); got || err == nil {
+		t.Errorf("canUntrack = %v, %v, want false and the error", got, err)
+	}
+	// the owner doesn't need the lookup
+	if got, err := canUntrack(f, "UOWNER", "CGENERAL", "xoxb-test"); !got || err != nil {
+		t.Errorf("owner canUntrack = %v, %v, want true", got, err)
+	}
+}
+
+func TestPickSubscription(t *testing.T) {
+	// latest departure first, as FindSubscriptions returns them
+	ops := db.TrackedFlight{FlightID: "AFR6", Subscriber: db.ChannelSubscriber("COPS"), CreatedBy: "UOTHER"}
+	mine := db.TrackedFlight{FlightID: "AFR6", Subscriber: db.ChannelSubscriber("CTRIPS"), CreatedBy: "UME"}
+	general := db.TrackedFlight{FlightID: "AFR6", Subscriber: db.ChannelSubscriber("CGENERAL"), CreatedBy: "UOTHER"}
+	dm := db.TrackedFlight{FlightID: "AFR6", Subscriber: db.UserSubscriber("UME")}
+	all := []db.TrackedFlight{ops, mine, general, dm}
+
+	tests := []struct {
+		name          string
+		subscriptions []db.TrackedFlight
+		userID        string
+		subscriber    db.Subscriber
+		want          db.TrackedFlight
+		ok            bool
+	}{
+		{"the channel it is run in", all, "UME", db.ChannelSubscriber("CGENERAL"), general, true},
+		// --channel #ops from #general
+		{"the --channel flag", all, "UME", db.ChannelSubscriber("COPS"), ops, true},
+		{"the user's DMs", all, "UME", db.UserSubscriber("UME"), dm, true},
+		{"one the user created elsewhere", all, "UME", db.ChannelSubscriber("CRANDOM"), mine, true},
+		{"anyone's", all, "USTRANGER", db.ChannelSubscriber("CRANDOM"), ops, true},
+		{"none", nil, "UME", db.ChannelSubscriber("CGENERAL"), db.TrackedFlight{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := pickSubscription(tt.subscriptions, tt.userID, tt.subscriber)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: pickSubscription = %s %v, want %s %v", tt.name, got.Subscriber.Mention(), ok, tt.want.Subscriber.Mention(), tt.ok)
+		}
+	}
+}
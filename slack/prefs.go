@@ -0,0 +1,191 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"flight-tracker-slack/dates"
+	"flight-tracker-slack/db"
+	"flight-tracker-slack/flightcode"
+	"flight-tracker-slack/i18n"
+)
+
+var notifyOption = option{name: "notify", value: "events"}
+
+var prefsOptions = []option{
+	notifyOption,
+	{name: "lead", value: "minutes"},
+	{name: "arrival-lead", value: "minutes"},
+	{name: "cruise", value: "interval|milestones"},
+	{name: "maps", value: "on|off"},
+	{name: "quiet", value: "HH:MM-HH:MM|off"},
+	{name: "locale", value: "en|fr"},
+	{name: "reset"},
+	channelOption,
+	dmOption,
+	{name: "workspace"},
+}
+
+// prefsCommand shows or changes which notifications a channel, or a user
+// tracking flights in their DMs, gets, for all its flights or, given a
+// flight, for that flight only. Admins can change the workspace's, which
+// every channel and user starts from.
+func prefsCommand(req Request) Reply {
+	subscriber := req.Subscriber()
+	if req.Flags["workspace"] != "" {
+		if req.Args != "" || req.Flags["channel"] != "" || req.Flags["dm"] != "" {
+			return usageError(req, "prefs", i18n.Errorf("error.workspace_scope"))
+		}
+		admin, err := isAdmin(req.UserID, req.SlackToken)
+		if err != nil {
+			fmt.Println("Error checking workspace admin:", err)
+		}
+		// anyone can look at them, only admins change them
+		if !admin && len(req.Flags) > 1 {
+			return Reply{Text: req.Locale.T("prefs.workspace_forbidden")}
+		}
+		subscriber = db.Workspace
+	}
+
+	all, err := req.Store.ListPreferences()
+	if err != nil {
+		fmt.Println("Error reading preferences:", err)
+		return Reply{Text: req.Locale.T("prefs.error")}
+	}
+
+	scope := db.TrackedFlight{Subscriber: subscriber}
+	if req.Args != "" {
+		if _, ok := req.Flags["locale"]; ok {
+			return usageError(req, "prefs", i18n.Errorf("error.locale_flight"))
+		}
+		f, problem := findSubscription(req, subscriber)
+		if problem != "" {
+			return Reply{Text: problem}
+		}
+		scope = f
+	}
+
+	current, _ := db.FindPreferences(all, subscriber, scope.FlightID, scope.DateDeparture)
+	changed := false
+	if req.Flags["reset"] != "" {
+		current = db.Preferences{Subscriber: subscriber, FlightID: scope.FlightID, DateDeparture: scope.DateDeparture}
+		changed = true
+	}
+	for _, name := range db.PreferenceOptions {
+		value, ok := req.Flags[name]
+		if !ok {
+			continue
+		}
+		if name == "quiet" && !strings.Contains(value, " ") && strings.ToLower(value) != "off" {
+			value += " " + userLocation(req.UserID, req.SlackToken).String()
+		}
+		if err := current.Set(name, value); err != nil {
+			return usageError(req, "prefs", err)
+		}
+		changed = true
+	}
+
+	if changed && req.Context().Err() != nil {
+		return Reply{}
+	}
+	if changed {
+		current.UpdatedAt = time.Now()
+		if err := req.Store.SavePreferences(current); err != nil {
+			return Reply{Text: req.Locale.T("prefs.save_error", err)}
+		}
+		all = replacePreferences(all, current)
+	}
+
+	if changed {
+		// a new locale applies to this reply already
+		here := Request{UserID: req.UserID, ChannelID: req.ChannelID}.Subscriber()
+		req.Locale = *db.ResolvePreferences(all, db.TrackedFlight{Subscriber: here}).Locale
+	}
+	message := prefsMessage(req.Locale, all, scope, channelName(req, subscriber))
+	if changed {
+		message = req.Locale.T("prefs.saved") + " " + message
+	}
+	return Reply{Text: message, InChannel: changed && subscriber.Kind == db.SubscriberChannel}
+}
+
+// findSubscription is the subscription of subscriber that a command's
+// "<flight> [date]" arguments point at, the latest one without a date.
+// It returns what to answer when there is none.
+func findSubscription(req Request, subscriber db.Subscriber) (db.TrackedFlight, string) {
+	target, date, err := flightcode.CutTarget(req.Args)
+	if err != nil {
+		return db.TrackedFlight{}, flightCodeErrorMessage(req.Locale, err)
+	}
+	flightNumber, _, err := resolveTarget(req.Context(), target)
+	if err != nil {
+		return db.TrackedFlight{}, flightCodeErrorMessage(req.Locale, err)
+	}
+
+	var day dates.Date
+	if date != "" {
+		day, err = parseDate(date, time.Now(), userLocation(req.UserID, req.SlackToken))
+		if err != nil {
+			return db.TrackedFlight{}, dateErrorMessage(req.Locale, date, err)
+		}
+	}
+
+	// rows added before designators were normalized may use the IATA form
+	legacyNumber := flightNumber
+	if operating, err := flightcode.Parse(flightNumber); err == nil {
+		legacyNumber = operating.IATAIdent()
+	}
+	subscriptions, err := req.Store.FindSubscriptions(flightNumber, legacyNumber)
+	if err != nil {
+		fmt.Println("Error querying subscriptions:", err)
+		return db.TrackedFlight{}, req.Locale.T("list.error")
+	}
+	for _, f := range subscribedBy(subscriptions, subscriber) {
+		if day.IsZero() || f.DateDeparture == day {
+			return f, ""
+		}
+	}
+	return db.TrackedFlight{}, req.Locale.T("prefs.not_tracked", flightNumber, channelName(req, subscriber))
+}
+
+func replacePreferences(all []db.Preferences, p db.Preferences) []db.Preferences {
+	var replaced []db.Preferences
+	for _, other := range all {
+		if other.Subscriber != p.Subscriber || other.FlightID != p.FlightID || other.DateDeparture != p.DateDeparture {
+			replaced = append(replaced, other)
+		}
+	}
+	return append(replaced, p)
+}
+
+// prefsMessage lists the preferences that apply to scope, a subscriber or
+// one of its flights, and where each comes from. where names the
+// subscriber.
+func prefsMessage(locale i18n.Locale, all []db.Preferences, scope db.TrackedFlight, where string) string {
+	resolved := db.ResolvePreferences(all, scope)
+	workspace, _ := db.FindPreferences(all, db.Workspace, "", dates.Date{})
+	channel, _ := db.FindPreferences(all, scope.Subscriber, "", dates.Date{})
+	flight, _ := db.FindPreferences(all, scope.Subscriber, scope.FlightID, scope.DateDeparture)
+
+	var message strings.Builder
+	if scope.FlightID == "" {
+		message.WriteString(locale.T("prefs.title", where) + "\n")
+	} else {
+		message.WriteString(locale.T("prefs.title_flight", where, scope.FlightID, locale.Date(scope.DateDeparture)) + "\n")
+	}
+
+	for _, name := range db.PreferenceOptions {
+		source := locale.T("prefs.default")
+		switch {
+		case scope.FlightID != "" && flight.Get(name) != "":
+			source = locale.T("prefs.set_for_flight")
+		case channel.Get(name) != "":
+			source = locale.T("prefs.set_for", where)
+		case workspace.Get(name) != "":
+			source = locale.T("prefs.set_for", locale.T("where.workspace"))
+		}
+		message.WriteString(fmt.Sprintf("• %s: `%s` _(%s)_\n", name, resolved.Get(name), source))
+	}
+	message.WriteString(locale.T("prefs.change", "/flight prefs [flight [date]] --notify=... --lead=... --arrival-lead=... --cruise=... --maps=... --quiet=... --locale=..."))
+	return message.String()
+}
@@ -0,0 +1,495 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"flight-tracker-slack/db"
+	"flight-tracker-slack/flightcode"
+	"flight-tracker-slack/i18n"
+)
+
+// Request is a slash command as subcommands see it: who ran it, where, and
+// its arguments with the flags taken out.
+type Request struct {
+	Store       db.Store
+	SlackToken  string
+	UserID      string
+	ChannelID   string
+	ResponseURL string
+	// Locale is the language of the channel, or DM, the command was run in
+	Locale i18n.Locale
+
+	// Args is the positional arguments, space separated
+	Args  string
+	Flags map[string]string
+	// Mentions are the user IDs of the people mentioned in the arguments,
+	// for subcommands that take them
+	Mentions []string
+
+	ctx context.Context
+}
+
+// Context is done once a command running as a job is out of time, so its
+// lookups stop and it doesn't change anything after the user was told it
+// failed. Quick commands run without a deadline.
+func (req Request) Context() context.Context {
+	if req.ctx == nil {
+		return context.Background()
+	}
+	return req.ctx
+}
+
+// Channel is the channel the command is about: --channel when given, the
+// one it was run in otherwise.
+func (req Request) Channel() string {
+	if channel := req.Flags["channel"]; channel != "" {
+		return channel
+	}
+	return req.ChannelID
+}
+
+// Subscriber is who the command is about: the user with --dm or when run
+// in a DM, where the bot can't post to, the channel otherwise.
+func (req Request) Subscriber() db.Subscriber {
+	if req.Flags["dm"] != "" || (req.Flags["channel"] == "" && isDM(req.ChannelID)) {
+		return db.UserSubscriber(req.UserID)
+	}
+	return db.ChannelSubscriber(req.Channel())
+}
+
+// isDM tells direct message channels apart, their IDs start with a D.
+func isDM(channelID string) bool {
+	return strings.HasPrefix(channelID, "D")
+}
+
+// Reply is what a subcommand answers. Replies are only shown to the user
+// who ran the command unless InChannel is set.
+type Reply struct {
+	Text      string
+	Blocks    []any
+	InChannel bool
+}
+
+// subcommands and options are described in the catalog, under
+// "help.<subcommand>" and "help.option.<option>".
+type subcommand struct {
+	name    string
+	args    string
+	example string
+	flags   []option
+	run     func(Request) Reply
+	// mentions lets @people through to run, in Request.Mentions
+	mentions bool
+	// ack, when it returns something, is answered straight away and run
+	// goes to a background job: it has to look things up on FlightAware.
+	ack func(Request) string
+}
+
+// option is a --flag a subcommand accepts. Options with a value placeholder
+// take one, as --name=value or --name value, the others are switches.
+type option struct {
+	name  string
+	value string
+}
+
+var channelOption = option{name: "channel", value: "#channel"}
+
+var dmOption = option{name: "dm"}
+
+// subcommands are the /flight subcommands, in the order help lists them.
+// Filled in init, help refers to the table itself.
+var subcommands []subcommand
+
+func init() {
+	subcommands = []subcommand{
+		{
+			name:     "track",
+			args:     "<flight|registration|hex> [date] [@people]",
+			example:  "/flight track AF123 tomorrow @alice --notify=takeoff,landing",
+			flags:    []option{channelOption, dmOption, notifyOption},
+			run:      trackCommand,
+			mentions: true,
+			ack:      lookingUp,
+		},
+		{
+			name:    "untrack",
+			args:    "<flight|registration|hex>",
+			example: "/flight untrack AF123",
+			flags:   []option{channelOption, dmOption},
+			run:     untrackCommand,
+			ack:     lookingUp,
+		},
+		{
+			name:    "list",
+			args:    "",
+			example: "/flight list --channel=#travel",
+			flags:   []option{channelOption, dmOption},
+			run:     listCommand,
+		},
+		{
+			name:    "status",
+			args:    "<flight|registration|hex> [date]",
+			example: "/flight status AF123 tomorrow",
+			run:     statusCommand,
+			ack:     lookingUpStatus,
+		},
+		{
+			name:    "trip",
+			args:    "[name:] <flight> [date], <flight> [date], ... | list",
+			example: "/flight trip Offsite: AF1234 2026-11-02, KL567 2026-11-02",
+			flags:   []option{channelOption, dmOption},
+			run:     tripCommand,
+			ack:     lookingUpTrip,
+		},
+		{
+			name:    "stats",
+			args:    "<flight> [window]",
+			example: "/flight stats AF123 30d",
+			run:     statsCommand,
+			ack:     lookingUp,
+		},
+		{
+			name:    "prefs",
+			args:    "[<flight> [date]]",
+			example: "/flight prefs --notify=takeoff,landing --quiet=22:00-07:00",
+			flags:   prefsOptions,
+			run:     prefsCommand,
+			ack:     lookingUp,
+		},
+		{
+			name:     "watch",
+			args:     "<flight> [date] [@people]",
+			example:  "/flight watch AF123 @alice @bob",
+			flags:    []option{channelOption},
+			run:      watchCommand,
+			mentions: true,
+			ack:      lookingUp,
+		},
+		{
+			name:     "unwatch",
+			args:     "<flight> [date] [@people]",
+			example:  "/flight unwatch AF123 @bob",
+			flags:    []option{channelOption},
+			run:      unwatchCommand,
+			mentions: true,
+			ack:      lookingUp,
+		},
+		{
+			name:    "help",
+			args:    "[subcommand]",
+			example: "/flight help track",
+			run:     helpCommand,
+		},
+	}
+}
+
+func lookupSubcommand(name string) (subcommand, bool) {
+	for _, cmd := range subcommands {
+		if cmd.name == strings.ToLower(name) {
+			return cmd, true
+		}
+	}
+	return subcommand{}, false
+}
+
+// FlightCommandHandler answers /flight <subcommand> ...
+func FlightCommandHandler(w http.ResponseWriter, r *http.Request, store db.Store, slackToken string) {
+	serveCommand(w, r, store, slackToken, "")
+}
+
+// AddFlightHandler, RemoveFlightHandler, PrintAllTrackedFlights and
+// TripHandler answer the older /track, /untrack, /list and /trip commands,
+// now aliases of their /flight subcommands.
+func AddFlightHandler(w http.ResponseWriter, r *http.Request, store db.Store, slackToken string) {
+	serveCommand(w, r, store, slackToken, "track")
+}
+
+func RemoveFlightHandler(w http.ResponseWriter, r *http.Request, store db.Store, slackToken string) {
+	serveCommand(w, r, store, slackToken, "untrack")
+}
+
+func PrintAllTrackedFlights(w http.ResponseWriter, r *http.Request, store db.Store, slackToken string) {
+	serveCommand(w, r, store, slackToken, "list")
+}
+
+func TripHandler(w http.ResponseWriter, r *http.Request, store db.Store, slackToken string) {
+	serveCommand(w, r, store, slackToken, "trip")
+}
+
+// serveCommand runs the subcommand named in the text, or alias for the old
+// single-purpose commands. Quick commands are answered in the response,
+// the others are acknowledged there and answer through the response_url
+// once their job is done.
+func serveCommand(w http.ResponseWriter, r *http.Request, store db.Store, slackToken string, alias string) {
+	err := r.ParseForm()
+	if err != nil {
+		fmt.Println("Error parsing form:", err)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	req := Request{
+		Store:       store,
+		SlackToken:  slackToken,
+		UserID:      r.FormValue("user_id"),
+		ChannelID:   r.FormValue("channel_id"),
+		ResponseURL: r.FormValue("response_url"),
+	}
+	req.Locale = localeOf(store, req.Subscriber())
+
+	text := r.FormValue("text")
+	if alias != "" {
+		text = alias + " " + text
+	}
+	cmd, req, reply, ok := parseCommand(req, text)
+	if !ok {
+		writeReply(w, reply)
+		return
+	}
+
+	ack := ""
+	if cmd.ack != nil {
+		ack = cmd.ack(req)
+	}
+	if ack == "" {
+		writeReply(w, cmd.run(req))
+		return
+	}
+
+	writeReply(w, Reply{Text: ack})
+	DefaultJobs.Go(strings.TrimSpace("/flight "+cmd.name+" "+req.Args), req.Locale, func(ctx context.Context) Reply {
+		req.ctx = ctx
+		return cmd.run(req)
+	}, func(reply Reply) {
+		err := answerWebhookBlocks(req.ResponseURL, reply.Text, reply.Blocks, !reply.InChannel)
+		if err != nil {
+			fmt.Println("Error sending Slack message:", err)
+		}
+	})
+}
+
+// localeOf is the language a subscriber reads, the default when its
+// preferences can't be read.
+func localeOf(store db.Store, subscriber db.Subscriber) i18n.Locale {
+	preferences, err := store.ListPreferences()
+	if err != nil {
+		fmt.Println("Error querying preferences:", err)
+	}
+	return *db.ResolvePreferences(preferences, db.TrackedFlight{Subscriber: subscriber}).Locale
+}
+
+// writeReply answers the command in the HTTP response, Slack shows it
+// without a round trip through the response_url.
+func writeReply(w http.ResponseWriter, reply Reply) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(replyPayload(reply.Text, reply.Blocks, !reply.InChannel))
+	if err != nil {
+		fmt.Println("Error answering command:", err)
+	}
+}
+
+// parseCommand finds the subcommand of a /flight command line and its
+// arguments. When the line doesn't make sense it returns the reply
+// explaining why.
+func parseCommand(req Request, text string) (subcommand, Request, Reply, bool) {
+	name, rest, _ := strings.Cut(strings.TrimSpace(text), " ")
+	if name == "" {
+		return subcommand{}, req, Reply{Text: helpText(req.Locale)}, false
+	}
+	cmd, ok := lookupSubcommand(name)
+	if !ok {
+		return subcommand{}, req, Reply{Text: req.Locale.T("error.unknown_subcommand", name) + "\n\n" + helpText(req.Locale)}, false
+	}
+
+	args, flags, err := parseFlags(rest, cmd.flags)
+	if err == nil && flags["channel"] != "" {
+		flags["channel"], err = parseChannel(flags["channel"])
+	}
+	if err == nil && flags["channel"] != "" && flags["dm"] != "" {
+		err = i18n.Errorf("error.channel_and_dm")
+	}
+	var mentions []string
+	if err == nil && cmd.mentions {
+		args, mentions, err = cutMentions(args)
+	}
+	if err != nil {
+		return cmd, req, usageError(req, cmd.name, err), false
+	}
+
+	req.Args = args
+	req.Mentions = mentions
+	req.Flags = flags
+	return cmd, req, Reply{}, true
+}
+
+// lookingUp acknowledges a command about one flight or aircraft. A
+// command line we can't read fails without a lookup, it isn't worth a job.
+func lookingUp(req Request) string {
+	_, date, err := flightcode.CutTarget(req.Args)
+	if err != nil {
+		return ""
+	}
+	return req.Locale.T("command.looking_up", strings.TrimSpace(strings.TrimSuffix(req.Args, date)))
+}
+
+func lookingUpTrip(req Request) string {
+	switch strings.ToLower(req.Args) {
+	case "", "list":
+		return ""
+	}
+	return req.Locale.T("trip.looking_up")
+}
+
+// parseFlags takes the --options out of a command line. Slack clients
+// sometimes turn "--" into an em dash, we take that too.
+func parseFlags(text string, options []option) (string, map[string]string, error) {
+	var args []string
+	flags := map[string]string{}
+
+	fields := strings.Fields(text)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if strings.HasPrefix(field, "—") {
+			field = "--" + strings.TrimPrefix(field, "—")
+		}
+		if !strings.HasPrefix(field, "--") || field == "--" {
+			args = append(args, field)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(field, "--"), "=")
+		spec, ok := lookupOption(options, name)
+		switch {
+		case !ok:
+			return "", nil, i18n.Errorf("error.option_unknown", name)
+		case spec.value == "" && hasValue:
+			return "", nil, i18n.Errorf("error.option_no_value", name)
+		case spec.value == "":
+			value = "true"
+		case !hasValue && i+1 < len(fields):
+			i++
+			value = fields[i]
+		case !hasValue:
+			return "", nil, i18n.Errorf("error.option_needs_value", name)
+		}
+		flags[spec.name] = value
+	}
+	return strings.Join(args, " "), flags, nil
+}
+
+func lookupOption(options []option, name string) (option, bool) {
+	for _, o := range options {
+		if o.name == strings.ToLower(name) {
+			return o, true
+		}
+	}
+	return option{}, false
+}
+
+var channelMentionPattern = regexp.MustCompile(`^<#([CG][A-Z0-9]+)(\|[^>]*)?>$`)
+var channelIDPattern = regexp.MustCompile(`^[CG][A-Z0-9]{8,}$`)
+
+// parseChannel reads a --channel value. Slack escapes channels picked from
+// the autocomplete as <#C0123|name>, a bare #name has no ID we can post to.
+func parseChannel(value string) (string, error) {
+	if m := channelMentionPattern.FindStringSubmatch(value); m != nil {
+		return m[1], nil
+	}
+	if channelIDPattern.MatchString(value) {
+		return value, nil
+	}
+	return "", i18n.Errorf("error.channel_pick")
+}
+
+var userMentionPattern = regexp.MustCompile(`^<@([UW][A-Z0-9]+)(\|[^>]*)?>$`)
+
+// cutMentions takes the people mentioned out of a command's arguments.
+// Like channels, Slack escapes users picked from the autocomplete, as
+// <@U0123|name>.
+func cutMentions(args string) (string, []string, error) {
+	var rest, users []string
+	for _, field := range strings.Fields(args) {
+		if m := userMentionPattern.FindStringSubmatch(field); m != nil {
+			if !slices.Contains(users, m[1]) {
+				users = append(users, m[1])
+			}
+			continue
+		}
+		if strings.HasPrefix(field, "@") {
+			return "", nil, i18n.Errorf("error.mention_pick", field)
+		}
+		rest = append(rest, field)
+	}
+	return strings.Join(rest, " "), users, nil
+}
+
+// usageError explains what is wrong with a command line, when err says,
+// and how to write it.
+func usageError(req Request, name string, err error) Reply {
+	cmd, _ := lookupSubcommand(name)
+	text := subcommandHelp(req.Locale, cmd)
+	if err != nil {
+		problem := req.Locale.Error(err)
+		first, size := utf8.DecodeRuneInString(problem)
+		text = string(unicode.ToUpper(first)) + problem[size:] + ".\n" + text
+	}
+	return Reply{Text: text}
+}
+
+func helpCommand(req Request) Reply {
+	if req.Args == "" {
+		return Reply{Text: helpText(req.Locale)}
+	}
+	cmd, ok := lookupSubcommand(req.Args)
+	if !ok {
+		return Reply{Text: req.Locale.T("error.unknown_subcommand", req.Args) + "\n\n" + helpText(req.Locale)}
+	}
+	return Reply{Text: subcommandHelp(req.Locale, cmd)}
+}
+
+func helpText(locale i18n.Locale) string {
+	var help strings.Builder
+	help.WriteString(locale.T("help.usage", "/flight <subcommand> ...") + "\n")
+	for _, cmd := range subcommands {
+		help.WriteString(fmt.Sprintf("• `%s`: %s\n", synopsis(cmd), locale.T("help."+cmd.name)))
+	}
+	help.WriteString(locale.T("help.shortcuts"))
+	return help.String()
+}
+
+func subcommandHelp(locale i18n.Locale, cmd subcommand) string {
+	var help strings.Builder
+	help.WriteString(locale.T("help.usage", synopsis(cmd)) + "\n" + locale.T("help."+cmd.name) + "\n")
+	for _, o := range cmd.flags {
+		help.WriteString(fmt.Sprintf("• `%s`: %s\n", optionSynopsis(o), locale.T("help.option."+o.name)))
+	}
+	help.WriteString(locale.T("help.example", cmd.example))
+	return help.String()
+}
+
+func synopsis(cmd subcommand) string {
+	parts := []string{"/flight", cmd.name}
+	if cmd.args != "" {
+		parts = append(parts, cmd.args)
+	}
+	for _, o := range cmd.flags {
+		parts = append(parts, "["+optionSynopsis(o)+"]")
+	}
+	return strings.Join(parts, " ")
+}
+
+func optionSynopsis(o option) string {
+	if o.value == "" {
+		return "--" + o.name
+	}
+	return "--" + o.name + "=" + o.value
+}
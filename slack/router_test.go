@@ -0,0 +1,221 @@
+package slack
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"flight-tracker-slack/i18n"
+)
+
+// errorKey is the catalog key of a parse error, empty for nil.
+func errorKey(t *testing.T, err error) string {
+	t.Helper()
+	if err == nil {
+		return ""
+	}
+	var e *i18n.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("error %v doesn't come from the catalog", err)
+	}
+	return e.Key
+}
+
+func TestParseFlags(t *testing.T) {
+	options := []option{channelOption, dmOption, notifyOption}
+
+	tests := []struct {
+		text  string
+		args  string
+		flags map[string]string
+		err   string
+	}{
+		{"AF123 tomorrow", "AF123 tomorrow", map[string]string{}, ""},
+		{"AF123 --notify=takeoff,landing", "AF123", map[string]string{"notify": "takeoff,landing"}, ""},
+		{"AF123 --notify takeoff tomorrow", "AF123 tomorrow", map[string]string{"notify": "takeoff"}, ""},
+		{"--dm AF123", "AF123", map[string]string{"dm": "true"}, ""},
+		{"AF123 --DM", "AF123", map[string]string{"dm": "true"}, ""},
+		// Slack turned the -- into an em dash
+		{"AF123 —channel=C0123456789 —dm", "AF123", map[string]string{"channel": "C0123456789", "dm": "true"}, ""},
+		{"AF123 —notify landing", "AF123", map[string]string{"notify": "landing"}, ""},
+		{"AF123 -- tomorrow", "AF123 -- tomorrow", map[string]string{}, ""},
+		{"AF123 --notify=", "AF123", map[string]string{"notify": ""}, ""},
+		{"AF123 --quiet=22:00-07:00", "", nil, "error.option_unknown"},
+		{"AF123 —later", "", nil, "error.option_unknown"},
+		{"AF123 --dm=yes", "", nil, "error.option_no_value"},
+		{"AF123 --notify", "", nil, "error.option_needs_value"},
+		{"AF123 --channel", "", nil, "error.option_needs_value"},
+	}
+	for _, tt := range tests {
+		args, flags, err := parseFlags(tt.text, options)
+		if key := errorKey(t, err); key != tt.err {
+			t.Errorf("parseFlags(%q) error = %v, want %s", tt.text, err, tt.err)
+			continue
+		}
+		if args != tt.args || !maps.Equal(flags, tt.flags) {
+			t.Errorf("parseFlags(%q) = %q %v, want %q %v", tt.text, args, flags, tt.args, tt.flags)
+		}
+	}
+}
+
+func TestParseChannel(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		err   string
+	}{
+		{"<#C0123456789|travel>", "C0123456789", ""},
+		{"<#G0123456789>", "G0123456789", ""},
+		{"C0123456789", "C0123456789", ""},
+		{"#travel", "", "error.channel_pick"},
+		{"travel", "", "error.channel_pick"},
+		{"<@U0123456789|alice>", "", "error.channel_pick"},
+		{"D0123456789", "", "error.channel_pick"},
+	}
+	for _, tt := range tests {
+		got, err := parseChannel(tt.value)
+		if key := errorKey(t, err); key != tt.err || got != tt.want {
+			t.Errorf("parseChannel(%q) = %q, %v, want %q %s", tt.value, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestCutMentions(t *testing.T) {
+	tests := []struct {
+		args     string
+		rest     string
+		mentions []string
+		err      string
+	}{
+		{"AF123 tomorrow", "AF123 tomorrow", nil, ""},
+		{"AF123 <@U0123|alice> tomorrow <@W0456>", "AF123 tomorrow", []string{"U0123", "W0456"}, ""},
+		{"AF123 <@U0123|alice> <@U0123>", "AF123", []string{"U0123"}, ""},
+		{"AF123 @alice", "", nil, "error.mention_pick"},
+		// an email address isn't a mention
+		{"AF123 alice@example.com", "AF123 alice@example.com", nil, ""},
+	}
+	for _, tt := range tests {
+		rest, mentions, err := cutMentions(tt.args)
+		if key := errorKey(t, err); key != tt.err {
+			t.Errorf("cutMentions(%q) error = %v, want %s", tt.args, err, tt.err)
+			continue
+		}
+		if rest != tt.rest || !slices.Equal(mentions, tt.mentions) {
+			t.Errorf("cutMentions(%q) = %q %v, want %q %v", tt.args, rest, mentions, tt.rest, tt.mentions)
+		}
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	base := Request{Locale: i18n.English, UserID: "U0123", ChannelID: "C0000000001"}
+
+	tests := []struct {
+		text     string
+		cmd      string
+		args     string
+		flags    map[string]string
+		mentions []string
+	}{
+		{"track AF123 tomorrow", "track", "AF123 tomorrow", map[string]string{}, nil},
+		{"  TRACK   AF123  ", "track", "AF123", map[string]string{}, nil},
+		{"track AF123 <@U0456|bob> --channel=<#C0123456789|travel>", "track", "AF123", map[string]string{"channel": "C0123456789"}, []string{"U0456"}},
+		{"track AF123 —channel <#C0123456789|travel> —notify landing", "track", "AF123", map[string]string{"channel": "C0123456789", "notify": "landing"}, nil},
+		{"untrack AF123 --dm", "untrack", "AF123", map[string]string{"dm": "true"}, nil},
+		// status doesn't take mentions, they stay in the arguments
+		{"status AF123 <@U0456>", "status", "AF123 <@U0456>", map[string]string{}, nil},
+		{"help track", "help", "track", map[string]string{}, nil},
+	}
+	for _, tt := range tests {
+		cmd, req, reply, ok := parseCommand(base, tt.text)
+		if !ok {
+			t.Errorf("parseCommand(%q) failed: %s", tt.text, reply.Text)
+			continue
+		}
+		if cmd.name != tt.cmd || req.Args != tt.args || !maps.Equal(req.Flags, tt.flags) || !slices.Equal(req.Mentions, tt.mentions) {
+			t.Errorf("parseCommand(%q) = %s %q %v %v, want %s %q %v %v", tt.text, cmd.name, req.Args, req.Flags, req.Mentions, tt.cmd, tt.args, tt.flags, tt.mentions)
+		}
+		if req.UserID != base.UserID || req.ChannelID != base.ChannelID {
+			t.Errorf("parseCommand(%q) lost who ran it: %+v", tt.text, req)
+		}
+	}
+}
+
+func TestParseCommandErrors(t *testing.T) {
+	base := Request{Locale: i18n.English, UserID: "U0123", ChannelID: "C0000000001"}
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", []string{"Usage: `/flight <subcommand> ...`", "`/flight track <flight|registration|hex> [date] [@people] [--channel=#channel] [--dm] [--notify=events]`"}},
+		{"fly AF123", []string{"Unknown subcommand `fly`.", "Usage: `/flight <subcommand> ...`"}},
+		{"track AF123 --later", []string{"Unknown option `--later`.\nUsage: `/flight track <flight|registration|hex> [date] [@people]"}},
+		{"track AF123 --dm=yes", []string{"`--dm` doesn't take a value.\n"}},
+		{"track AF123 --notify", []string{"`--notify` needs a value.\n"}},
+		{"track AF123 --channel=#travel", []string{"Pick the `--channel` from Slack's autocomplete"}},
+		{"track AF123 --channel=C0123456789 --dm", []string{"`--channel` and `--dm` don't go together."}},
+		{"track AF123 @bob", []string{"Pick @bob from Slack's autocomplete"}},
+		// status takes no options at all
+		{"status AF123 --dm", []string{"Unknown option `--dm`.\nUsage: `/flight status <flight|registration|hex> [date]`"}},
+	}
+	for _, tt := range tests {
+		_, _, reply, ok := parseCommand(base, tt.text)
+		if ok {
+			t.Errorf("parseCommand(%q) accepted", tt.text)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(reply.Text, want) {
+				t.Errorf("parseCommand(%q) = %q, want it to contain %q", tt.text, reply.Text, want)
+			}
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	help := helpText(i18n.English)
+	for _, cmd := range subcommands {
+		if !strings.Contains(help, "• `"+synopsis(cmd)+"`: ") {
+			t.Errorf("help doesn't list %s", cmd.name)
+		}
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"list", "Usage: `/flight list [--channel=#channel] [--dm]`\n"},
+		{"status", "Usage: `/flight status <flight|registration|hex> [date]`\n"},
+		{"help", "Usage: `/flight help [subcommand]`\n"},
+	}
+	for _, tt := range tests {
+		cmd, ok := lookupSubcommand(tt.name)
+		if !ok {
+			t.Fatalf("no %s subcommand", tt.name)
+		}
+		text := subcommandHelp(i18n.English, cmd)
+		if !strings.HasPrefix(text, tt.want) {
+			t.Errorf("help %s = %q, want it to start with %q", tt.name, text, tt.want)
+		}
+		if !strings.HasSuffix(text, "Example: `"+cmd.example+"`") {
+			t.Errorf("help %s = %q, want it to end with the example", tt.name, text)
+		}
+		for _, o := range cmd.flags {
+			if !strings.Contains(text, "• `"+optionSynopsis(o)+"`: ") {
+				t.Errorf("help %s doesn't describe %s", tt.name, optionSynopsis(o))
+			}
+		}
+	}
+
+	track := subcommandHelp(i18n.English, subcommands[0])
+	for _, want := range []string{
+		"• `--channel=#channel`: act on another channel than this one\n",
+		"• `--dm`: act on your own updates",
+	} {
+		if !strings.Contains(track, want) {
+			t.Errorf("help track = %q, want it to contain %q", track, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package slack
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"flight-tracker-slack/db"
+	"flight-tracker-slack/i18n"
+)
+
+// arrivals up to this late still count as on time, the usual A15 measure
+const onTimeMargin = 15 * time.Minute
+
+const defaultStatsDays = 90
+
+type flightStats struct {
+	Flights         int
+	Cancelled       int
+	Arrivals        int
+	OnTime          int
+	DepartureDelays []time.Duration
+	ArrivalDelays   []time.Duration
+	Routes          []string
+}
+
+func summarize(history []db.FlightHistory) flightStats {
+	var stats flightStats
+	routes := map[string]bool{}
+
+	for _, h := range history {
+		stats.Flights++
+		if h.Cancelled {
+			stats.Cancelled++
+			continue
+		}
+		if route := h.Origin + " → " + h.Destination; !routes[route] && h.Origin != "" {
+			routes[route] = true
+			stats.Routes = append(stats.Routes, route)
+		}
+		if delay, ok := h.Out.Delay(); ok {
+			stats.DepartureDelays = append(stats.DepartureDelays, delay)
+		}
+		if delay, ok := h.In.Delay(); ok {
+			stats.ArrivalDelays = append(stats.ArrivalDelays, delay)
+			stats.Arrivals++
+			if delay <= onTimeMargin && !h.Diverted {
+				stats.OnTime++
+			}
+		}
+	}
+	return stats
+}
+
+func average(delays []time.Duration) time.Duration {
+	if len(delays) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range delays {
+		total += d
+	}
+	return total / time.Duration(len(delays))
+}
+
+// percentile uses the nearest rank method, p in [0, 100].
+func percentile(delays []time.Duration, p float64) time.Duration {
+	if len(delays) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), delays...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(p/100*float64(len(sorted)) + 0.999999)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// parseWindow reads a stats window like "30d", "6w", "3m" or "1y". A bare
+// number is days.
+func parseWindow(input string) (int, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if input == "" {
+		return defaultStatsDays, nil
+	}
+
+	unit := 1
+	switch {
+	case strings.HasSuffix(input, "d"):
+		input = strings.TrimSuffix(input, "d")
+	case strings.HasSuffix(input, "w"):
+		unit, input = 7, strings.TrimSuffix(input, "w")
+	case strings.HasSuffix(input, "m"):
+		unit, input = 30, strings.TrimSuffix(input, "m")
+	case strings.HasSuffix(input, "y"):
+		unit, input = 365, strings.TrimSuffix(input, "y")
+	}
+
+	n, err := strconv.Atoi(input)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid window %q", input)
+	}
+	return n * unit, nil
+}
+
+func (s flightStats) message(locale i18n.Locale, flightNumber string, days int) string {
+	if s.Flights == 0 {
+		return locale.T("stats.none", flightNumber, days)
+	}
+
+	var b strings.Builder
+	b.WriteString(locale.T("stats.title", flightNumber, days, s.Flights))
+	if len(s.Routes) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(s.Routes, ", "))
+	}
+	b.WriteString("\n")
+	b.WriteString("• " + locale.T("stats.on_time", locale.Percent(s.OnTime, s.Arrivals), s.OnTime, s.Arrivals, int(onTimeMargin/time.Minute)) + "\n")
+	if len(s.DepartureDelays) > 0 {
+		b.WriteString("• " + locale.T("stats.departure_delay", locale.Duration(average(s.DepartureDelays)), locale.Duration(percentile(s.DepartureDelays, 90))) + "\n")
+	}
+	if len(s.ArrivalDelays) > 0 {
+		b.WriteString("• " + locale.T("stats.arrival_delay", locale.Duration(average(s.ArrivalDelays)), locale.Duration(percentile(s.ArrivalDelays, 90))) + "\n")
+	}
+	b.WriteString("• " + locale.T("stats.cancelled", locale.Percent(s.Cancelled, s.Flights), s.Cancelled, s.Flights))
+	return b.String()
+}
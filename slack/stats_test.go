@@ -0,0 +1,116 @@
+package slack
+
+import (
+	"testing"
+	"time"
+
+	"flight-tracker-slack/db"
+)
+
+func minutes(values ...int) []time.Duration {
+	var delays []time.Duration
+	for _, v := range values {
+		delays = append(delays, time.Duration(v)*time.Minute)
+	}
+	return delays
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		delays []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		{nil, 90, 0},
+		{minutes(7), 90, 7 * time.Minute},
+		// nearest rank: the 9th of 10, the 18th of 20
+		{minutes(10, 1, 9, 2, 8, 3, 7, 4, 6, 5), 90, 9 * time.Minute},
+		{minutes(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20), 90, 18 * time.Minute},
+		{minutes(5, -3, 40), 50, 5 * time.Minute},
+		{minutes(5, -3, 40), 0, -3 * time.Minute},
+		{minutes(5, -3, 40), 100, 40 * time.Minute},
+		{minutes(1, 2, 3, 4), 90, 4 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.delays, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.delays, tt.p, got, tt.want)
+		}
+	}
+
+	delays := minutes(3, 1, 2)
+	percentile(delays, 50)
+	if delays[0] != 3*time.Minute {
+		t.Errorf("percentile sorted its argument: %v", delays)
+	}
+}
+
+func TestAverage(t *testing.T) {
+	if got := average(nil); got != 0 {
+		t.Errorf("average(nil) = %v", got)
+	}
+	if got := average(minutes(-10, 10, 30)); got != 10*time.Minute {
+		t.Errorf("average = %v, want 10m", got)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	day := time.Date(2030, time.January, 2, 10, 0, 0, 0, time.UTC)
+	flight := func(out, in time.Duration) db.FlightHistory {
+		return db.FlightHistory{
+			Origin:      "CDG",
+			Destination: "JFK",
+			Out:         db.EventTimes{Scheduled: day, Actual: day.Add(out)},
+			In:          db.EventTimes{Scheduled: day.Add(8 * time.Hour), Actual: day.Add(8*time.Hour + in)},
+		}
+	}
+	diverted := flight(0, 0)
+	diverted.Destination = "BOS"
+	diverted.Diverted = true
+	notArrived := flight(5*time.Minute, 0)
+	notArrived.In.Actual = time.Time{}
+
+	stats := summarize([]db.FlightHistory{
+		flight(0, 15*time.Minute), // still on time
+		flight(20*time.Minute, 16*time.Minute),
+		{Cancelled: true, Origin: "CDG", Destination: "JFK"},
+		diverted,
+		notArrived,
+	})
+
+	if stats.Flights != 5 || stats.Cancelled != 1 {
+		t.Errorf("flights = %d, cancelled = %d, want 5 and 1", stats.Flights, stats.Cancelled)
+	}
+	if stats.Arrivals != 3 || stats.OnTime != 1 {
+		t.Errorf("arrivals = %d, on time = %d, want 3 and 1", stats.Arrivals, stats.OnTime)
+	}
+	if len(stats.DepartureDelays) != 4 || len(stats.ArrivalDelays) != 3 {
+		t.Errorf("delays = %v / %v", stats.DepartureDelays, stats.ArrivalDelays)
+	}
+	if len(stats.Routes) != 2 || stats.Routes[0] != "CDG → JFK" || stats.Routes[1] != "CDG → BOS" {
+		t.Errorf("routes = %v", stats.Routes)
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int
+		wantErr bool
+	}{
+		{"", defaultStatsDays, false},
+		{"30", 30, false},
+		{"30d", 30, false},
+		{"6W", 42, false},
+		{"3m", 90, false},
+		{"1y", 365, false},
+		{"0d", 0, true},
+		{"-2w", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseWindow(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseWindow(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"flight-tracker-slack/dates"
+	"flight-tracker-slack/flightcode"
+	"flight-tracker-slack/i18n"
+	"flight-tracker-slack/maps"
+	"flight-tracker-slack/scraps"
+	structs "flight-tracker-slack/types"
+)
+
+// flightStatus looks a flight or aircraft up on flightaware and describes
+// where it is right now, tracked or not: the departure on day, a calendar
+// day at the origin, or the one flightaware shows without. It returns the
+// fallback text and the blocks of the reply.
+func flightStatus(ctx context.Context, locale i18n.Locale, target flightcode.Target, day dates.Date) (string, []any) {
+	_, data, err := resolveTarget(ctx, target)
+	if err == nil && data.Airline.FullName == "" && data.Ident == "" {
+		err = fmt.Errorf("no flight shown for %s", target.Ident)
+	}
+	if err == nil && !day.IsZero() && dates.Of(data.GetSchedule().DepartureScheduled, data.Origin.Location()) != day {
+		flightID, ok := departureOn(data, day)
+		if !ok {
+			return locale.T("status.no_departure", target.Designator.IATAIdent(), locale.Date(day)), nil
+		}
+		var result structs.FlightDataWrapper
+		result, err = scraps.GetFlightInfoByID(ctx, flightID)
+		data = result.Flights[flightID]
+		if data.Ident == "" {
+			data = firstFlight(result)
+		}
+	}
+	if err != nil {
+		return flightCodeErrorMessage(locale, err), nil
+	}
+
+	var notes []string
+
+	summary := statusSummary(locale, data)
+	blocks := []any{section(summary)}
+
+	if flightPhase(data) == phaseAirborne && len(data.Track) > 0 {
+		if url, err := maps.UploadAircraftMap(data); err != nil {
+			fmt.Println("Error attaching map:", err)
+			notes = append(notes, locale.T("status.no_map"))
+		} else {
+			blocks = append(blocks, map[string]any{
+				"type":      "image",
+				"image_url": url,
+				"alt_text":  locale.T("status.map"),
+			})
+		}
+	}
+
+	schedule := data.GetSchedule()
+	blocks = append(blocks,
+		map[string]any{"type": "divider"},
+		map[string]any{
+			"type": "section",
+			"fields": []any{
+				mrkdwn(locale.T("status.departure", data.Origin.Iata) + "\n" + statusTimes(locale, schedule.DepartureScheduled, schedule.DepartureEstimated, schedule.DepartureActual, data.Origin) + "\n" + statusGate(locale, data.Origin)),
+				mrkdwn(locale.T("status.arrival", data.Destination.Iata) + "\n" + statusTimes(locale, schedule.ArrivalScheduled, schedule.ArrivalEstimated, schedule.ArrivalActual, data.Destination) + "\n" + statusGate(locale, data.Destination)),
+			},
+		},
+	)
+	if len(notes) > 0 {
+		blocks = append(blocks, map[string]any{
+			"type":     "context",
+			"elements": []any{mrkdwn(strings.Join(notes, " "))},
+		})
+	}
+
+	return summary, blocks
+}
+
+// departureOn finds the flightaware id of the flight's departure on day in
+// the activity log, which lists its recent and upcoming departures.
+func departureOn(data structs.FlightDetail, day dates.Date) (string, bool) {
+	for _, f := range data.ActivityLog.Flights {
+		loc := f.Origin.Location()
+		if f.Origin.TZ == "" {
+			loc = data.Origin.Location()
+		}
+		if f.FlightID != "" && f.GateDepartureTimes.Scheduled != 0 && dates.Of(time.Unix(f.GateDepartureTimes.Scheduled, 0), loc) == day {
+			return f.FlightID, true
+		}
+	}
+	return "", false
+}
+
+// the phases of a flight are catalog keys
+const (
+	phaseScheduled = "status.scheduled_phase"
+	phaseLeftGate  = "status.left_gate"
+	phaseAirborne  = "status.airborne"
+	phaseLanded    = "status.landed"
+	phaseArrived   = "status.arrived"
+	phaseDiverted  = "status.diverted"
+	phaseCancelled = "status.cancelled"
+)
+
+// flightPhase is where the flight is, from the most advanced time
+// flightaware has recorded.
+func flightPhase(data structs.FlightDetail) string {
+	switch {
+	case data.Cancelled:
+		return phaseCancelled
+	case data.Diverted:
+		return phaseDiverted
+	case data.GateArrivalTimes.Actual != nil || data.FlightStatus == "arrived":
+		return phaseArrived
+	case data.LandingTimes.Actual != nil:
+		return phaseLanded
+	case data.TakeoffTimes.Actual != nil || data.FlightStatus == "airborne":
+		return phaseAirborne
+	case data.GateDepartureTimes.Actual != nil || data.FlightStatus == "taxiing":
+		return phaseLeftGate
+	}
+	return phaseScheduled
+}
+
+func statusSummary(locale i18n.Locale, data structs.FlightDetail) string {
+	ident := data.DisplayIdent
+	if ident == "" {
+		ident = data.Ident
+	}
+
+	lines := []string{fmt.Sprintf("*%s* %s, %s → %s", ident, data.Airline.ShortName, data.Origin.Iata, data.Destination.Iata)}
+	if data.Aircraft.FriendlyType != "" {
+		lines[0] += " (" + data.Aircraft.FriendlyType + ")"
+	}
+
+	phase := locale.T(flightPhase(data))
+	if flightPhase(data) != phaseAirborne {
+		return strings.Join(append(lines, locale.T("status.status", phase)), "\n")
+	}
+
+	if total := data.Distance.Elapsed + data.Distance.Remaining; total > 0 {
+		phase += locale.T("status.progress", locale.Percent(data.Distance.Elapsed, total), locale.Int(data.Distance.Remaining))
+	}
+	lines = append(lines,
+		locale.T("status.status", phase),
+		locale.T("status.altitude", locale.Int(data.Altitude*100), locale.Int(data.Groundspeed)),
+	)
+	return strings.Join(lines, "\n")
+}
+
+// statusTimes lists the scheduled, estimated and actual times we know, in
+// the airport's time zone.
+func statusTimes(locale i18n.Locale, scheduled, estimated, actual time.Time, airport structs.AirportDetail) string {
+	loc := airport.Location()
+	var lines []string
+	for _, t := range []struct {
+		label string
+		at    time.Time
+	}{
+		{"status.scheduled", scheduled},
+		{"status.estimated", estimated},
+		{"status.actual", actual},
+	} {
+		if t.at.IsZero() || (t.label == "status.estimated" && !actual.IsZero()) {
+			continue
+		}
+		lines = append(lines, locale.T(t.label, locale.TimeZoneAndDay(t.at.In(loc))))
+	}
+	if len(lines) == 0 {
+		return locale.T("status.no_times")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func statusGate(locale i18n.Locale, airport structs.AirportDetail) string {
+	terminal, gate := airport.Terminal, airport.Gate
+	if terminal == "" {
+		terminal = locale.T("notify.unknown")
+	}
+	if gate == "" {
+		gate = locale.T("notify.unknown")
+	}
+	return locale.T("notify.terminal_gate", terminal, gate)
+}
+
+func section(text string) map[string]any {
+	return map[string]any{
+		"type": "section",
+		"text": mrkdwn(text),
+	}
+}
+
+func mrkdwn(text string) map[string]string {
+	return map[string]string{
+		"type": "mrkdwn",
+		"text": text,
+	}
+}
@@ -0,0 +1,186 @@
+package slack
+
+import (
+	"flight-tracker-slack/db"
+	"flight-tracker-slack/flightcode"
+	"flight-tracker-slack/i18n"
+	structs "flight-tracker-slack/types"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// tripCommand tracks several flights as one trip, in the order they are
+// flown, so the poller can watch the connections between them.
+func tripCommand(req Request) Reply {
+	switch strings.ToLower(req.Args) {
+	case "":
+		return usageError(req, "trip", nil)
+	case "list":
+		return Reply{Text: tripListMessage(req)}
+	}
+	message, ok := addTrip(req)
+	return Reply{Text: message, InChannel: ok && req.Subscriber().Kind == db.SubscriberChannel}
+}
+
+// addTrip resolves every leg before storing anything, a trip with a leg we
+// can't find isn't worth half-tracking. It reports whether the trip was
+// added.
+func addTrip(req Request) (string, bool) {
+	name, legsText := cutTripName(req.Args)
+	parts := strings.FieldsFunc(legsText, func(r rune) bool { return r == ',' || r == ';' })
+	if len(parts) < 2 {
+		return usageError(req, "trip", i18n.Errorf("error.trip_legs")).Text, false
+	}
+
+	loc := userLocation(req.UserID, req.SlackToken)
+	now := time.Now()
+
+	var legs []db.TripLeg
+	var flights []structs.FlightDetail
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+
+		target, date, err := flightcode.CutTarget(part)
+		if err == nil && target.IsAircraft() {
+			return req.Locale.T("trip.leg", i+1, part, req.Locale.T("trip.aircraft")), false
+		}
+		var flightNumber string
+		var flight structs.FlightDetail
+		if err == nil {
+			flightNumber, flight, err = resolveTarget(req.Context(), target)
+		}
+		if err != nil {
+			return req.Locale.T("trip.leg", i+1, part, flightCodeErrorMessage(req.Locale, err)), false
+		}
+
+		flightDate, err := departureDate(date, target, flight, now, loc)
+		if err != nil {
+			return req.Locale.T("trip.leg", i+1, part, dateErrorMessage(req.Locale, date, err)), false
+		}
+		if n := len(legs); n > 0 && flightDate.Before(legs[n-1].DateDeparture) {
+			return req.Locale.T("trip.leg_order", i+1, part, req.Locale.Date(flightDate)), false
+		}
+
+		legs = append(legs, db.TripLeg{FlightID: flightNumber, DateDeparture: flightDate})
+		flights = append(flights, flight)
+	}
+
+	if name == "" {
+		name = tripRoute(legs, flights)
+	}
+
+	subscriber := req.Subscriber()
+	if subscriber.Kind == db.SubscriberUser {
+		if _, err := ChannelOf(subscriber, req.SlackToken); err != nil {
+			fmt.Println("Error opening DM:", err)
+			return req.Locale.T("trip.dm_failed"), false
+		}
+	}
+	if req.Context().Err() != nil {
+		return "", false
+	}
+	for _, leg := range legs {
+		_, err := req.Store.AddFlight(db.TrackedFlight{
+			FlightID:      leg.FlightID,
+			DateDeparture: leg.DateDeparture,
+			Kind:          string(flightcode.KindFlight),
+			Subscriber:    subscriber,
+			CreatedBy:     req.UserID,
+			CreatedIn:     req.ChannelID,
+			CreatedAt:     now,
+		})
+		if err != nil {
+			return req.Locale.T("track.error", leg.FlightID, err), false
+		}
+	}
+
+	trip, err := req.Store.AddTrip(db.Trip{
+		Name:       name,
+		Subscriber: subscriber,
+		CreatedBy:  req.UserID,
+		CreatedAt:  now,
+		Legs:       legs,
+	})
+	if err != nil {
+		return req.Locale.T("trip.error", name, err), false
+	}
+
+	var message strings.Builder
+	message.WriteString(req.Locale.T("trip.added", trip.Name) + "\n")
+	for i, leg := range trip.Legs {
+		message.WriteString(fmt.Sprintf("%d. %s\n", i+1, req.Locale.T("trip.added_leg", leg.FlightID, req.Locale.Date(leg.DateDeparture))))
+	}
+	if subscriber.Kind == db.SubscriberUser {
+		message.WriteString(req.Locale.T("trip.warn_dm"))
+	} else {
+		message.WriteString(req.Locale.T("trip.warn", channelName(req, subscriber)))
+	}
+	return message.String(), true
+}
+
+// cutTripName splits off the optional "name:" in front of the legs. The
+// text before the colon is only a name if it isn't itself a leg, so a
+// first leg with an RFC3339 time isn't mistaken for one.
+func cutTripName(text string) (string, string) {
+	before, after, ok := strings.Cut(text, ":")
+	if !ok || strings.ContainsAny(before, ",;") {
+		return "", text
+	}
+	if _, _, err := flightcode.CutTarget(before); err == nil {
+		return "", text
+	}
+	return strings.TrimSpace(before), after
+}
+
+// tripRoute names a trip after the airports it goes through, or its
+// flights when flightaware didn't tell us.
+func tripRoute(legs []db.TripLeg, flights []structs.FlightDetail) string {
+	stops := []string{flights[0].Origin.Iata}
+	for _, f := range flights {
+		stops = append(stops, f.Destination.Iata)
+	}
+	for _, stop := range stops {
+		if stop == "" {
+			var idents []string
+			for _, leg := range legs {
+				idents = append(idents, leg.FlightID)
+			}
+			return strings.Join(idents, " → ")
+		}
+	}
+	return strings.Join(stops, " → ")
+}
+
+func tripListMessage(req Request) string {
+	subscriber := req.Subscriber()
+	trips, err := req.Store.ListTrips()
+	if err != nil {
+		fmt.Println("Error querying trips:", err)
+		return req.Locale.T("trip.list_error")
+	}
+
+	var message strings.Builder
+	for _, trip := range trips {
+		if trip.Subscriber != subscriber {
+			continue
+		}
+		var legs []string
+		for _, leg := range trip.Legs {
+			label := fmt.Sprintf("%s (%s)", leg.FlightID, req.Locale.ShortDate(leg.DateDeparture))
+			switch leg.ConnectionState {
+			case db.ConnectionTight:
+				label = "⚠️ " + label
+			case db.ConnectionImpossible:
+				label = "🚨 " + label
+			}
+			legs = append(legs, label)
+		}
+		message.WriteString(fmt.Sprintf("- *%s*: %s\n", trip.Name, strings.Join(legs, " → ")))
+	}
+
+	if message.Len() == 0 {
+		return req.Locale.T("trip.none", channelName(req, subscriber))
+	}
+	return req.Locale.T("trip.list_title") + "\n" + message.String()
+}
@@ -0,0 +1,70 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type User struct {
+	ID      string `json:"id"`
+	TZ      string `json:"tz"`
+	IsAdmin bool   `json:"is_admin"`
+	IsOwner bool   `json:"is_owner"`
+}
+
+// Location is the user's time zone from their Slack profile, UTC if unset.
+func (u User) Location() *time.Location {
+	if u.TZ == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.TZ)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func GetUserInfo(userID string, slackToken string) (User, error) {
+	req, err := http.NewRequest("GET", "https://slack.com/api/users.info?user="+url.QueryEscape(userID), nil)
+	if err != nil {
+		return User{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+slackToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return User{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return User{}, fmt.Errorf("Slack API returned status %d", resp.StatusCode)
+	}
+
+	var respData struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+		User  User   `json:"user"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
+		return User{}, err
+	}
+	if !respData.OK {
+		return User{}, fmt.Errorf("Slack API error: %s", respData.Error)
+	}
+	return respData.User, nil
+}
+
+// userLocation is where relative dates like "tomorrow" are anchored for the
+// user who ran a command.
+func userLocation(userID string, slackToken string) *time.Location {
+	user, err := GetUserInfo(userID, slackToken)
+	if err != nil {
+		fmt.Println("Error looking up user time zone:", err)
+		return time.UTC
+	}
+	return user.Location()
+}
@@ -0,0 +1,109 @@
+package slack
+
+import (
+	"strings"
+	"time"
+
+	"flight-tracker-slack/db"
+	"flight-tracker-slack/i18n"
+)
+
+// watchCommand adds people to ping about a subscription's arrival, the
+// user who ran it when nobody is mentioned.
+func watchCommand(req Request) Reply {
+	if req.Args == "" {
+		return usageError(req, "watch", nil)
+	}
+	f, problem := findSubscription(req, req.Subscriber())
+	if problem != "" {
+		return Reply{Text: problem}
+	}
+	users := req.Mentions
+	if len(users) == 0 {
+		users = []string{req.UserID}
+	}
+	return Reply{Text: addWatchers(req, f, users), InChannel: true}
+}
+
+// unwatchCommand stops pinging people about a subscription.
+func unwatchCommand(req Request) Reply {
+	if req.Args == "" {
+		return usageError(req, "unwatch", nil)
+	}
+	f, problem := findSubscription(req, req.Subscriber())
+	if problem != "" {
+		return Reply{Text: problem}
+	}
+	users := req.Mentions
+	if len(users) == 0 {
+		users = []string{req.UserID}
+	}
+
+	var removed, missing []string
+	for _, user := range users {
+		ok, err := req.Store.RemoveWatcher(db.Watcher{FlightID: f.FlightID, DateDeparture: f.DateDeparture, Subscriber: f.Subscriber, UserID: user})
+		if err != nil {
+			return Reply{Text: req.Locale.T("watch.remove_error", f.FlightID, err)}
+		}
+		if ok {
+			removed = append(removed, user)
+		} else {
+			missing = append(missing, user)
+		}
+	}
+
+	var message []string
+	if len(removed) > 0 {
+		message = append(message, req.Locale.T("watch.removed", mentionList(req.Locale, removed), f.FlightID, req.Locale.Date(f.DateDeparture)))
+	}
+	if len(missing) > 0 {
+		message = append(message, req.Locale.T("watch.missing", f.FlightID, mentionList(req.Locale, missing)))
+	}
+	return Reply{Text: strings.Join(message, " ")}
+}
+
+// addWatchers adds users to a subscription's watchers and says so. Only a
+// channel can ping people, a mention in someone's DMs reaches nobody else.
+func addWatchers(req Request, f db.TrackedFlight, users []string) string {
+	if f.Subscriber.Kind != db.SubscriberChannel {
+		return req.Locale.T("watch.channel_only")
+	}
+
+	var added, already []string
+	for _, user := range users {
+		ok, err := req.Store.AddWatcher(db.Watcher{
+			FlightID:      f.FlightID,
+			DateDeparture: f.DateDeparture,
+			Subscriber:    f.Subscriber,
+			UserID:        user,
+			AddedBy:       req.UserID,
+			AddedAt:       time.Now(),
+		})
+		if err != nil {
+			return req.Locale.T("watch.add_error", f.FlightID, err)
+		}
+		if ok {
+			added = append(added, user)
+		} else {
+			already = append(already, user)
+		}
+	}
+
+	var message []string
+	if len(added) > 0 {
+		message = append(message, req.Locale.T("watch.added", mentionList(req.Locale, added), channelName(req, f.Subscriber), f.FlightID))
+	}
+	if len(already) > 0 {
+		message = append(message, req.Locale.T("watch.already", mentionList(req.Locale, already)))
+	}
+	return strings.Join(message, " ")
+}
+
+// mentionList formats user IDs as "<@U1>, <@U2> and <@U3>".
+func mentionList(locale i18n.Locale, users []string) string {
+	mentions := make([]string, len(users))
+	for i, user := range users {
+		mentions[i] = "<@" + user + ">"
+	}
+	return locale.List(mentions)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"flight-tracker-slack/dates"
+	"flight-tracker-slack/db"
+	"flight-tracker-slack/i18n"
+	"flight-tracker-slack/slack"
+	structs "flight-tracker-slack/types"
+)
+
+// legInstance is one departure of a tracked flight, what a trip leg points at.
+type legInstance struct {
+	flightID string
+	date     dates.Date
+}
+
+func instanceOf(flightID string, date dates.Date) legInstance {
+	return legInstance{flightID: flightID, date: date}
+}
+
+// connectionRank orders connection states from fine to missed, we only warn
+// when a connection gets worse.
+var connectionRank = map[string]int{
+	"":                      0,
+	db.ConnectionOK:         0,
+	db.ConnectionTight:      1,
+	db.ConnectionImpossible: 2,
+}
+
+// connection is the time between the inbound leg reaching the gate and the
+// outbound leg leaving it, from the latest times we know of each.
+type connection struct {
+	Arrival   time.Time
+	Departure time.Time
+	State     string
+}
+
+func (c connection) Spare() time.Duration {
+	return c.Departure.Sub(c.Arrival)
+}
+
+// checkConnections looks at every trip whose consecutive legs were both
+// seen by this poll, and warns the trip's subscriber when a connection
+// becomes tight or impossible. Trips with none of their legs still tracked
+// are over and removed.
+func (b *Bot) checkConnections(flights []db.TrackedFlight, observed map[legInstance]structs.FlightDetail, preferences []db.Preferences) {
+	trips, err := b.Store.ListTrips()
+	if err != nil {
+		fmt.Println("Error querying trips:", err)
+		return
+	}
+
+	tracked := map[legInstance]bool{}
+	for _, f := range flights {
+		tracked[instanceOf(f.FlightID, f.DateDeparture)] = true
+	}
+
+	for _, trip := range trips {
+		if !tripTracked(trip, tracked) {
+			if err := b.Store.RemoveTrip(trip.ID); err != nil {
+				fmt.Println("Error removing finished trip:", err)
+			}
+			continue
+		}
+
+		for i := 1; i < len(trip.Legs); i++ {
+			in, out := trip.Legs[i-1], trip.Legs[i]
+			inbound, ok := observed[instanceOf(in.FlightID, in.DateDeparture)]
+			if !ok {
+				continue
+			}
+			outbound, ok := observed[instanceOf(out.FlightID, out.DateDeparture)]
+			if !ok {
+				continue
+			}
+
+			c, ok := connectionOf(inbound, outbound, b.MinConnection)
+			if !ok || c.State == out.ConnectionState {
+				continue
+			}
+
+			p := db.ResolvePreferences(preferences, db.TrackedFlight{FlightID: out.FlightID, DateDeparture: out.DateDeparture, Subscriber: trip.Subscriber})
+			if p.IsQuiet(b.Clock.Now()) {
+				// state unchanged, so we warn after quiet hours if it still matters
+				continue
+			}
+
+			if connectionRank[c.State] > connectionRank[out.ConnectionState] && p.Notifies(db.EventConnection) {
+				if !b.sendConnectionAlert(trip, in, out, inbound, outbound, c, *p.Locale) {
+					// try again on the next poll
+					continue
+				}
+			}
+			if err := b.Store.SaveConnectionState(trip.ID, out.Position, c.State); err != nil {
+				fmt.Println("Error saving connection state:", err)
+			}
+		}
+	}
+}
+
+func tripTracked(trip db.Trip, tracked map[legInstance]bool) bool {
+	for _, leg := range trip.Legs {
+		if tracked[instanceOf(leg.FlightID, leg.DateDeparture)] {
+			return true
+		}
+	}
+	return false
+}
+
+// connectionOf compares the inbound leg's arrival, actual or estimated,
+// with the outbound leg's departure. Once the outbound leg has left or
+// either is cancelled there is nothing left to warn about.
+func connectionOf(inbound, outbound structs.FlightDetail, minConnection time.Duration) (connection, bool) {
+	if inbound.Cancelled || outbound.Cancelled {
+		return connection{}, false
+	}
+	in := inbound.GetSchedule()
+	out := outbound.GetSchedule()
+	if !out.DepartureActual.IsZero() {
+		return connection{}, false
+	}
+
+	c := connection{
+		Arrival:   firstTime(in.ArrivalActual, in.ArrivalEstimated, in.ArrivalScheduled),
+		Departure: firstTime(out.DepartureEstimated, out.DepartureScheduled),
+	}
+	if c.Arrival.IsZero() || c.Departure.IsZero() {
+		return connection{}, false
+	}
+
+	switch spare := c.Spare(); {
+	case spare <= 0:
+		c.State = db.ConnectionImpossible
+	case spare < minConnection:
+		c.State = db.ConnectionTight
+	default:
+		c.State = db.ConnectionOK
+	}
+	return c, true
+}
+
+func firstTime(times ...time.Time) time.Time {
+	for _, t := range times {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// sendConnectionAlert posts the warning, claimed in the notification log so
+// two instances of the bot don't both send it. The key includes the
+// arrival time, a connection that recovers and gets worse again is a new
+// alert.
+func (b *Bot) sendConnectionAlert(trip db.Trip, in, out db.TripLeg, inbound, outbound structs.FlightDetail, c connection, locale i18n.Locale) bool {
+	msg := slack.SlackMessage{
+		Channel: trip.Subscriber.ID,
+		Blocks: []any{
+			map[string]any{
+				"type": "section",
+				"text": map[string]string{
+					"type": "mrkdwn",
+					"text": connectionMessage(locale, trip, in, out, inbound, outbound, c, b.MinConnection),
+				},
+			},
+		},
+	}
+
+	n := db.Notification{
+		Key:           fmt.Sprintf("trip/%d/%d/%s/%s", trip.ID, out.Position, c.State, c.Arrival.UTC().Format(time.RFC3339)),
+		FlightID:      out.FlightID,
+		DateDeparture: out.DateDeparture,
+		Subscriber:    trip.Subscriber,
+		Event:         "connection_" + c.State,
+		Payload:       payloadOf(msg),
+		CreatedAt:     b.Clock.Now().UTC(),
+	}
+	if !b.claim(n) {
+		// already sent, by us or another instance
+		return true
+	}
+
+	fmt.Printf("Sending connection alert for trip %d to %s: %s\n", trip.ID, trip.Subscriber.ID, c.State)
+	ts, err := slack.PostTo(trip.Subscriber, msg, b.SlackToken)
+	b.finish(n, ts, err)
+	if err != nil {
+		fmt.Println("Slack error:", err)
+		return false
+	}
+	return true
+}
+
+func connectionMessage(locale i18n.Locale, trip db.Trip, in, out db.TripLeg, inbound, outbound structs.FlightDetail, c connection, minConnection time.Duration) string {
+	arrival := locale.Time(c.Arrival.In(inbound.Destination.Location()))
+	departure := locale.Time(c.Departure.In(outbound.Origin.Location()))
+
+	airport := outbound.Origin.Iata
+	if inbound.Destination.Iata != "" && inbound.Destination.Iata != outbound.Origin.Iata {
+		airport = locale.T("notify.connection_airport", inbound.Destination.Iata, outbound.Origin.Iata)
+	}
+
+	if c.State == db.ConnectionImpossible {
+		return locale.T("notify.connection_impossible", trip.Name, in.FlightID, airport, arrival, out.FlightID, departure)
+	}
+	return locale.T("notify.connection_tight", trip.Name, in.FlightID, airport, arrival, locale.Duration(c.Spare().Truncate(time.Minute)), out.FlightID, departure, locale.Duration(minConnection))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"flight-tracker-slack/db"
+	structs "flight-tracker-slack/types"
+)
+
+func unix(t time.Time) *int64 {
+	if t.IsZero() {
+		return nil
+	}
+	u := t.Unix()
+	return &u
+}
+
+// leg builds a flight with the gate times that matter to a connection.
+func leg(scheduledOut, estimatedOut, actualOut, scheduledIn, estimatedIn, actualIn time.Time) structs.FlightDetail {
+	return structs.FlightDetail{
+		GateDepartureTimes: structs.GateTimes{Scheduled: scheduledOut.Unix(), Estimated: unix(estimatedOut), Actual: unix(actualOut)},
+		GateArrivalTimes:   structs.GateTimes{Scheduled: scheduledIn.Unix(), Estimated: unix(estimatedIn), Actual: unix(actualIn)},
+	}
+}
+
+func TestConnectionOf(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2030, time.January, 2, hour, minute, 0, 0, time.UTC)
+	}
+	var none time.Time
+	minConnection := time.Hour
+
+	// the outbound leg is scheduled at 14:00 and hasn't left
+	outbound := leg(at(14, 0), none, none, at(18, 0), none, none)
+	delayedOutbound := leg(at(14, 0), at(14, 45), none, at(18, 0), none, none)
+	departedOutbound := leg(at(14, 0), none, at(14, 5), at(18, 0), none, none)
+
+	cancelledInbound := leg(at(8, 0), none, none, at(12, 0), none, none)
+	cancelledInbound.Cancelled = true
+
+	tests := []struct {
+		name      string
+		inbound   structs.FlightDetail
+		outbound  structs.FlightDetail
+		wantOK    bool
+		wantState string
+		wantSpare time.Duration
+	}{
+		{"on schedule", leg(at(8, 0), none, none, at(12, 0), none, none), outbound, true, db.ConnectionOK, 2 * time.Hour},
+		{"exactly the minimum", leg(at(8, 0), none, none, at(12, 0), at(13, 0), none), outbound, true, db.ConnectionOK, time.Hour},
+		{"estimated late", leg(at(8, 0), none, none, at(12, 0), at(13, 20), none), outbound, true, db.ConnectionTight, 40 * time.Minute},
+		{"actual beats estimate", leg(at(8, 0), none, none, at(12, 0), at(13, 50), at(13, 10)), outbound, true, db.ConnectionTight, 50 * time.Minute},
+		{"arrives after departure", leg(at(8, 0), none, none, at(12, 0), at(14, 10), none), outbound, true, db.ConnectionImpossible, -10 * time.Minute},
+		{"arrives at departure", leg(at(8, 0), none, none, at(12, 0), at(14, 0), none), outbound, true, db.ConnectionImpossible, 0},
+		{"outbound delayed too", leg(at(8, 0), none, none, at(12, 0), at(13, 20), none), delayedOutbound, true, db.ConnectionOK, 85 * time.Minute},
+		{"outbound left", leg(at(8, 0), none, none, at(12, 0), none, none), departedOutbound, false, "", 0},
+		{"inbound cancelled", cancelledInbound, outbound, false, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := connectionOf(tt.inbound, tt.outbound, minConnection)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if c.State != tt.wantState || c.Spare() != tt.wantSpare {
+				t.Errorf("connection = %s with %v spare, want %s with %v", c.State, c.Spare(), tt.wantState, tt.wantSpare)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package structs
 
 import (
+	"strings"
 	"time"
 )
 
@@ -9,6 +10,9 @@ type FlightDataWrapper struct {
 }
 
 type FlightDetail struct {
+	Ident              string         `json:"ident"`
+	DisplayIdent       string         `json:"displayIdent"`
+	IataIdent          string         `json:"iataIdent"`
 	Aircraft           AircraftDetail `json:"aircraft"`
 	Airline            AirlineDetail  `json:"airline"`
 	Altitude           int            `json:"altitude"`
@@ -16,6 +20,8 @@ type FlightDetail struct {
 	Distance           DistanceDetail `json:"distance"`
 	FlightPlan         FlightPlan     `json:"flightPlan"`
 	FlightStatus       string         `json:"flightStatus"`
+	Cancelled          bool           `json:"cancelled"`
+	Diverted           bool           `json:"diverted"`
 	GateArrivalTimes   GateTimes      `json:"gateArrivalTimes"`
 	GateDepartureTimes GateTimes      `json:"gateDepartureTimes"`
 	LandingTimes       GateTimes      `json:"landingTimes"`
@@ -25,6 +31,28 @@ type FlightDetail struct {
 	Heading            int            `json:"heading"`
 	Timestamp          int64          `json:"timestamp"`
 	Track              []TrackPoint   `json:"track"`
+	InboundFlight      *InboundFlight `json:"inboundFlight"`
+	ActivityLog        ActivityLog    `json:"activityLog"`
+}
+
+// ActivityLog lists the recent and upcoming departures of the same flight.
+type ActivityLog struct {
+	Flights []ActivityFlight `json:"flights"`
+}
+
+// ActivityFlight is one departure of the activity log, enough to find it
+// again with its flightaware flight id.
+type ActivityFlight struct {
+	FlightID           string        `json:"flightId"`
+	Origin             AirportDetail `json:"origin"`
+	GateDepartureTimes GateTimes     `json:"gateDepartureTimes"`
+}
+
+// InboundFlight points at the leg the aircraft is flying before this one.
+type InboundFlight struct {
+	FlightID     string `json:"flightId"`
+	Ident        string `json:"ident"`
+	DisplayIdent string `json:"displayIdent"`
 }
 
 type TrackPoint struct {
@@ -64,6 +92,16 @@ type AirportDetail struct {
 	} `json:"delays"`
 }
 
+// Location is the airport's time zone. flightaware prefixes zone names with
+// a colon (":Europe/Paris").
+func (a AirportDetail) Location() *time.Location {
+	loc, err := time.LoadLocation(strings.TrimPrefix(a.TZ, ":"))
+	if err != nil || a.TZ == "" {
+		return time.UTC
+	}
+	return loc
+}
+
 type DistanceDetail struct {
 	Actual    *int `json:"actual"`
 	Elapsed   int  `json:"elapsed"`